@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"mybot/internal/config"
+)
+
+const configUsage = "usage: mybot config check [file]"
+
+// configCmd implements `mybot config check [file]`: it loads the config the
+// way the bot would, prints the effective settings with secrets redacted and
+// lists every problem found. The exit code is 1 when the config is invalid.
+func configCmd(args []string) int {
+	if len(args) == 0 || args[0] != "check" || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+	path := os.Getenv("MYBOT_CONFIG")
+	if len(args) == 2 {
+		path = args[1]
+	}
+	cfg, err := config.LoadFile(path)
+	fmt.Print(cfg.Describe())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "\nconfig errors:")
+		var joined interface{ Unwrap() []error }
+		if errors.As(err, &joined) {
+			for _, e := range joined.Unwrap() {
+				fmt.Fprintf(os.Stderr, "  %v\n", e)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "  %v\n", err)
+		}
+		return 1
+	}
+	fmt.Println("\nconfig OK")
+	return 0
+}
@@ -2,37 +2,93 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 
 	"mybot/internal/adapters/codex"
 	"mybot/internal/config"
 	"mybot/internal/core"
+	"mybot/internal/metrics"
 	"mybot/internal/telegram"
+	"mybot/internal/transcript"
+	"mybot/internal/util"
 )
 
 func main() {
-	_ = config.LoadDotEnv(".env")
+	_ = config.LoadDotEnv(config.DotEnvFile)
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "config":
+			os.Exit(configCmd(os.Args[2:]))
+		case "secrets":
+			os.Exit(secretsCmd(os.Args[2:]))
+		}
+	}
+
+	// Every log line goes through the redactor; the token and the secrets
+	// file's values are registered as soon as they are known.
+	log.SetOutput(util.RedactWriter(os.Stderr))
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("config: %v", err)
 	}
+	util.AddSecret(cfg.Secrets()...)
+	config.ExportSecrets(cfg)
+
+	// A reload reads .env without applying it; the environment changes only
+	// once the new config is accepted.
+	live := config.NewLive(cfg, func() (config.Config, error) {
+		env, err := config.ReadDotEnv(config.DotEnvFile)
+		if err != nil {
+			return config.Config{}, fmt.Errorf(".env: %w", err)
+		}
+		return config.LoadWithDotEnv(env)
+	})
 
-	adapter := codex.New(cfg.CodexCmd, cfg.CodexArgs, cfg.WorkDir, cfg.LogDir)
+	live.OnReload(func(cfg config.Config) {
+		config.ApplyDotEnv(cfg)
+		util.AddSecret(cfg.Secrets()...)
+		config.ExportSecrets(cfg)
+	})
+
+	adapter := codex.New(cfg)
+	live.OnReload(adapter.SetConfig)
+	adapter.SetCodexHome(func(chatKey string) (string, error) {
+		return telegram.SkillProfileHome(live.Get(), chatKey)
+	})
+	adapter.SetItemObserver(func(chatKey string, it transcript.Item) {
+		if err := telegram.ObserveSkillUse(live.Get(), chatKey, it); err != nil {
+			log.Printf("skills: recording usage: %v", err)
+		}
+	})
 	sessions := core.NewSessionManager(adapter, cfg)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	if err := telegram.Run(ctx, cfg, sessions); err != nil {
-		msg := err.Error()
-		if cfg.TelegramToken != "" {
-			msg = strings.ReplaceAll(msg, cfg.TelegramToken, "<redacted>")
+	if cfg.MetricsAddr != "" {
+		go metrics.Serve(ctx, cfg.MetricsAddr)
+	}
+
+	// SIGHUP reloads .env and the config file without dropping running sessions.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				_, _ = telegram.ReloadConfig(live, "SIGHUP")
+			}
 		}
-		log.Fatalf("telegram: %s", msg)
+	}()
+
+	if err := telegram.Run(ctx, live, sessions); err != nil {
+		log.Fatalf("telegram: %v", err)
 	}
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"mybot/internal/config"
+)
+
+const secretsUsage = `usage: mybot secrets keygen <key-file>
+       mybot secrets encrypt <in> <out>
+       mybot secrets decrypt <file>
+
+encrypt/decrypt use SECRETS_KEY_FILE, or SECRETS_PASSPHRASE when no key file is set.`
+
+// secretsCmd implements `mybot secrets`: it creates a key file and seals or
+// opens a SECRETS_FILE. decrypt prints to stdout, for editing and re-sealing.
+func secretsCmd(args []string) int {
+	var err error
+	switch {
+	case len(args) == 2 && args[0] == "keygen":
+		err = keygen(args[1])
+	case len(args) == 3 && args[0] == "encrypt":
+		err = encryptSecrets(args[1], args[2])
+	case len(args) == 2 && args[0] == "decrypt":
+		err = decryptSecrets(args[1])
+	default:
+		fmt.Fprintln(os.Stderr, secretsUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "secrets %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+func keygen(path string) error {
+	key, err := config.NewSecretsKey()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(key); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// unlock returns the key from SECRETS_KEY_FILE or the SECRETS_PASSPHRASE.
+func unlock() ([]byte, string, error) {
+	if path := os.Getenv("SECRETS_KEY_FILE"); path != "" {
+		key, err := config.ReadSecretsKey(path)
+		return key, "", err
+	}
+	if pass := os.Getenv("SECRETS_PASSPHRASE"); pass != "" {
+		return nil, pass, nil
+	}
+	return nil, "", errors.New("set SECRETS_KEY_FILE or SECRETS_PASSPHRASE")
+}
+
+func encryptSecrets(in, out string) error {
+	key, pass, err := unlock()
+	if err != nil {
+		return err
+	}
+	plain, err := os.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	sealed, err := config.SealSecrets(plain, key, pass)
+	if err != nil {
+		return err
+	}
+	tmp := out + ".tmp"
+	if err := os.WriteFile(tmp, sealed, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, out)
+}
+
+func decryptSecrets(path string) error {
+	key, pass, err := unlock()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	plain, err := config.OpenSecrets(data, key, pass)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(plain)
+	return err
+}
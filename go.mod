@@ -3,6 +3,6 @@ module mybot
 go 1.24.2
 
 require (
-	github.com/creack/pty v1.1.24 // indirect
-	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1 // indirect
+	github.com/creack/pty v1.1.24
+	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1
 )
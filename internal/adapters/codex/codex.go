@@ -20,10 +20,17 @@ import (
 
 	"github.com/creack/pty"
 
+	"mybot/internal/config"
 	"mybot/internal/core"
+	"mybot/internal/metrics"
+	"mybot/internal/transcript"
+	"mybot/internal/util"
 )
 
 type Adapter struct {
+	cfgMu sync.Mutex
+	cfg   config.Config // see SetConfig
+
 	cmd    string
 	args   []string
 	dir    string
@@ -44,48 +51,46 @@ type Adapter struct {
 
 	compactMu  sync.Mutex
 	compacting map[string]bool
+
+	// codexHome picks CODEX_HOME per chat ("" = inherit); see SetCodexHome.
+	codexHome func(chatKey string) (string, error)
+
+	// observeItem sees every completed exec item; see SetItemObserver.
+	observeItem func(chatKey string, it transcript.Item)
 }
 
-func New(cmd string, args []string, dir string, logDir string) *Adapter {
+func New(cfg config.Config) *Adapter {
+	cmd, dir, logDir := cfg.CodexCmd, cfg.WorkDir, cfg.LogDir
 	if strings.TrimSpace(logDir) == "" {
 		logDir = "logs"
 	}
 
-	mode := strings.ToLower(strings.TrimSpace(os.Getenv("CODEX_DRIVER")))
-	if mode == "" {
-		if filepath.Base(cmd) == "codex" {
-			mode = "exec"
-		} else {
-			mode = "interactive"
-		}
-	}
+	mode := cfg.CodexDriver
 	if mode != "exec" && mode != "interactive" {
 		mode = "interactive"
 	}
 
-	skipGit := envBool("CODEX_SKIP_GIT_REPO_CHECK", filepath.Base(cmd) == "codex")
-	enableSearch := envBool("CODEX_ENABLE_SEARCH", false)
-
 	fixed := detectFixedArgs(cmd)
-	merged := make([]string, 0, len(fixed)+len(args))
+	merged := make([]string, 0, len(fixed)+len(cfg.CodexArgs))
 	merged = append(merged, fixed...)
-	merged = append(merged, args...)
+	merged = append(merged, cfg.CodexArgs...)
 
 	if dir != "" && filepath.Base(cmd) == "codex" && !hasCdFlag(merged) {
 		merged = append([]string{"--cd", dir}, merged...)
 	}
-	if enableSearch && filepath.Base(cmd) == "codex" && !hasFlag(merged, "--search") {
+	if cfg.CodexEnableSearch && filepath.Base(cmd) == "codex" && !hasFlag(merged, "--search") {
 		merged = append([]string{"--search"}, merged...)
 	}
 
 	a := &Adapter{
+		cfg:              cfg,
 		cmd:              cmd,
 		args:             merged,
 		dir:              dir,
 		logDir:           logDir,
 		fixed:            fixed,
 		mode:             mode,
-		skipGitRepoCheck: skipGit,
+		skipGitRepoCheck: cfg.CodexSkipGitRepoCheck,
 		statePath:        filepath.Join(logDir, "state.json"),
 		threads:          map[string]string{},
 	}
@@ -94,6 +99,72 @@ func New(cmd string, args []string, dir string, logDir string) *Adapter {
 	return a
 }
 
+// chatDir returns the working directory of chatKey's agent: WORKDIR, or the
+// workdir of the chat's [chat.<id>]/[project.<name>] config section.
+func (a *Adapter) chatDir(chatKey string) string {
+	id, err := strconv.ParseInt(chatKey, 10, 64)
+	if err != nil {
+		return a.dir
+	}
+	return a.config().ForChat(id).WorkDir
+}
+
+// SetConfig swaps in a reloaded config. Per-chat workdirs and memory
+// thresholds follow it; the codex command line is fixed at New.
+func (a *Adapter) SetConfig(cfg config.Config) {
+	a.cfgMu.Lock()
+	a.cfg = cfg
+	a.cfgMu.Unlock()
+}
+
+func (a *Adapter) config() config.Config {
+	a.cfgMu.Lock()
+	defer a.cfgMu.Unlock()
+	return a.cfg
+}
+
+// chatArgs returns the global args with --cd pointing at chatKey's directory.
+func (a *Adapter) chatArgs(chatKey string) []string {
+	dir := a.chatDir(chatKey)
+	if dir == a.dir || dir == "" || filepath.Base(a.cmd) != "codex" {
+		return a.args
+	}
+	out := append([]string{}, a.args...)
+	for i := 0; i+1 < len(out); i++ {
+		if out[i] == "-C" || out[i] == "--cd" {
+			out[i+1] = dir
+			return out
+		}
+	}
+	return append([]string{"--cd", dir}, out...)
+}
+
+// SetCodexHome makes the adapter run each chat's codex with the CODEX_HOME
+// returned by f (e.g. a home exposing only the chat's enabled skills).
+// An empty result keeps the inherited environment.
+func (a *Adapter) SetCodexHome(f func(chatKey string) (string, error)) {
+	a.codexHome = f
+}
+
+// SetItemObserver registers f to be called with each completed item of an
+// exec run (commands, messages, file changes), e.g. to derive usage statistics.
+func (a *Adapter) SetItemObserver(f func(chatKey string, it transcript.Item)) {
+	a.observeItem = f
+}
+
+// chatEnv returns the environment for a codex process serving chatKey.
+func (a *Adapter) chatEnv(chatKey string) ([]string, error) {
+	env := os.Environ()
+	if a.codexHome == nil || chatKey == "" {
+		return env, nil
+	}
+	home, err := a.codexHome(chatKey)
+	if err != nil || home == "" {
+		return env, err
+	}
+	return append(env, "CODEX_HOME="+home), nil
+}
+
 type handle struct {
 	sessionID string
 	logDir    string
@@ -101,6 +172,7 @@ type handle struct {
 	cmd       *exec.Cmd
 	pty       *os.File
 	useProcPG bool
+	started   time.Time
 
 	stdin io.WriteCloser
 
@@ -128,7 +200,9 @@ func (a *Adapter) startInteractive(ctx context.Context, sessionID string) (core.
 	// If PTY is not permitted (EPERM) we fall back to pipes. Important:
 	// pty.Start may partially populate cmd.Stdin/Stdout even when returning an error,
 	// so we must not reuse that cmd instance for the pipe fallback.
-	cmdPTY := a.newCmd(ctx, false)
+	chatKey, _ := parseChatKey(sessionID)
+	env, envErr := a.chatEnv(chatKey)
+	cmdPTY := a.newCmd(ctx, chatKey, env, false)
 	f, err := pty.Start(cmdPTY)
 	ptyMode := true
 	var stdin io.WriteCloser
@@ -139,7 +213,7 @@ func (a *Adapter) startInteractive(ctx context.Context, sessionID string) (core.
 		// Some environments disallow PTYs (EPERM). Fall back to pipes so local testing still works.
 		ptyMode = false
 
-		cmdPipe := a.newCmd(ctx, true)
+		cmdPipe := a.newCmd(ctx, chatKey, env, true)
 		stdin, err = cmdPipe.StdinPipe()
 		if err != nil {
 			return nil, fmt.Errorf("pty.Start: %v; StdinPipe: %w", ptyErr, err)
@@ -168,6 +242,7 @@ func (a *Adapter) startInteractive(ctx context.Context, sessionID string) (core.
 		cmd:       cmdPTY,
 		pty:       f,
 		useProcPG: !ptyMode,
+		started:   time.Now(),
 		stdin:     stdin,
 		events:    make(chan core.Event, 256),
 	}
@@ -185,15 +260,18 @@ func (a *Adapter) startInteractive(ctx context.Context, sessionID string) (core.
 		mode = "pipes"
 	}
 	h.events <- core.Event{Type: core.EventStatus, Text: fmt.Sprintf("started pid=%d mode=%s cmd=%s", h.cmd.Process.Pid, mode, a.cmd), Time: time.Now()}
+	if envErr != nil {
+		h.events <- core.Event{Type: core.EventStatus, Text: fmt.Sprintf("skill profile ignored: %v", envErr), Time: time.Now()}
+	}
 	return h, nil
 }
 
-func (a *Adapter) newCmd(ctx context.Context, setpgid bool) *exec.Cmd {
-	cmd := exec.CommandContext(ctx, a.cmd, a.args...)
-	if a.dir != "" {
-		cmd.Dir = a.dir
+func (a *Adapter) newCmd(ctx context.Context, chatKey string, env []string, setpgid bool) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, a.cmd, a.chatArgs(chatKey)...)
+	if dir := a.chatDir(chatKey); dir != "" {
+		cmd.Dir = dir
 	}
-	cmd.Env = append(os.Environ(),
+	cmd.Env = append(env,
 		// Widely-supported conventions to disable ANSI colors/spinners in CLI output.
 		"NO_COLOR=1",
 		"CLICOLOR=0",
@@ -288,42 +366,21 @@ func hasFlag(args []string, want string) bool {
 	return false
 }
 
-func envBool(key string, def bool) bool {
-	v := strings.TrimSpace(os.Getenv(key))
-	if v == "" {
-		return def
-	}
-	switch strings.ToLower(v) {
-	case "1", "true", "yes", "y", "on":
-		return true
-	case "0", "false", "no", "n", "off":
-		return false
-	default:
-		return def
-	}
-}
-
-func envInt(key string, def int) int {
-	v := strings.TrimSpace(os.Getenv(key))
-	if v == "" {
-		return def
-	}
-	n, err := strconv.Atoi(v)
-	if err != nil || n <= 0 {
-		return def
-	}
-	return n
-}
-
 func parseChatKey(sessionID string) (chatKey string, fresh bool) {
 	// Expected format from SessionManager:
 	// - "chat-<chatID>-<ts>"
 	// - "chat-<chatID>-<ts>-fresh"
+	// Group chat IDs are negative, e.g. "chat--100123-<ts>".
 	if strings.HasPrefix(sessionID, "chat-") {
 		rest := strings.TrimPrefix(sessionID, "chat-")
+		neg := strings.HasPrefix(rest, "-")
+		rest = strings.TrimPrefix(rest, "-")
 		parts := strings.Split(rest, "-")
 		if len(parts) >= 2 && parts[0] != "" {
 			chatKey = parts[0]
+			if neg {
+				chatKey = "-" + chatKey
+			}
 		}
 	}
 	if strings.HasSuffix(sessionID, "-fresh") {
@@ -436,13 +493,22 @@ func (a *Adapter) Events(h core.Handle) <-chan core.Event {
 }
 
 func (a *Adapter) Send(h core.Handle, input string) error {
+	return a.SendWithImages(h, input, nil)
+}
+
+// SendWithImages implements core.ImageSender. Only exec mode can attach images;
+// interactive sessions get the paths appended to the prompt.
+func (a *Adapter) SendWithImages(h core.Handle, input string, images []string) error {
 	switch hh := h.(type) {
 	case *handleExec:
-		return a.sendExec(hh, input)
+		return a.sendExec(hh, input, images)
 	case *handle:
 		if hh.stdin == nil {
 			return errors.New("session not started")
 		}
+		if len(images) > 0 {
+			input = strings.TrimRight(input, "\n") + " (attached images: " + strings.Join(images, ", ") + ")"
+		}
 		// Ensure a newline to submit input for most interactive CLIs.
 		if !strings.HasSuffix(input, "\n") {
 			input += "\n"
@@ -484,19 +550,10 @@ func (h *handle) closeEvents() {
 
 func (h *handle) waitLoop() {
 	err := h.cmd.Wait()
-	code := 0
-	if err != nil {
-		var ee *exec.ExitError
-		if errors.As(err, &ee) {
-			if status, ok := ee.Sys().(syscall.WaitStatus); ok {
-				code = status.ExitStatus()
-			} else {
-				code = 1
-			}
-		} else {
-			code = 1
-		}
-	}
+	code := exitCode(err)
+	// A session lives for hours; it is not an exec run.
+	metrics.SessionDuration.Since(h.started)
+	metrics.ExitCodes.Inc(strconv.Itoa(code))
 	h.events <- core.Event{Type: core.EventExit, Code: code, Text: "process exited", Time: time.Now()}
 	if h.pty != nil {
 		_ = h.pty.Close()
@@ -507,6 +564,20 @@ func (h *handle) waitLoop() {
 	h.closeEvents()
 }
 
+// exitCode maps the error from cmd.Wait to a process exit code.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		if status, ok := ee.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+	return 1
+}
+
 func (h *handle) readLoopPTY() {
 	defer func() {
 		// If the PTY read ends before waitLoop, still ensure we don't leak the file.
@@ -544,7 +615,7 @@ func (h *handle) readLoopPTY() {
 				s := string(pending)
 				pending = pending[:0]
 				if lf != nil {
-					_, _ = lf.WriteString(s)
+					_, _ = lf.WriteString(util.Redact(s))
 				}
 				h.events <- core.Event{Type: core.EventStdout, Text: s, Time: time.Now()}
 			}
@@ -587,7 +658,7 @@ func (h *handle) readLoopPipe(r io.ReadCloser, typ core.EventType) {
 	for sc.Scan() {
 		line := sc.Text() + "\n"
 		if lf != nil {
-			_, _ = lf.WriteString(line)
+			_, _ = lf.WriteString(util.Redact(line))
 		}
 		h.events <- core.Event{Type: typ, Text: line, Time: time.Now()}
 	}
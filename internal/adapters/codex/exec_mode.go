@@ -5,15 +5,18 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"mybot/internal/core"
+	"mybot/internal/metrics"
+	"mybot/internal/transcript"
 )
 
 type handleExec struct {
@@ -49,7 +52,7 @@ func (a *Adapter) startExec(ctx context.Context, sessionID string) (core.Handle,
 		chatKey:          chatKey,
 		logDir:           a.logDir,
 		cmdPath:          a.cmd,
-		globalArgs:       a.args,
+		globalArgs:       a.chatArgs(chatKey),
 		skipGitRepoCheck: a.skipGitRepoCheck,
 		events:           make(chan core.Event, 256),
 		adapter:          a,
@@ -66,17 +69,20 @@ func (a *Adapter) startExec(ctx context.Context, sessionID string) (core.Handle,
 	return h, nil
 }
 
-func (a *Adapter) sendExec(h core.Handle, input string) error {
+func (a *Adapter) sendExec(h core.Handle, input string, images []string) error {
 	hh := h.(*handleExec)
 
 	prompt := strings.TrimSpace(input)
 	if prompt == "" {
 		return nil
 	}
+	userInput := prompt
 
 	// Inject memory prefix (durable rules + summary) to keep context short and stable.
+	var memPrefix string
 	if hh.adapter != nil && hh.chatKey != "" {
 		if pfx := hh.adapter.memoryPrefix(hh.chatKey); pfx != "" {
+			memPrefix = pfx
 			prompt = pfx + "用户输入：\n" + prompt
 		}
 	}
@@ -95,6 +101,9 @@ func (a *Adapter) sendExec(h core.Handle, input string) error {
 	if hh.skipGitRepoCheck {
 		argv = append(argv, "--skip-git-repo-check")
 	}
+	for _, img := range images {
+		argv = append(argv, "--image", img)
+	}
 
 	if threadID != "" {
 		// Usage: codex exec resume [OPTIONS] [SESSION_ID] [PROMPT]
@@ -105,6 +114,13 @@ func (a *Adapter) sendExec(h core.Handle, input string) error {
 	}
 
 	cmd := exec.CommandContext(context.Background(), hh.cmdPath, argv...)
+	if hh.adapter != nil {
+		env, err := hh.adapter.chatEnv(hh.chatKey)
+		if err != nil {
+			hh.emit(core.EventStatus, fmt.Sprintf("skill profile ignored: %v\n", err))
+		}
+		cmd.Env = env
+	}
 	// Put in its own process group so /cancel can interrupt the whole tree.
 	setSysProcAttr(cmd)
 
@@ -117,6 +133,7 @@ func (a *Adapter) sendExec(h core.Handle, input string) error {
 		return err
 	}
 
+	start := time.Now()
 	if err := cmd.Start(); err != nil {
 		return err
 	}
@@ -125,8 +142,8 @@ func (a *Adapter) sendExec(h core.Handle, input string) error {
 	hh.running = cmd
 	hh.mu.Unlock()
 
-	// Tee user prompt to transcript (helps debugging).
-	hh.appendTranscript("\n> " + prompt + "\n")
+	// Tee user prompt to transcript (helps debugging and /export).
+	hh.record(transcript.Record{Type: transcript.TypePrompt, Text: userInput, Context: memPrefix, ThreadID: threadID, Images: images})
 
 	done := make(chan struct{})
 	go func() {
@@ -138,6 +155,8 @@ func (a *Adapter) sendExec(h core.Handle, input string) error {
 	}()
 
 	err = cmd.Wait()
+	metrics.ExecDuration.Since(start)
+	metrics.ExitCodes.Inc(strconv.Itoa(exitCode(err)))
 
 	hh.mu.Lock()
 	if hh.running == cmd {
@@ -186,6 +205,7 @@ func (hh *handleExec) readJSONL(r io.ReadCloser) {
 			hh.emit(core.EventStderr, "bad json: "+err.Error()+"\n")
 			continue
 		}
+		hh.recordEvent(ev, line)
 
 		switch ev.Type {
 		case "thread.started":
@@ -201,7 +221,6 @@ func (hh *handleExec) readJSONL(r io.ReadCloser) {
 				hh.mu.Unlock()
 				if toPersist != "" && chatKey != "" && hh.adapter != nil {
 					hh.adapter.setThread(chatKey, toPersist)
-					hh.appendTranscript("[resume thread_id " + toPersist + "]\n")
 				}
 			}
 		case "item.completed":
@@ -210,10 +229,14 @@ func (hh *handleExec) readJSONL(r io.ReadCloser) {
 				if !strings.HasSuffix(txt, "\n") {
 					txt += "\n"
 				}
-				hh.appendTranscript(txt)
 				hh.emit(core.EventStdout, txt)
 			}
 		case "turn.completed":
+			if ev.Usage != nil {
+				metrics.TokensUsed.Add("input", float64(ev.Usage.InputTokens))
+				metrics.TokensUsed.Add("cached_input", float64(ev.Usage.CachedInputTokens))
+				metrics.TokensUsed.Add("output", float64(ev.Usage.OutputTokens))
+			}
 			if ev.Usage != nil && hh.adapter != nil {
 				hh.mu.Lock()
 				tid := hh.threadID
@@ -242,10 +265,10 @@ func (hh *handleExec) readStderr(r io.ReadCloser) {
 		// Codex sometimes prints internal state warnings/errors that don't affect the response.
 		// Keep Telegram output clean by filtering known noisy lines.
 		if isNoisyCodexStderr(line) {
-			hh.appendTranscript("[filtered stderr] " + line)
+			hh.record(transcript.Record{Type: transcript.TypeStderrFiltered, Text: line})
 			continue
 		}
-		hh.appendTranscript(line)
+		hh.record(transcript.Record{Type: transcript.TypeStderr, Text: line})
 		hh.emit(core.EventStderr, line)
 	}
 }
@@ -265,26 +288,61 @@ func (hh *handleExec) emit(typ core.EventType, text string) {
 	case hh.events <- core.Event{Type: typ, Text: text, Time: time.Now()}:
 	default:
 		// Drop on overflow: telegram side also batches.
+		metrics.EventsDropped.Inc()
 	}
 }
 
-func (hh *handleExec) appendTranscript(s string) {
-	base := hh.logDir
-	_ = os.MkdirAll(filepath.Join(base, "sessions"), 0o755)
-	logPath := filepath.Join(base, "sessions", hh.sessionID+".log")
-	f, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
-	if err != nil {
+func (hh *handleExec) record(r transcript.Record) {
+	transcript.Append(hh.logDir, hh.sessionID, r)
+}
+
+// recordEvent stores a raw codex event in the structured transcript.
+// Partial item updates are skipped; item.completed carries the final item.
+func (hh *handleExec) recordEvent(ev codexJSON, line []byte) {
+	r := transcript.Record{Type: transcript.TypeCodex, Event: ev.Type, ThreadID: ev.ThreadID}
+	switch ev.Type {
+	case "item.started", "item.updated":
 		return
+	case "item.completed":
+		r.Item = ev.RawItem
+		if hh.adapter != nil && hh.adapter.observeItem != nil && hh.chatKey != "" {
+			if it := r.ParseItem(); it != nil {
+				hh.adapter.observeItem(hh.chatKey, *it)
+			}
+		}
+	case "turn.completed":
+		if ev.Usage != nil {
+			u := transcript.Usage(*ev.Usage)
+			r.Usage = &u
+		}
+	default:
+		r.Raw = append(json.RawMessage(nil), line...)
 	}
-	defer f.Close()
-	_, _ = f.WriteString(s)
+	hh.record(r)
 }
 
 type codexJSON struct {
-	Type     string      `json:"type"`
-	ThreadID string      `json:"thread_id"`
-	Item     *codexItem  `json:"item"`
-	Usage    *codexUsage `json:"usage"`
+	Type     string          `json:"type"`
+	ThreadID string          `json:"thread_id"`
+	RawItem  json.RawMessage `json:"item"`
+	Item     *codexItem      `json:"-"`
+	Usage    *codexUsage     `json:"usage"`
+}
+
+func (ev *codexJSON) UnmarshalJSON(b []byte) error {
+	type plain codexJSON
+	if err := json.Unmarshal(b, (*plain)(ev)); err != nil {
+		return err
+	}
+	ev.Item = nil
+	if len(ev.RawItem) > 0 && string(ev.RawItem) != "null" {
+		var it codexItem
+		if err := json.Unmarshal(ev.RawItem, &it); err != nil {
+			return err
+		}
+		ev.Item = &it
+	}
+	return nil
 }
 
 type codexItem struct {
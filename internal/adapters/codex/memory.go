@@ -12,6 +12,8 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"mybot/internal/metrics"
 )
 
 type memoryFile struct {
@@ -41,15 +43,15 @@ type compactResult struct {
 }
 
 func (a *Adapter) memoryEnabled() bool {
-	return envBool("MEMORY_ENABLE", true) && filepath.Base(a.cmd) == "codex" && a.mode == "exec"
+	return a.config().MemoryEnable && filepath.Base(a.cmd) == "codex" && a.mode == "exec"
 }
 
 func (a *Adapter) memoryTokenThreshold() int {
-	return envInt("MEMORY_TOKEN_THRESHOLD", 60000)
+	return a.config().MemoryTokenThreshold
 }
 
 func (a *Adapter) memoryTurnThreshold() int {
-	return envInt("MEMORY_TURN_THRESHOLD", 40)
+	return a.config().MemoryTurnThreshold
 }
 
 func (a *Adapter) memoryPath() string {
@@ -195,12 +197,14 @@ func (a *Adapter) onTurnCompleted(chatKey, threadID string, usage codexUsage, no
 		}()
 
 		if err := a.compactChat(chatKey, threadID); err != nil {
+			metrics.Compactions.Inc("failed")
 			if notify != nil {
 				notify("对话压缩失败（将继续使用原会话）： " + err.Error() + "\n")
 			}
 			// Best-effort: keep running; errors will surface in transcripts.
 			return
 		}
+		metrics.Compactions.Inc("ok")
 		if notify != nil {
 			mem := a.getMem(chatKey)
 			rn := 0
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The config file may tune single chats and groups of chats:
+//
+//	[project.blog]
+//	chats = [123456, -100987]
+//	workdir = "/srv/blog"
+//
+//	[chat."-100987"]
+//	group_trigger = "all"
+//
+// A chat's own section wins over its project's, and both win over the global
+// settings (environment included). Only the keys in chatKeyOf are allowed.
+
+// ForChat returns the config for chatID: c with the chat's [project.<name>]
+// and [chat.<id>] sections applied.
+func (c Config) ForChat(chatID int64) Config {
+	if cc, ok := c.chats[chatID]; ok {
+		return cc
+	}
+	if c.global != nil {
+		return *c.global
+	}
+	return c
+}
+
+// link points every per-chat config back at c, for ForChat.
+func (c *Config) link() {
+	global := *c
+	for id, cc := range c.chats {
+		cc.chats, cc.global = c.chats, &global
+		c.chats[id] = cc
+	}
+}
+
+// loadChats checks every file key and builds the per-chat configs on top of base.
+func (l *loader) loadChats(base Config) map[int64]Config {
+	if l.file == nil {
+		return nil
+	}
+	chatSection := map[int64]string{}
+	projectOf := map[int64]string{}
+	var projects []string
+	seenProject := map[string]bool{}
+
+	for _, k := range l.file.keys {
+		fv := l.file.values[k]
+		if _, ok := envOfFileKey[k]; ok {
+			continue
+		}
+		kind, rest, _ := strings.Cut(k, ".")
+		if kind != "chat" && kind != "project" {
+			l.errs = append(l.errs, fmt.Errorf("%s: unknown key %s", l.file.at(fv.line), k))
+			continue
+		}
+		i := strings.LastIndex(rest, ".")
+		if i <= 0 {
+			l.errs = append(l.errs, fmt.Errorf("%s: %s needs a name, e.g. [%s.\"-100123\"] or [project.blog]", l.file.at(fv.line), k, kind))
+			continue
+		}
+		name, key := rest[:i], rest[i+1:]
+		section := kind + "." + name
+		if _, ok := envOfChatKey[key]; !ok && !(kind == "project" && key == "chats") {
+			l.errs = append(l.errs, fmt.Errorf("%s: %s is not a per-chat setting (allowed: %s)", l.file.at(fv.line), key, chatKeyList()))
+			continue
+		}
+		if kind == "chat" {
+			id, err := strconv.ParseInt(name, 10, 64)
+			if err != nil {
+				l.errs = append(l.errs, fmt.Errorf("%s: [chat.%s]: want a numeric chat id", l.file.at(fv.line), name))
+				continue
+			}
+			if _, ok := base.Allowlist[id]; !ok && base.Allowlist != nil {
+				l.errs = append(l.errs, fmt.Errorf("%s: [chat.%s]: chat is not in TELEGRAM_ALLOWLIST", l.file.at(fv.line), name))
+				continue
+			}
+			chatSection[id] = section
+		} else if !seenProject[section] {
+			seenProject[section] = true
+			projects = append(projects, section)
+		}
+	}
+
+	for _, p := range projects {
+		fv, ok := l.file.values[p+".chats"]
+		if !ok {
+			l.errs = append(l.errs, fmt.Errorf("%s: [%s] needs chats = [<chat_id>, ...]", l.file.path, p))
+			continue
+		}
+		r := rawValue{v: fv.v, src: l.file.at(fv.line), key: p + ".chats"}
+		list, ok := fv.v.([]any)
+		if !ok {
+			l.fail(r, "want a list of chat ids")
+			continue
+		}
+		ids, err := parseIDList(list)
+		if err != nil {
+			l.fail(r, "%v", err)
+			continue
+		}
+		for _, id := range sortedIDs(ids) {
+			if _, ok := base.Allowlist[id]; !ok && base.Allowlist != nil {
+				l.fail(r, "chat %d is not in TELEGRAM_ALLOWLIST", id)
+				continue
+			}
+			if other, dup := projectOf[id]; dup {
+				l.fail(r, "chat %d is already in [%s]", id, other)
+				continue
+			}
+			projectOf[id] = p
+		}
+	}
+
+	members := map[int64]struct{}{}
+	for id := range chatSection {
+		members[id] = struct{}{}
+	}
+	for id := range projectOf {
+		members[id] = struct{}{}
+	}
+	chats := map[int64]Config{}
+	for _, id := range sortedIDs(members) {
+		var scopes []string
+		if s, ok := chatSection[id]; ok {
+			scopes = append(scopes, s)
+		}
+		if p, ok := projectOf[id]; ok {
+			scopes = append(scopes, p)
+		}
+		sub := &loader{file: l.file, scopes: scopes}
+		c := base
+		sub.loadChat(&c)
+		c.settings = sub.settings
+		l.errs = append(l.errs, sub.errs...)
+		chats[id] = c
+	}
+	if len(chats) == 0 {
+		return nil
+	}
+	return chats
+}
+
+func chatKeyList() string {
+	var out []string
+	for k := range envOfChatKey {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ", ")
+}
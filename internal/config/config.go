@@ -3,11 +3,15 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"mybot/internal/util"
 )
 
 type Config struct {
@@ -17,11 +21,38 @@ type Config struct {
 	HideStatus    bool
 	SetCommands   bool
 
+	// BotAPIURL points at a self-hosted telegram-bot-api server (e.g. http://127.0.0.1:8081)
+	// instead of https://api.telegram.org; it lifts the 20MB download / 50MB upload limits.
+	// BotAPILocal means that server runs with --local and returns absolute file paths.
+	BotAPIURL   string
+	BotAPILocal bool
+
+	// Admins are Telegram user IDs (msg.From.ID) that always have the admin role.
+	// DefaultRole applies to users in allowlisted chats without an explicit grant.
+	Admins      map[int64]struct{}
+	DefaultRole string
+
+	// GroupTrigger controls which group messages reach the agent:
+	// "mention" (only @mentions and replies to the bot) or "all".
+	GroupTrigger string
+
 	// CodexCmd/CodexArgs define the interactive CLI command to spawn.
 	// Defaults to "codex". Args are appended after built-in fixed args in code.
 	CodexCmd  string
 	CodexArgs []string
 
+	// CodexDriver is "exec" (one `codex exec --json` run per message) or
+	// "interactive" (a long-lived CLI on a PTY). Defaults to exec for codex.
+	CodexDriver           string
+	CodexSkipGitRepoCheck bool
+	CodexEnableSearch     bool
+
+	// Memory compaction (exec driver only): once a thread passes either
+	// threshold it is summarized into durable rules and a short summary.
+	MemoryEnable         bool
+	MemoryTokenThreshold int
+	MemoryTurnThreshold  int
+
 	// Back-compat: older env var names.
 	AdapterCmd  string
 	AdapterArgs []string
@@ -31,86 +62,639 @@ type Config struct {
 	MaxUploadBytes int64
 	SkillsDir      string
 
+	// CodexHome is codex's own home (CODEX_HOME, default ~/.codex). Chats with a
+	// skill profile get a generated home that links back into it.
+	CodexHome string
+
+	// Downloads of uploaded files: overall timeout per file and retries on transient errors.
+	DownloadTimeout time.Duration
+	DownloadRetries int
+
+	// Uploads live in per-chat folders (UPLOAD_DIR/<chat_id>). UploadQuotaBytes caps
+	// each folder (0 = unlimited); UploadRetention removes entries older than it (0 = keep).
+	UploadQuotaBytes int64
+	UploadRetention  time.Duration
+
+	// Archive uploads (.zip/.tar/.tar.gz/.tgz) are extracted into a folder
+	// next to the upload, within these caps.
+	ArchiveExtract  bool
+	ArchiveMaxBytes int64
+	ArchiveMaxFiles int
+
+	// STTCmd transcribes voice/audio uploads: the saved file path replaces "{file}"
+	// or is appended; stdout is the transcript. Empty disables transcription.
+	STTCmd     []string
+	STTTimeout time.Duration
+
+	// ReturnFiles offers files created/changed in WORKDIR during a run back to the chat.
+	ReturnFiles bool
+
 	// Output batching for Telegram.
 	FlushInterval time.Duration
 	MaxChunkBytes int
 
+	// LongReplyBytes: replies larger than this are sent as a preview plus the full
+	// text as a document in LongReplyFormat ("md" or "html"). 0 disables.
+	LongReplyBytes  int
+	LongReplyFormat string
+
 	// Safety.
 	LogDir string
+
+	// Observability: address for the Prometheus /metrics endpoint (empty = disabled).
+	MetricsAddr string
+
+	// ConfigFile is the config file Load read ("" = environment only).
+	ConfigFile string
+
+	// SecretEnv holds the SECRETS_FILE entries that are not config keys, such
+	// as provider API keys; ExportSecrets hands them to child processes.
+	SecretEnv map[string]string
+
+	// DotEnv holds the .env entries the config was loaded with; ApplyDotEnv
+	// puts them into the process environment.
+	DotEnv map[string]string
+
+	// chats holds the effective config of chats that have a [chat.<id>] or
+	// [project.<name>] section; see ForChat.
+	chats  map[int64]Config
+	global *Config
+	// settings records each effective value and its source, for Describe.
+	settings []Setting
 }
 
+// DefaultConfigFile is read when MYBOT_CONFIG is unset and the file exists.
+const DefaultConfigFile = "mybot.toml"
+
+// Load reads the config file (MYBOT_CONFIG, default mybot.toml if present)
+// and the environment. Environment variables override the file; invalid
+// values are errors rather than silently replaced by defaults.
 func Load() (Config, error) {
-	var cfg Config
+	return LoadFile(os.Getenv("MYBOT_CONFIG"))
+}
+
+// LoadFile is Load with an explicit config file; "" means DefaultConfigFile
+// if it exists. All problems found are reported together.
+func LoadFile(path string) (Config, error) {
+	return loadFile(path, os.Getenv, appliedDotEnv())
+}
+
+// loadFile reads the environment through getenv; dotenv is the .env it
+// reflects.
+func loadFile(path string, getenv func(string) string, dotenv map[string]string) (Config, error) {
+	l := &loader{env: true, environ: getenv}
+	path = strings.TrimSpace(path)
+	if path == "" {
+		if _, err := os.Stat(DefaultConfigFile); err == nil {
+			path = DefaultConfigFile
+		}
+	}
+	if path != "" {
+		f, err := readFile(path)
+		if err != nil {
+			return Config{ConfigFile: path}, err
+		}
+		l.file = f
+	}
 
-	cfg.TelegramToken = strings.TrimSpace(os.Getenv("TELEGRAM_BOT_TOKEN"))
-	if cfg.TelegramToken == "" {
-		return cfg, errors.New("missing TELEGRAM_BOT_TOKEN")
+	l.loadSecrets()
+	cfg := l.load()
+	cfg.ConfigFile = path
+	cfg.SecretEnv = l.secretEnv()
+	cfg.DotEnv = dotenv
+	cfg.chats = l.loadChats(cfg)
+	cfg.settings = l.settings
+	cfg.link()
+	if len(l.errs) > 0 {
+		return cfg, errors.Join(l.errs...)
 	}
+	return cfg, nil
+}
 
-	allow := strings.TrimSpace(os.Getenv("TELEGRAM_ALLOWLIST"))
-	if allow == "" {
-		return cfg, errors.New("missing TELEGRAM_ALLOWLIST (comma-separated chat_id list)")
+func (l *loader) load() Config {
+	var cfg Config
+
+	cfg.TelegramToken = l.token()
+	if cfg.TelegramToken == "" && len(l.errs) == 0 {
+		l.errs = append(l.errs, errors.New("missing TELEGRAM_BOT_TOKEN (or TELEGRAM_BOT_TOKEN_FILE, TOKEN_CMD, SECRETS_FILE, or telegram.bot_token in the config file)"))
 	}
-	al, err := parseAllowlist(allow)
-	if err != nil {
-		return cfg, fmt.Errorf("TELEGRAM_ALLOWLIST: %w", err)
+	al, ok := l.ids("TELEGRAM_ALLOWLIST")
+	if !ok {
+		l.errs = append(l.errs, errors.New("missing TELEGRAM_ALLOWLIST (comma-separated chat_id list, or telegram.allowlist in the config file)"))
 	}
 	cfg.Allowlist = al
-	cfg.LogUnknown = envBool("TELEGRAM_LOG_UNKNOWN", false)
-	cfg.HideStatus = envBool("TELEGRAM_HIDE_STATUS", false)
-	cfg.SetCommands = envBool("TELEGRAM_SET_COMMANDS", true)
+	cfg.Admins = map[int64]struct{}{}
+	if ad, ok := l.ids("TELEGRAM_ADMINS"); ok && ad != nil {
+		cfg.Admins = ad
+	}
 
-	cfg.CodexCmd = strings.TrimSpace(os.Getenv("CODEX_CMD"))
-	cfg.CodexArgs = splitArgs(os.Getenv("CODEX_ARGS"))
+	// Settings a chat or project section may override, with their defaults.
+	cfg.DefaultRole = "viewer"
+	cfg.GroupTrigger = "mention"
+	cfg.ReturnFiles = true
+	cfg.LongReplyBytes = 12000
+	cfg.LongReplyFormat = "md"
+	if wd, err := os.Getwd(); err == nil {
+		cfg.WorkDir = wd
+	}
+	l.loadChat(&cfg)
 
-	// Back-compat env vars.
-	cfg.AdapterCmd = strings.TrimSpace(os.Getenv("ADAPTER_CMD"))
-	cfg.AdapterArgs = splitArgs(os.Getenv("ADAPTER_ARGS"))
+	cfg.LogUnknown = l.boolean("TELEGRAM_LOG_UNKNOWN", false)
+	cfg.SetCommands = l.boolean("TELEGRAM_SET_COMMANDS", true)
 
-	if cfg.CodexCmd == "" {
-		cfg.CodexCmd = strings.TrimSpace(os.Getenv("CODEX_BIN"))
+	cfg.BotAPIURL = strings.TrimRight(l.str("TELEGRAM_API_URL", ""), "/")
+	if cfg.BotAPIURL != "" {
+		u, err := url.Parse(cfg.BotAPIURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			r, _ := l.lookup("TELEGRAM_API_URL")
+			l.fail(r, "want http(s)://host[:port]")
+			cfg.BotAPIURL = ""
+		}
+	}
+	cfg.BotAPILocal = l.boolean("TELEGRAM_API_LOCAL", false)
+
+	cfg.CodexCmd = l.str("CODEX_CMD", "")
+	cfg.CodexArgs = l.args("CODEX_ARGS")
+
+	// Back-compat env vars.
+	cfg.AdapterCmd = strings.TrimSpace(l.getenv("ADAPTER_CMD"))
+	if s := strings.TrimSpace(l.getenv("ADAPTER_ARGS")); s != "" {
+		args, err := util.SplitWords(s)
+		if err != nil {
+			l.fail(rawValue{v: s, src: "env", key: "ADAPTER_ARGS"}, "%v", err)
+		}
+		cfg.AdapterArgs = args
 	}
+
 	if cfg.CodexCmd == "" {
-		if cfg.AdapterCmd != "" {
+		if bin := strings.TrimSpace(l.getenv("CODEX_BIN")); bin != "" {
+			cfg.CodexCmd = bin
+			l.note("CODEX_CMD", bin, "env CODEX_BIN")
+		} else if cfg.AdapterCmd != "" {
 			cfg.CodexCmd = cfg.AdapterCmd
+			l.note("CODEX_CMD", cfg.AdapterCmd, "env ADAPTER_CMD")
 		} else {
 			cfg.CodexCmd = "codex"
+			l.note("CODEX_CMD", "codex", "default")
 		}
 	}
 	if len(cfg.CodexArgs) == 0 && len(cfg.AdapterArgs) != 0 {
 		cfg.CodexArgs = cfg.AdapterArgs
+		l.note("CODEX_ARGS", strings.Join(cfg.AdapterArgs, " "), "env ADAPTER_ARGS")
+	}
+
+	isCodex := filepath.Base(cfg.CodexCmd) == "codex"
+	driver := "interactive"
+	if isCodex {
+		driver = "exec"
+	}
+	cfg.CodexDriver = l.oneOf("CODEX_DRIVER", driver, "exec", "interactive")
+	cfg.CodexSkipGitRepoCheck = l.boolean("CODEX_SKIP_GIT_REPO_CHECK", isCodex)
+	cfg.CodexEnableSearch = l.boolean("CODEX_ENABLE_SEARCH", false)
+
+	cfg.MemoryEnable = l.boolean("MEMORY_ENABLE", true)
+	cfg.MemoryTokenThreshold = l.integer("MEMORY_TOKEN_THRESHOLD", 60000, 1)
+	cfg.MemoryTurnThreshold = l.integer("MEMORY_TURN_THRESHOLD", 40, 1)
+
+	cfg.UploadDir = l.str("UPLOAD_DIR", "uploads")
+	if cfg.BotAPIURL != "" {
+		cfg.MaxUploadBytes = l.int64("MAX_UPLOAD_BYTES", 2000*1024*1024, 1) // local Bot API server: 2000MB
+	} else {
+		cfg.MaxUploadBytes = l.int64("MAX_UPLOAD_BYTES", 20*1024*1024, 1) // 20MB
+	}
+	cfg.DownloadTimeout = l.duration("DOWNLOAD_TIMEOUT", 10*time.Minute, 1)
+	cfg.DownloadRetries = l.integer("DOWNLOAD_RETRIES", 3, 0)
+
+	if cfg.BotAPIURL != "" {
+		// A local Bot API server takes files up to 2000MB; a 500MB quota would
+		// refuse them, so there is no default quota.
+		cfg.UploadQuotaBytes = l.int64("UPLOAD_QUOTA_BYTES", 0, 0)
+	} else {
+		cfg.UploadQuotaBytes = l.int64("UPLOAD_QUOTA_BYTES", 500*1024*1024, 0) // 500MB per chat
+	}
+	cfg.UploadRetention = l.duration("UPLOAD_RETENTION", 0, 0)
+
+	cfg.ArchiveExtract = l.boolean("ARCHIVE_EXTRACT", true)
+	cfg.ArchiveMaxBytes = l.int64("ARCHIVE_MAX_BYTES", 200*1024*1024, 1) // 200MB
+	cfg.ArchiveMaxFiles = l.integer("ARCHIVE_MAX_FILES", 2000, 1)
+
+	cfg.STTCmd = l.args("STT_CMD")
+	cfg.STTTimeout = l.duration("STT_TIMEOUT", 2*time.Minute, 1)
+
+	var home string
+	if h, err := os.UserHomeDir(); err == nil && h != "" {
+		home = filepath.Join(h, ".codex")
 	}
+	cfg.CodexHome = l.str("CODEX_HOME", home)
+	var skills string
+	if cfg.CodexHome != "" {
+		skills = filepath.Join(cfg.CodexHome, "skills")
+	}
+	cfg.SkillsDir = l.str("SKILLS_DIR", skills)
+
+	cfg.FlushInterval = l.duration("FLUSH_INTERVAL", 1200*time.Millisecond, 1)
+	cfg.MaxChunkBytes = l.integer("MAX_CHUNK_BYTES", 3500, 1) // keep under Telegram limits after escaping
+
+	cfg.LogDir = l.str("LOG_DIR", "logs")
+
+	cfg.MetricsAddr = l.str("METRICS_ADDR", "")
+
+	return cfg
+}
+
+// loadChat reads the settings a [chat.<id>] or [project.<name>] section may
+// change; cfg holds the values to keep when they are not set.
+func (l *loader) loadChat(cfg *Config) {
+	cfg.WorkDir = l.str("WORKDIR", cfg.WorkDir)
+	cfg.DefaultRole = l.oneOf("TELEGRAM_DEFAULT_ROLE", cfg.DefaultRole, "none", "viewer", "operator", "admin")
+	cfg.GroupTrigger = l.oneOf("TELEGRAM_GROUP_TRIGGER", cfg.GroupTrigger, "mention", "all")
+	cfg.HideStatus = l.boolean("TELEGRAM_HIDE_STATUS", cfg.HideStatus)
+	cfg.ReturnFiles = l.boolean("RETURN_FILES", cfg.ReturnFiles)
+	cfg.LongReplyBytes = l.integer("LONG_REPLY_BYTES", cfg.LongReplyBytes, 0)
+	cfg.LongReplyFormat = l.oneOf("LONG_REPLY_FORMAT", cfg.LongReplyFormat, "md", "html")
+}
+
+// keys maps each environment variable to its config file key, and to its key
+// inside [chat.<id>]/[project.<name>] sections for per-chat settings.
+var keys = []struct{ env, file, chat string }{
+	{"TELEGRAM_BOT_TOKEN", "telegram.bot_token", ""},
+	{"TELEGRAM_BOT_TOKEN_FILE", "telegram.bot_token_file", ""},
+	{"TOKEN_CMD", "telegram.token_cmd", ""},
+	{"TELEGRAM_ALLOWLIST", "telegram.allowlist", ""},
+	{"TELEGRAM_ADMINS", "telegram.admins", ""},
+	{"TELEGRAM_DEFAULT_ROLE", "telegram.default_role", "default_role"},
+	{"TELEGRAM_GROUP_TRIGGER", "telegram.group_trigger", "group_trigger"},
+	{"TELEGRAM_LOG_UNKNOWN", "telegram.log_unknown", ""},
+	{"TELEGRAM_HIDE_STATUS", "telegram.hide_status", "hide_status"},
+	{"TELEGRAM_SET_COMMANDS", "telegram.set_commands", ""},
+	{"TELEGRAM_API_URL", "telegram.api_url", ""},
+	{"TELEGRAM_API_LOCAL", "telegram.api_local", ""},
+
+	{"CODEX_CMD", "codex.cmd", ""},
+	{"CODEX_ARGS", "codex.args", ""},
+	{"CODEX_DRIVER", "codex.driver", ""},
+	{"CODEX_SKIP_GIT_REPO_CHECK", "codex.skip_git_repo_check", ""},
+	{"CODEX_ENABLE_SEARCH", "codex.enable_search", ""},
+	{"CODEX_HOME", "codex.home", ""},
+
+	{"MEMORY_ENABLE", "memory.enable", ""},
+	{"MEMORY_TOKEN_THRESHOLD", "memory.token_threshold", ""},
+	{"MEMORY_TURN_THRESHOLD", "memory.turn_threshold", ""},
+
+	{"WORKDIR", "workdir", "workdir"},
+	{"LOG_DIR", "log_dir", ""},
+	{"SKILLS_DIR", "skills.dir", ""},
+
+	{"UPLOAD_DIR", "uploads.dir", ""},
+	{"MAX_UPLOAD_BYTES", "uploads.max_bytes", ""},
+	{"UPLOAD_QUOTA_BYTES", "uploads.quota_bytes", ""},
+	{"UPLOAD_RETENTION", "uploads.retention", ""},
+	{"DOWNLOAD_TIMEOUT", "uploads.download_timeout", ""},
+	{"DOWNLOAD_RETRIES", "uploads.download_retries", ""},
+	{"ARCHIVE_EXTRACT", "uploads.archive_extract", ""},
+	{"ARCHIVE_MAX_BYTES", "uploads.archive_max_bytes", ""},
+	{"ARCHIVE_MAX_FILES", "uploads.archive_max_files", ""},
+	{"STT_CMD", "uploads.stt_cmd", ""},
+	{"STT_TIMEOUT", "uploads.stt_timeout", ""},
+
+	{"RETURN_FILES", "output.return_files", "return_files"},
+	{"FLUSH_INTERVAL", "output.flush_interval", ""},
+	{"MAX_CHUNK_BYTES", "output.max_chunk_bytes", ""},
+	{"LONG_REPLY_BYTES", "output.long_reply_bytes", "long_reply_bytes"},
+	{"LONG_REPLY_FORMAT", "output.long_reply_format", "long_reply_format"},
+
+	{"METRICS_ADDR", "metrics.addr", ""},
+
+	{"SECRETS_FILE", "secrets.file", ""},
+	{"SECRETS_KEY_FILE", "secrets.key_file", ""},
+	{"SECRETS_PASSPHRASE", "secrets.passphrase", ""},
+}
+
+// secretKeys are redacted by Describe and Changes, as are all SecretEnv entries.
+var secretKeys = map[string]bool{"TELEGRAM_BOT_TOKEN": true, "SECRETS_PASSPHRASE": true}
 
-	cfg.WorkDir = strings.TrimSpace(os.Getenv("WORKDIR"))
-	if cfg.WorkDir == "" {
-		if wd, err := os.Getwd(); err == nil {
-			cfg.WorkDir = wd
+var fileKeyOf, chatKeyOf, envOfFileKey, envOfChatKey = keyMaps()
+
+func keyMaps() (fileKey, chatKey, byFile, byChat map[string]string) {
+	fileKey, chatKey = map[string]string{}, map[string]string{}
+	byFile, byChat = map[string]string{}, map[string]string{}
+	for _, k := range keys {
+		fileKey[k.env] = k.file
+		byFile[k.file] = k.env
+		if k.chat != "" {
+			chatKey[k.env] = k.chat
+			byChat[k.chat] = k.env
 		}
 	}
-	cfg.UploadDir = strings.TrimSpace(os.Getenv("UPLOAD_DIR"))
-	if cfg.UploadDir == "" {
-		cfg.UploadDir = "uploads"
+	return
+}
+
+// Setting is one effective value and where it came from: "env", "default",
+// "<file>:<line>", or the secrets file. Secret values are never shown.
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+	Secret bool
+}
+
+// loader reads settings from the environment and the config file, collecting
+// every error. With scopes set it reads only those file sections (a chat's
+// [chat.<id>] and [project.<name>], most specific first).
+type loader struct {
+	env      bool
+	environ  func(string) string // nil: os.Getenv
+	file     *fileConfig
+	scopes   []string
+	errs     []error
+	settings []Setting
+
+	// secrets holds the entries of secretsFile (SECRETS_FILE).
+	secrets     map[string]string
+	secretsFile string
+}
+
+// rawValue is a setting as written, before validation.
+type rawValue struct {
+	v   any
+	src string
+	key string // as spelled by the user, e.g. TELEGRAM_ADMINS or telegram.admins
+}
+
+func (l *loader) getenv(key string) string {
+	if l.environ == nil {
+		return os.Getenv(key)
 	}
-	cfg.MaxUploadBytes = envInt64("MAX_UPLOAD_BYTES", 20*1024*1024) // 20MB
+	return l.environ(key)
+}
 
-	cfg.SkillsDir = strings.TrimSpace(os.Getenv("SKILLS_DIR"))
-	if cfg.SkillsDir == "" {
-		if ch := strings.TrimSpace(os.Getenv("CODEX_HOME")); ch != "" {
-			cfg.SkillsDir = filepath.Join(ch, "skills")
-		} else if home, err := os.UserHomeDir(); err == nil && home != "" {
-			cfg.SkillsDir = filepath.Join(home, ".codex", "skills")
+func (l *loader) lookup(key string) (rawValue, bool) {
+	if l.scopes != nil {
+		ck, ok := chatKeyOf[key]
+		if !ok {
+			return rawValue{}, false
+		}
+		for _, p := range l.scopes {
+			if fv, ok := l.file.values[p+"."+ck]; ok {
+				return rawValue{v: fv.v, src: l.file.at(fv.line), key: p + "." + ck}, true
+			}
 		}
+		return rawValue{}, false
 	}
+	if l.env {
+		if s := strings.TrimSpace(l.getenv(key)); s != "" {
+			return rawValue{v: s, src: "env", key: key}, true
+		}
+		if s := l.secrets[key]; s != "" {
+			return rawValue{v: s, src: l.secretsFile, key: key}, true
+		}
+	}
+	if l.file != nil {
+		if fv, ok := l.file.values[fileKeyOf[key]]; ok {
+			return rawValue{v: fv.v, src: l.file.at(fv.line), key: fileKeyOf[key]}, true
+		}
+	}
+	return rawValue{}, false
+}
 
-	cfg.FlushInterval = envDuration("FLUSH_INTERVAL", 1200*time.Millisecond)
-	cfg.MaxChunkBytes = envInt("MAX_CHUNK_BYTES", 3500) // keep under Telegram limits after escaping
+// scalar returns a non-list value as a string.
+func (r rawValue) scalar() (string, bool) {
+	switch v := r.v.(type) {
+	case string:
+		return strings.TrimSpace(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
 
-	cfg.LogDir = strings.TrimSpace(os.Getenv("LOG_DIR"))
-	if cfg.LogDir == "" {
-		cfg.LogDir = "logs"
+func (l *loader) fail(r rawValue, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if r.src == "env" {
+		l.errs = append(l.errs, fmt.Errorf("%s=%q: %s", r.key, r.v, msg))
+		return
+	}
+	shown := fmt.Sprint(r.v)
+	if s, ok := r.v.(string); ok {
+		shown = strconv.Quote(s)
 	}
+	l.errs = append(l.errs, fmt.Errorf("%s: %s = %s: %s", r.src, r.key, shown, msg))
+}
 
-	return cfg, nil
+// note records the effective value of key; a later note replaces it.
+func (l *loader) note(key, value, src string) {
+	if l.scopes != nil && src == "default" {
+		return // chats only list what their sections change
+	}
+	s := Setting{Key: key, Value: value, Source: src, Secret: secretKeys[key]}
+	for i := range l.settings {
+		if l.settings[i].Key == key {
+			l.settings[i] = s
+			return
+		}
+	}
+	l.settings = append(l.settings, s)
+}
+
+// noteSecret is note for a value that is secret whatever its key.
+func (l *loader) noteSecret(key, value, src string) {
+	l.note(key, value, src)
+	for i := range l.settings {
+		if l.settings[i].Key == key {
+			l.settings[i].Secret = true
+		}
+	}
+}
+
+// scalarValue looks key up and converts it with parse; an unset or empty key,
+// or an invalid value (recorded as an error), gives def.
+func scalarValue[T any](l *loader, key string, def T, parse func(string) (T, error), show func(T) string) T {
+	r, ok := l.lookup(key)
+	if !ok {
+		l.note(key, show(def), "default")
+		return def
+	}
+	s, ok := r.scalar()
+	if !ok {
+		l.fail(r, "want a single value, not a list")
+		return def
+	}
+	if s == "" {
+		l.note(key, show(def), "default")
+		return def
+	}
+	v, err := parse(s)
+	if err != nil {
+		l.fail(r, "%v", err)
+		return def
+	}
+	l.note(key, show(v), r.src)
+	return v
+}
+
+func (l *loader) str(key, def string) string {
+	return scalarValue(l, key, def, func(s string) (string, error) { return s, nil }, func(s string) string { return s })
+}
+
+func (l *loader) oneOf(key, def string, choices ...string) string {
+	return scalarValue(l, key, def, func(s string) (string, error) {
+		s = strings.ToLower(s)
+		for _, c := range choices {
+			if s == c {
+				return s, nil
+			}
+		}
+		return "", fmt.Errorf("want one of %s", strings.Join(choices, "|"))
+	}, func(s string) string { return s })
+}
+
+func (l *loader) boolean(key string, def bool) bool {
+	return scalarValue(l, key, def, parseBool, strconv.FormatBool)
+}
+
+func (l *loader) integer(key string, def, min int) int {
+	return scalarValue(l, key, def, func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, errors.New("want an integer")
+		}
+		return n, checkMin(int64(n), int64(min))
+	}, strconv.Itoa)
+}
+
+func (l *loader) int64(key string, def, min int64) int64 {
+	return scalarValue(l, key, def, func(s string) (int64, error) {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, errors.New("want an integer")
+		}
+		return n, checkMin(n, min)
+	}, func(n int64) string { return strconv.FormatInt(n, 10) })
+}
+
+func (l *loader) duration(key string, def, min time.Duration) time.Duration {
+	return scalarValue(l, key, def, func(s string) (time.Duration, error) {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, errors.New("want a duration such as 90s, 10m or 24h")
+		}
+		return d, checkMin(int64(d), int64(min))
+	}, time.Duration.String)
+}
+
+func checkMin(n, min int64) error {
+	switch {
+	case n >= min:
+		return nil
+	case min == 0:
+		return errors.New("must not be negative")
+	case min == 1:
+		return errors.New("must be positive")
+	default:
+		return fmt.Errorf("must be at least %d", min)
+	}
+}
+
+// args reads a command line: a string split like a shell would (quotes and
+// backslash escapes), or a list of strings.
+func (l *loader) args(key string) []string {
+	r, ok := l.lookup(key)
+	if !ok {
+		l.note(key, "", "default")
+		return nil
+	}
+	var out []string
+	switch v := r.v.(type) {
+	case string:
+		words, err := util.SplitWords(v)
+		if err != nil {
+			l.fail(r, "%v", err)
+			return nil
+		}
+		out = words
+	case []any:
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				l.fail(r, "want a list of strings")
+				return nil
+			}
+			out = append(out, s)
+		}
+	default:
+		l.fail(r, "want a command line string or a list of strings")
+		return nil
+	}
+	l.note(key, strings.Join(out, " "), r.src)
+	return out
+}
+
+// ids reads a list of Telegram ids: comma-separated, or a list of integers.
+// ok is false when key is not set at all.
+func (l *loader) ids(key string) (ids map[int64]struct{}, ok bool) {
+	r, ok := l.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	var err error
+	switch v := r.v.(type) {
+	case string:
+		ids, err = parseAllowlist(v)
+	case int64:
+		ids = map[int64]struct{}{v: {}}
+	case []any:
+		ids, err = parseIDList(v)
+	default:
+		err = errors.New("want a list of ids")
+	}
+	if err != nil {
+		l.fail(r, "%v", err)
+		return nil, true
+	}
+	l.note(key, formatIDs(ids), r.src)
+	return ids, true
+}
+
+func parseIDList(v []any) (map[int64]struct{}, error) {
+	out := make(map[int64]struct{})
+	for _, e := range v {
+		switch id := e.(type) {
+		case int64:
+			out[id] = struct{}{}
+		case string:
+			n, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad id %q", id)
+			}
+			out[n] = struct{}{}
+		default:
+			return nil, fmt.Errorf("bad id %v", e)
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("empty allowlist")
+	}
+	return out, nil
+}
+
+func sortedIDs(ids map[int64]struct{}) []int64 {
+	list := make([]int64, 0, len(ids))
+	for id := range ids {
+		list = append(list, id)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+func formatIDs(ids map[int64]struct{}) string {
+	list := sortedIDs(ids)
+	parts := make([]string, len(list))
+	for i, id := range list {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
 }
 
 func parseAllowlist(s string) (map[int64]struct{}, error) {
@@ -133,62 +717,52 @@ func parseAllowlist(s string) (map[int64]struct{}, error) {
 	return out, nil
 }
 
-func envDuration(key string, def time.Duration) time.Duration {
-	s := strings.TrimSpace(os.Getenv(key))
-	if s == "" {
-		return def
-	}
-	d, err := time.ParseDuration(s)
-	if err != nil {
-		return def
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "true", "yes", "y", "on":
+		return true, nil
+	case "0", "false", "no", "n", "off":
+		return false, nil
 	}
-	return d
+	return false, errors.New("want a boolean (true/false, 1/0, yes/no, on/off)")
 }
 
-func envInt(key string, def int) int {
-	s := strings.TrimSpace(os.Getenv(key))
-	if s == "" {
-		return def
+// Describe lists the effective settings and their sources, secrets redacted,
+// followed by what each [chat.<id>]/[project.<name>] section changes.
+func (c Config) Describe() string {
+	var b strings.Builder
+	file := c.ConfigFile
+	if file == "" {
+		file = "(none; environment only)"
 	}
-	n, err := strconv.Atoi(s)
-	if err != nil || n <= 0 {
-		return def
-	}
-	return n
-}
+	fmt.Fprintf(&b, "config file: %s\n\n", file)
+	writeSettings(&b, c.settings)
 
-func envInt64(key string, def int64) int64 {
-	s := strings.TrimSpace(os.Getenv(key))
-	if s == "" {
-		return def
+	ids := make([]int64, 0, len(c.chats))
+	for id := range c.chats {
+		ids = append(ids, id)
 	}
-	n, err := strconv.ParseInt(s, 10, 64)
-	if err != nil || n <= 0 {
-		return def
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		fmt.Fprintf(&b, "\n[chat %d]\n", id)
+		writeSettings(&b, c.chats[id].settings)
 	}
-	return n
+	return b.String()
 }
 
-func envBool(key string, def bool) bool {
-	s := strings.TrimSpace(os.Getenv(key))
-	if s == "" {
-		return def
-	}
-	switch strings.ToLower(s) {
-	case "1", "true", "yes", "y", "on":
-		return true
-	case "0", "false", "no", "n", "off":
-		return false
-	default:
-		return def
+func writeSettings(b *strings.Builder, ss []Setting) {
+	width := 0
+	for _, s := range ss {
+		width = max(width, len(s.Key))
 	}
-}
-
-func splitArgs(s string) []string {
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return nil
+	for _, s := range ss {
+		v := s.Value
+		switch {
+		case v == "":
+			v = `""`
+		case s.Secret:
+			v = "<redacted>"
+		}
+		fmt.Fprintf(b, "%-*s = %s  # %s\n", width, s.Key, v, s.Source)
 	}
-	// Simple split: space-separated; if you need quoting, wrap a tiny shell script as CODEX_CMD.
-	return strings.Fields(s)
 }
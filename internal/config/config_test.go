@@ -0,0 +1,258 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every variable Load reads, so tests see only what they set.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, k := range keys {
+		t.Setenv(k.env, "")
+	}
+	for _, k := range []string{"ADAPTER_CMD", "ADAPTER_ARGS", "CODEX_BIN", "MYBOT_CONFIG"} {
+		t.Setenv(k, "")
+	}
+}
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "mybot.toml")
+	if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+const sampleConfig = `# mybot config
+workdir = "/srv/main"
+
+[telegram]
+bot_token = "123:secret"
+allowlist = [111, -100222, 333]
+group_trigger = "mention"
+
+[codex]
+args = ["--model", "o3", "-c", 'model_reasoning_effort="high"']
+driver = "exec"
+enable_search = true
+
+[memory]
+turn_threshold = 10
+
+[uploads]
+retention = "72h"
+quota_bytes = 0
+
+[project.blog]
+chats = [
+  -100222, # team group
+  333,
+]
+workdir = "/srv/blog"
+long_reply_format = "html"
+
+[chat."-100222"]
+group_trigger = "all"
+`
+
+func TestLoadFile(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("MEMORY_TURN_THRESHOLD", "25") // env wins over the file
+	cfg, err := LoadFile(writeConfig(t, sampleConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TelegramToken != "123:secret" || len(cfg.Allowlist) != 3 {
+		t.Fatalf("telegram: %+v", cfg)
+	}
+	if got := strings.Join(cfg.CodexArgs, "|"); got != `--model|o3|-c|model_reasoning_effort="high"` {
+		t.Fatalf("args = %s", got)
+	}
+	if cfg.CodexDriver != "exec" || !cfg.CodexEnableSearch || !cfg.CodexSkipGitRepoCheck || !cfg.MemoryEnable {
+		t.Fatalf("codex: %+v", cfg)
+	}
+	if cfg.MemoryTurnThreshold != 25 || cfg.MemoryTokenThreshold != 60000 {
+		t.Fatalf("memory thresholds = %d/%d", cfg.MemoryTurnThreshold, cfg.MemoryTokenThreshold)
+	}
+	if cfg.UploadRetention != 72*time.Hour || cfg.UploadQuotaBytes != 0 {
+		t.Fatalf("uploads: %v %d", cfg.UploadRetention, cfg.UploadQuotaBytes)
+	}
+
+	if c := cfg.ForChat(111); c.WorkDir != "/srv/main" || c.GroupTrigger != "mention" || c.LongReplyFormat != "md" {
+		t.Fatalf("chat without section: %+v", c)
+	}
+	if c := cfg.ForChat(333); c.WorkDir != "/srv/blog" || c.GroupTrigger != "mention" || c.LongReplyFormat != "html" {
+		t.Fatalf("project chat: %+v", c)
+	}
+	c := cfg.ForChat(-100222)
+	if c.WorkDir != "/srv/blog" || c.GroupTrigger != "all" || c.LongReplyFormat != "html" {
+		t.Fatalf("chat section over project: %+v", c)
+	}
+	if c.ForChat(-100222).GroupTrigger != "all" || c.ForChat(111).GroupTrigger != "mention" {
+		t.Fatal("ForChat on a chat config")
+	}
+}
+
+func TestLoadFile_EnvOnly(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	t.Setenv("TELEGRAM_ALLOWLIST", "1, 2")
+	t.Setenv("CODEX_CMD", "/usr/local/bin/other-cli")
+	t.Chdir(t.TempDir()) // no mybot.toml here
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ConfigFile != "" || len(cfg.Allowlist) != 2 || cfg.ForChat(1).WorkDir != cfg.WorkDir {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+	if cfg.CodexDriver != "interactive" || cfg.CodexSkipGitRepoCheck {
+		t.Fatalf("non-codex defaults: driver=%s skip=%v", cfg.CodexDriver, cfg.CodexSkipGitRepoCheck)
+	}
+	if cfg.MaxUploadBytes != 20*1024*1024 || cfg.UploadQuotaBytes != 500*1024*1024 {
+		t.Fatalf("upload defaults: max=%d quota=%d", cfg.MaxUploadBytes, cfg.UploadQuotaBytes)
+	}
+
+	// A local Bot API server raises the size limit and drops the default quota.
+	t.Setenv("TELEGRAM_API_URL", "http://127.0.0.1:8081")
+	if cfg, err = Load(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxUploadBytes != 2000*1024*1024 || cfg.UploadQuotaBytes != 0 {
+		t.Fatalf("local server upload defaults: max=%d quota=%d", cfg.MaxUploadBytes, cfg.UploadQuotaBytes)
+	}
+}
+
+func TestLoadFile_QuotedArgs(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("TELEGRAM_BOT_TOKEN", "tok")
+	t.Setenv("TELEGRAM_ALLOWLIST", "1")
+	t.Setenv("CODEX_ARGS", `-c model_reasoning_effort="high" -c 'model="o3"'`)
+	t.Setenv("STT_CMD", `"/opt/whisper cli/run" -f {file}`)
+	cfg, err := LoadFile(writeConfig(t, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(cfg.CodexArgs, "|"); got != `-c|model_reasoning_effort=high|-c|model="o3"` {
+		t.Fatalf("CODEX_ARGS = %s", got)
+	}
+	if got := strings.Join(cfg.STTCmd, "|"); got != "/opt/whisper cli/run|-f|{file}" {
+		t.Fatalf("STT_CMD = %s", got)
+	}
+
+	t.Setenv("CODEX_ARGS", `-c "open`)
+	t.Setenv("ADAPTER_ARGS", `it's`)
+	_, err = LoadFile(writeConfig(t, ""))
+	if err == nil || !strings.Contains(err.Error(), `CODEX_ARGS="-c \"open": unterminated " quote`) ||
+		!strings.Contains(err.Error(), `ADAPTER_ARGS="it's": unterminated ' quote`) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestLoadFile_Errors(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DOWNLOAD_RETRIES", "many")
+	t.Setenv("MAX_CHUNK_BYTES", "0")
+	path := writeConfig(t, `[telegram]
+bot_token = "x"
+allowlist = [1, 2]
+hide_status = "sometimes"
+
+[codex]
+driver = "tty"
+flavor = "mild"
+
+[output]
+flush_interval = "soon"
+
+[chat."3"]
+workdir = "/tmp"
+
+[chat."2"]
+metrics_addr = ":9090"
+
+[project.docs]
+workdir = "/srv/docs"
+`)
+	_, err := LoadFile(path)
+	if err == nil {
+		t.Fatal("want errors")
+	}
+	got := err.Error()
+	for _, want := range []string{
+		path + `:4: telegram.hide_status = "sometimes": want a boolean`,
+		path + `:7: codex.driver = "tty": want one of exec|interactive`,
+		path + `:8: unknown key codex.flavor`,
+		path + `:11: output.flush_interval = "soon": want a duration`,
+		path + `:14: [chat.3]: chat is not in TELEGRAM_ALLOWLIST`,
+		path + `:17: metrics_addr is not a per-chat setting`,
+		path + `: [project.docs] needs chats = [<chat_id>, ...]`,
+		`DOWNLOAD_RETRIES="many": want an integer`,
+		`MAX_CHUNK_BYTES="0": must be positive`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestParseFile_Syntax(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"a = 1\na = 2\n", "f:2: a is already set on line 1"},
+		{"a = \"open\n", "f:1: unterminated string"},
+		{"a = 1.5\n", `f:1: a: unsupported value "1.5"`},
+		{"a = bare\n", `f:1: a: unsupported value "bare"`},
+		{"a = [1, 2\n", "f:1: a: unterminated array"},
+		{"[[x]]\n", "f:1: arrays of tables are not supported"},
+		{"a = 1 2\n", `f:1: a: unexpected "2" after value`},
+		{"just text\n", `f:1: expected key = value`},
+	} {
+		_, err := parseFile("f", tc.in)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("parseFile(%q) = %v, want %q", tc.in, err, tc.want)
+		}
+	}
+
+	f, err := parseFile("f", "s = \"a#b \\\"q\\\" \\u00e9\" # c\nl = 'C:\\dir'\n[x.\"y.z\"]\nn = -1_000\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := f.values["s"].v; v != `a#b "q" é` {
+		t.Fatalf("s = %q", v)
+	}
+	if v := f.values["l"].v; v != `C:\dir` {
+		t.Fatalf("l = %q", v)
+	}
+	if v := f.values["x.y.z.n"].v; v != int64(-1000) {
+		t.Fatalf("n = %v", v)
+	}
+}
+
+func TestDescribe_RedactsSecrets(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("TELEGRAM_BOT_TOKEN", "123:very-secret")
+	cfg, err := LoadFile(writeConfig(t, sampleConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := cfg.Describe()
+	if strings.Contains(out, "very-secret") || !strings.Contains(out, "<redacted>  # env") {
+		t.Fatalf("token not redacted:\n%s", out)
+	}
+	for _, want := range []string{
+		"MEMORY_TURN_THRESHOLD",
+		"# " + cfg.ConfigFile + ":15",
+		"LOG_DIR                   = logs  # default",
+		"[chat -100222]",
+		"TELEGRAM_GROUP_TRIGGER = all  # " + cfg.ConfigFile + ":30",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
@@ -2,65 +2,165 @@ package config
 
 import (
 	"bufio"
+	"maps"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+)
+
+// DotEnvFile is the .env file mybot reads from its working directory.
+const DotEnvFile = ".env"
+
+var (
+	dotenvMu sync.Mutex
+	// dotenvSet maps each variable the applied .env set to the value it had
+	// before (nil: unset), so the next ApplyDotEnv can put it back.
+	dotenvSet = map[string]*string{}
+	// dotenvApplied is the .env last applied, including entries the real
+	// environment won over.
+	dotenvApplied = map[string]string{}
 )
 
 // LoadDotEnv loads KEY=VALUE pairs from a .env file into the process environment.
 // It does not override already-set environment variables.
 // This is intentionally minimal to avoid extra deps.
 func LoadDotEnv(path string) error {
+	env, err := ReadDotEnv(path)
+	if err != nil {
+		return err
+	}
+	ApplyDotEnv(Config{DotEnv: env})
+	return nil
+}
+
+// ReadDotEnv parses a .env file ("" = .env) without touching the process
+// environment. A missing file has no entries.
+func ReadDotEnv(path string) (map[string]string, error) {
 	if strings.TrimSpace(path) == "" {
-		path = ".env"
+		path = DotEnvFile
 	}
-	override := envBool("DOTENV_OVERRIDE", false)
+	env := map[string]string{}
 	f, err := os.Open(filepath.Clean(path))
 	if err != nil {
 		// Missing .env is fine.
 		if os.IsNotExist(err) {
-			return nil
+			return env, nil
 		}
-		return err
+		return nil, err
 	}
 	defer f.Close()
 
 	sc := bufio.NewScanner(f)
 	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 	for sc.Scan() {
-		line := strings.TrimSpace(sc.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		if strings.HasPrefix(line, "export ") {
-			line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		if k, v, ok := parseEnvLine(sc.Text()); ok {
+			env[k] = v
 		}
-		k, v, ok := strings.Cut(line, "=")
-		if !ok {
-			continue
-		}
-		k = strings.TrimSpace(k)
-		if k == "" {
-			continue
-		}
-		// Respect existing env unless override is enabled.
-		if !override {
-			if _, exists := os.LookupEnv(k); exists {
-				continue
-			}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// LoadWithDotEnv is Load as it would be once env were applied, leaving the
+// process environment alone; a reload applies env with ApplyDotEnv only after
+// the config is accepted.
+func LoadWithDotEnv(env map[string]string) (Config, error) {
+	getenv := func(key string) string {
+		dotenvMu.Lock()
+		defer dotenvMu.Unlock()
+		v, _ := dotenvLookupLocked(env, key)
+		return v
+	}
+	return loadFile(getenv("MYBOT_CONFIG"), getenv, env)
+}
+
+// ApplyDotEnv puts cfg.DotEnv into the process environment in place of the
+// .env applied before: variables it set are restored to their earlier value
+// or unset, so edited and removed entries take effect. Variables from the
+// real environment win unless DOTENV_OVERRIDE is set, and keep their value
+// for when the .env no longer overrides them.
+func ApplyDotEnv(cfg Config) {
+	dotenvMu.Lock()
+	defer dotenvMu.Unlock()
+	for k, was := range dotenvSet {
+		if was != nil {
+			_ = os.Setenv(k, *was)
 		} else {
-			// Allow overriding existing value.
 			_ = os.Unsetenv(k)
 		}
-		if _, exists := os.LookupEnv(k); exists && !override {
+		delete(dotenvSet, k)
+	}
+	override := dotenvOverrideLocked()
+	for k, v := range cfg.DotEnv {
+		was, exists := os.LookupEnv(k)
+		if exists && !override {
 			continue
 		}
-		v = strings.TrimSpace(v)
-		v = stripInlineComment(v)
-		v = trimQuotes(v)
+		if exists {
+			dotenvSet[k] = &was
+		} else {
+			dotenvSet[k] = nil
+		}
 		_ = os.Setenv(k, v)
 	}
-	return sc.Err()
+	dotenvApplied = maps.Clone(cfg.DotEnv)
+}
+
+// appliedDotEnv returns the .env last applied, for configs loaded from the
+// process environment.
+func appliedDotEnv() map[string]string {
+	dotenvMu.Lock()
+	defer dotenvMu.Unlock()
+	return maps.Clone(dotenvApplied)
+}
+
+// realEnvLocked looks key up in the environment as it was before any .env
+// was applied.
+func realEnvLocked(key string) (string, bool) {
+	if was, ok := dotenvSet[key]; ok {
+		if was == nil {
+			return "", false
+		}
+		return *was, true
+	}
+	return os.LookupEnv(key)
+}
+
+func dotenvOverrideLocked() bool {
+	v, _ := realEnvLocked("DOTENV_OVERRIDE")
+	override, _ := parseBool(v)
+	return override
+}
+
+// dotenvLookupLocked looks key up in the environment ApplyDotEnv would make
+// from env.
+func dotenvLookupLocked(env map[string]string, key string) (string, bool) {
+	rv, exists := realEnvLocked(key)
+	if v, ok := env[key]; ok && (!exists || dotenvOverrideLocked()) {
+		return v, true
+	}
+	return rv, exists
+}
+
+// parseEnvLine parses one KEY=VALUE line of a .env-style file; blank lines,
+// comments and lines without "=" give ok == false.
+func parseEnvLine(line string) (k, v string, ok bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	if strings.HasPrefix(line, "export ") {
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+	}
+	k, v, ok = strings.Cut(line, "=")
+	k = strings.TrimSpace(k)
+	if !ok || k == "" {
+		return "", "", false
+	}
+	return k, trimQuotes(stripInlineComment(strings.TrimSpace(v))), true
 }
 
 func stripInlineComment(v string) string {
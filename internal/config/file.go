@@ -0,0 +1,332 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The config file is a small subset of TOML: [table] headers (dotted, with
+// quoted parts such as [chat."-100123"]), key = value pairs, basic and literal
+// strings, integers, booleans, (multi-line) arrays of those, and # comments.
+// That covers every setting without pulling in a dependency.
+
+type fileValue struct {
+	v    any // string, int64, bool or []any
+	line int
+}
+
+type fileConfig struct {
+	path   string
+	values map[string]fileValue // dotted key -> value
+	keys   []string             // in file order
+}
+
+func readFile(path string) (*fileConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseFile(path, string(b))
+}
+
+// at formats a position for error messages, e.g. "mybot.toml:12".
+func (f *fileConfig) at(line int) string {
+	return fmt.Sprintf("%s:%d", f.path, line)
+}
+
+func parseFile(path, data string) (*fileConfig, error) {
+	f := &fileConfig{path: path, values: map[string]fileValue{}}
+	data = strings.TrimPrefix(data, "\ufeff")
+	if !utf8.ValidString(data) {
+		return nil, fmt.Errorf("%s: not valid UTF-8", path)
+	}
+	lines := strings.Split(data, "\n")
+	var table []string
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line, err := stripComment(lines[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.at(lineNo), err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("%s: arrays of tables are not supported", f.at(lineNo))
+			}
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%s: table header must end with ]", f.at(lineNo))
+			}
+			table, err = parseKey(line[1 : len(line)-1])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.at(lineNo), err)
+			}
+			continue
+		}
+
+		k, v, ok := cutKey(line)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected key = value, got %q", f.at(lineNo), line)
+		}
+		key, err := parseKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.at(lineNo), err)
+		}
+		// Arrays may span lines until their brackets balance.
+		for strings.HasPrefix(v, "[") && !balanced(v) && i+1 < len(lines) {
+			i++
+			next, err := stripComment(lines[i])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.at(i+1), err)
+			}
+			v += "\n" + next
+		}
+		val, rest, err := parseValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", f.at(lineNo), strings.Join(key, "."), err)
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("%s: %s: unexpected %q after value", f.at(lineNo), strings.Join(key, "."), strings.TrimSpace(rest))
+		}
+		full := strings.Join(append(append([]string{}, table...), key...), ".")
+		if prev, dup := f.values[full]; dup {
+			return nil, fmt.Errorf("%s: %s is already set on line %d", f.at(lineNo), full, prev.line)
+		}
+		f.values[full] = fileValue{v: val, line: lineNo}
+		f.keys = append(f.keys, full)
+	}
+	return f, nil
+}
+
+// cutKey splits "key = value" at the first = outside quotes.
+func cutKey(line string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// parseKey splits a dotted key; parts are bare (A-Za-z0-9_-) or quoted.
+func parseKey(s string) ([]string, error) {
+	var parts []string
+	s = strings.TrimSpace(s)
+	for {
+		if s == "" {
+			return nil, errors.New("empty key")
+		}
+		var part string
+		if s[0] == '"' || s[0] == '\'' {
+			v, rest, err := parseString(s)
+			if err != nil {
+				return nil, err
+			}
+			part, s = v, rest
+		} else {
+			n := 0
+			for n < len(s) && isBareKeyChar(s[n]) {
+				n++
+			}
+			if n == 0 {
+				return nil, fmt.Errorf("invalid character %q in key", s[0])
+			}
+			part, s = s[:n], s[n:]
+		}
+		parts = append(parts, part)
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return parts, nil
+		}
+		if s[0] != '.' {
+			return nil, fmt.Errorf("invalid character %q in key", s[0])
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// stripComment drops a trailing # comment that is not inside a string.
+func stripComment(line string) (string, error) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i], nil
+		}
+	}
+	if quote != 0 {
+		return "", errors.New("unterminated string")
+	}
+	return line, nil
+}
+
+// balanced reports whether every [ in s is closed (strings aside).
+func balanced(s string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+func parseValue(s string) (any, string, error) {
+	s = strings.TrimLeft(s, " \t\r\n")
+	if s == "" {
+		return nil, "", errors.New("missing value")
+	}
+	switch c := s[0]; {
+	case c == '"' || c == '\'':
+		return parseString(s)
+	case c == '[':
+		return parseArray(s)
+	case strings.HasPrefix(s, "true") && !continuesWord(s[4:]):
+		return true, s[4:], nil
+	case strings.HasPrefix(s, "false") && !continuesWord(s[5:]):
+		return false, s[5:], nil
+	case c == '+' || c == '-' || c >= '0' && c <= '9':
+		n := 1
+		for n < len(s) && (s[n] >= '0' && s[n] <= '9' || s[n] == '_') {
+			n++
+		}
+		if continuesWord(s[n:]) || n < len(s) && s[n] == '.' {
+			return nil, "", fmt.Errorf("unsupported value %q (quote strings and durations)", firstWord(s))
+		}
+		v, err := strconv.ParseInt(strings.ReplaceAll(s[:n], "_", ""), 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("bad integer %q", s[:n])
+		}
+		return v, s[n:], nil
+	default:
+		return nil, "", fmt.Errorf("unsupported value %q (quote strings and durations)", firstWord(s))
+	}
+}
+
+func continuesWord(s string) bool {
+	return s != "" && (isBareKeyChar(s[0]) || s[0] == '.' || s[0] == ':')
+}
+
+func firstWord(s string) string {
+	if i := strings.IndexAny(s, " \t,]"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+func parseString(s string) (string, string, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), s[i+1:], nil
+		case c == '\n':
+			return "", "", errors.New("newline in string")
+		case c == '\\' && quote == '"':
+			if i+1 >= len(s) {
+				return "", "", errors.New("unterminated string")
+			}
+			i++
+			switch s[i] {
+			case '"', '\\':
+				b.WriteByte(s[i])
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'u':
+				if i+4 >= len(s) {
+					return "", "", errors.New(`bad \u escape`)
+				}
+				r, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+				if err != nil {
+					return "", "", fmt.Errorf(`bad \u escape %q`, s[i+1:i+5])
+				}
+				b.WriteRune(rune(r))
+				i += 4
+			default:
+				return "", "", fmt.Errorf(`unknown escape \%c`, s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", errors.New("unterminated string")
+}
+
+func parseArray(s string) ([]any, string, error) {
+	out := []any{}
+	s = s[1:]
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			return nil, "", errors.New("unterminated array")
+		}
+		if s[0] == ']' {
+			return out, s[1:], nil
+		}
+		v, rest, err := parseValue(s)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, nested := v.([]any); nested {
+			return nil, "", errors.New("nested arrays are not supported")
+		}
+		out = append(out, v)
+		s = strings.TrimLeft(rest, " \t\r\n")
+		switch {
+		case s == "":
+			return nil, "", errors.New("unterminated array")
+		case strings.HasPrefix(s, ","):
+			s = s[1:]
+		case strings.HasPrefix(s, "]"):
+		default:
+			return nil, "", errors.New("expected , or ] in array")
+		}
+	}
+}
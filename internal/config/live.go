@@ -0,0 +1,226 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Live holds the config of a running bot. Reload re-reads the configuration
+// and swaps it in atomically; long-running loops call Get for each unit of
+// work, so work already in flight keeps the config it started with.
+type Live struct {
+	mu  sync.RWMutex
+	cfg Config
+
+	reloadMu sync.Mutex
+	load     func() (Config, error)
+	hooks    []func(Config)
+}
+
+// NewLive returns a Live starting at cfg; load produces the config on Reload.
+func NewLive(cfg Config, load func() (Config, error)) *Live {
+	return &Live{cfg: cfg, load: load}
+}
+
+func (l *Live) Get() Config {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.cfg
+}
+
+// OnReload registers f to be called with the new config after each successful reload.
+func (l *Live) OnReload(f func(Config)) {
+	l.reloadMu.Lock()
+	defer l.reloadMu.Unlock()
+	l.hooks = append(l.hooks, f)
+}
+
+// Reload loads the config again and applies it. An invalid config is rejected
+// and the current one kept. Settings in restartKeys keep their running value.
+// The result lists what changed, one line per setting.
+func (l *Live) Reload() ([]string, error) {
+	l.reloadMu.Lock()
+	defer l.reloadMu.Unlock()
+	next, err := l.load()
+	if err != nil {
+		return nil, err
+	}
+	old := l.Get()
+	pending := keepRunning(old, &next)
+	changes := Changes(old, next)
+
+	l.mu.Lock()
+	l.cfg = next
+	l.mu.Unlock()
+	for _, f := range l.hooks {
+		f(next)
+	}
+	return append(changes, pending...), nil
+}
+
+// restartKeys configure things built once at startup (the Telegram client,
+// the codex command line, log paths and the metrics listener); a reload
+// reports their changes but only a restart applies them.
+var restartKeys = []string{
+	"TELEGRAM_BOT_TOKEN", "TELEGRAM_API_URL", "TELEGRAM_API_LOCAL", "TELEGRAM_SET_COMMANDS",
+	"CODEX_CMD", "CODEX_ARGS", "CODEX_DRIVER", "CODEX_SKIP_GIT_REPO_CHECK", "CODEX_ENABLE_SEARCH",
+	"LOG_DIR", "METRICS_ADDR",
+}
+
+// keepRunning copies the running value of every changed restart-only setting
+// into next and returns a note for each.
+func keepRunning(old Config, next *Config) []string {
+	var notes []string
+	for _, k := range restartKeys {
+		was, had := old.setting(k)
+		now, has := next.setting(k)
+		if was.Value == now.Value {
+			continue
+		}
+		var a, b []Setting
+		if had {
+			a = []Setting{was}
+		}
+		if has {
+			b = []Setting{now}
+		}
+		for _, line := range diffSettings("", a, b) {
+			notes = append(notes, line+" (takes effect after a restart)")
+		}
+		carry(k, old, next)
+		for id, c := range next.chats {
+			carry(k, old, &c)
+			next.chats[id] = c
+		}
+		for i := range next.settings {
+			if next.settings[i].Key == k {
+				next.settings[i] = was
+			}
+		}
+	}
+	next.link()
+	return notes
+}
+
+func carry(key string, from Config, to *Config) {
+	switch key {
+	case "TELEGRAM_BOT_TOKEN":
+		to.TelegramToken = from.TelegramToken
+	case "TELEGRAM_API_URL":
+		to.BotAPIURL = from.BotAPIURL
+	case "TELEGRAM_API_LOCAL":
+		to.BotAPILocal = from.BotAPILocal
+	case "TELEGRAM_SET_COMMANDS":
+		to.SetCommands = from.SetCommands
+	case "CODEX_CMD":
+		to.CodexCmd = from.CodexCmd
+	case "CODEX_ARGS":
+		to.CodexArgs = from.CodexArgs
+	case "CODEX_DRIVER":
+		to.CodexDriver = from.CodexDriver
+	case "CODEX_SKIP_GIT_REPO_CHECK":
+		to.CodexSkipGitRepoCheck = from.CodexSkipGitRepoCheck
+	case "CODEX_ENABLE_SEARCH":
+		to.CodexEnableSearch = from.CodexEnableSearch
+	case "LOG_DIR":
+		to.LogDir = from.LogDir
+	case "METRICS_ADDR":
+		to.MetricsAddr = from.MetricsAddr
+	}
+}
+
+func (c Config) setting(key string) (Setting, bool) {
+	for _, s := range c.settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{Key: key}, false
+}
+
+// Changes lists the settings that differ between old and next, including
+// per-chat sections, with secrets redacted. Sources are not compared.
+func Changes(old, next Config) []string {
+	var out []string
+	if old.ConfigFile != next.ConfigFile {
+		out = append(out, fmt.Sprintf("config file: %s → %s", orNone(old.ConfigFile), orNone(next.ConfigFile)))
+	}
+	out = append(out, diffSettings("", old.settings, next.settings)...)
+
+	ids := map[int64]struct{}{}
+	for id := range old.chats {
+		ids[id] = struct{}{}
+	}
+	for id := range next.chats {
+		ids[id] = struct{}{}
+	}
+	for _, id := range sortedIDs(ids) {
+		o, had := old.chats[id]
+		n, has := next.chats[id]
+		prefix := fmt.Sprintf("[chat %d] ", id)
+		switch {
+		case !had:
+			out = append(out, prefix+"section added")
+		case !has:
+			out = append(out, prefix+"section removed")
+		}
+		out = append(out, diffSettings(prefix, o.settings, n.settings)...)
+	}
+	return out
+}
+
+func diffSettings(prefix string, old, next []Setting) []string {
+	secret := map[string]bool{}
+	values := func(ss []Setting) map[string]string {
+		m := map[string]string{}
+		for _, s := range ss {
+			m[s.Key] = s.Value
+			secret[s.Key] = secret[s.Key] || s.Secret
+		}
+		return m
+	}
+	a, b := values(old), values(next)
+	var names []string
+	for k := range a {
+		names = append(names, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	var out []string
+	for _, k := range names {
+		was, had := a[k]
+		now, has := b[k]
+		switch {
+		case was == now && had == has:
+		case secret[k]:
+			out = append(out, prefix+k+" changed")
+		case !had:
+			out = append(out, fmt.Sprintf("%s%s = %s (new)", prefix, k, showValue(now)))
+		case !has:
+			out = append(out, fmt.Sprintf("%s%s unset (was %s)", prefix, k, showValue(was)))
+		default:
+			out = append(out, fmt.Sprintf("%s%s: %s → %s", prefix, k, showValue(was), showValue(now)))
+		}
+	}
+	return out
+}
+
+func showValue(v string) string {
+	if v == "" {
+		return `""`
+	}
+	return v
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
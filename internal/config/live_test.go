@@ -0,0 +1,157 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLive_Reload(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, `[telegram]
+bot_token = "tok-1"
+allowlist = [1]
+
+[codex]
+args = ["--model", "a"]
+
+[memory]
+turn_threshold = 40
+`)
+	load := func() (Config, error) { return LoadFile(path) }
+	cfg, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := NewLive(cfg, load)
+	var hooked Config
+	live.OnReload(func(c Config) { hooked = c })
+
+	if changes, err := live.Reload(); err != nil || len(changes) != 0 {
+		t.Fatalf("unchanged reload: %v %v", changes, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`[telegram]
+bot_token = "tok-2"
+allowlist = [1, 2]
+
+[codex]
+args = ["--model", "b"]
+
+[memory]
+turn_threshold = 10
+
+[chat."2"]
+group_trigger = "all"
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := live.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"MEMORY_TURN_THRESHOLD: 40 → 10",
+		"TELEGRAM_ALLOWLIST: 1 → 1,2",
+		"[chat 2] section added",
+		"[chat 2] TELEGRAM_GROUP_TRIGGER = all (new)",
+		"TELEGRAM_BOT_TOKEN changed (takes effect after a restart)",
+		"CODEX_ARGS: --model a → --model b (takes effect after a restart)",
+	}
+	if !slices.Equal(changes, want) {
+		t.Fatalf("changes:\n%s\nwant:\n%s", strings.Join(changes, "\n"), strings.Join(want, "\n"))
+	}
+	got := live.Get()
+	if got.MemoryTurnThreshold != 10 || len(got.Allowlist) != 2 || got.ForChat(2).GroupTrigger != "all" {
+		t.Fatalf("live settings not applied: %+v", got)
+	}
+	if got.TelegramToken != "tok-1" || strings.Join(got.ForChat(2).CodexArgs, " ") != "--model a" {
+		t.Fatalf("restart-only settings changed: %q %v", got.TelegramToken, got.ForChat(2).CodexArgs)
+	}
+	if hooked.MemoryTurnThreshold != 10 {
+		t.Fatal("reload hook not called")
+	}
+
+	// An invalid config is rejected and the running one kept.
+	if err := os.WriteFile(path, []byte("[telegram]\nallowlist = [1]\nhide_status = \"maybe\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := live.Reload(); err == nil || !strings.Contains(err.Error(), "hide_status") {
+		t.Fatalf("invalid reload: %v", err)
+	}
+	if live.Get().MemoryTurnThreshold != 10 {
+		t.Fatal("config replaced by an invalid one")
+	}
+}
+
+func TestReloadDotEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DOTENV_OVERRIDE", "")
+	t.Setenv("MYBOT_TEST_KEEP", "shell")
+	t.Setenv("MYBOT_TEST_A", "")
+	t.Setenv("MYBOT_TEST_B", "")
+	os.Unsetenv("MYBOT_TEST_A")
+	os.Unsetenv("MYBOT_TEST_B")
+	os.Unsetenv("TELEGRAM_BOT_TOKEN")
+	os.Unsetenv("TELEGRAM_ALLOWLIST")
+	os.Unsetenv("TELEGRAM_HIDE_STATUS")
+	t.Cleanup(func() { ApplyDotEnv(Config{}) })
+	p := filepath.Join(t.TempDir(), ".env")
+
+	if err := os.WriteFile(p, []byte("MYBOT_TEST_A=1\nMYBOT_TEST_B=1\nMYBOT_TEST_KEEP=file\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadDotEnv(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte("MYBOT_TEST_A=2\nMYBOT_TEST_KEEP=file\n"+
+		"TELEGRAM_BOT_TOKEN=123:abc\nTELEGRAM_ALLOWLIST=1\nTELEGRAM_HIDE_STATUS=maybe\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	env, err := ReadDotEnv(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Loading validates without touching the environment.
+	if _, err := LoadWithDotEnv(env); err == nil || !strings.Contains(err.Error(), "TELEGRAM_HIDE_STATUS") {
+		t.Fatalf("invalid .env: %v", err)
+	}
+	if v := os.Getenv("MYBOT_TEST_A"); v != "1" {
+		t.Fatalf("A = %q before the config was accepted", v)
+	}
+
+	delete(env, "TELEGRAM_HIDE_STATUS")
+	cfg, err := LoadWithDotEnv(env)
+	if err != nil || cfg.TelegramToken != "123:abc" {
+		t.Fatalf("token=%q err=%v", cfg.TelegramToken, err)
+	}
+	ApplyDotEnv(cfg)
+	if v := os.Getenv("MYBOT_TEST_A"); v != "2" {
+		t.Fatalf("A = %q, want the edited value", v)
+	}
+	if _, ok := os.LookupEnv("MYBOT_TEST_B"); ok {
+		t.Fatal("B removed from .env but still set")
+	}
+	if v := os.Getenv("MYBOT_TEST_KEEP"); v != "shell" {
+		t.Fatalf("KEEP = %q, the real environment must win", v)
+	}
+
+	// With DOTENV_OVERRIDE the .env wins, and the shell value comes back
+	// once the entry is gone.
+	t.Setenv("DOTENV_OVERRIDE", "1")
+	ApplyDotEnv(Config{DotEnv: map[string]string{"MYBOT_TEST_KEEP": "file"}})
+	if v := os.Getenv("MYBOT_TEST_KEEP"); v != "file" {
+		t.Fatalf("KEEP = %q with DOTENV_OVERRIDE", v)
+	}
+	cfg, _ = LoadWithDotEnv(map[string]string{"MYBOT_TEST_KEEP": "file2"})
+	ApplyDotEnv(cfg)
+	if v := os.Getenv("MYBOT_TEST_KEEP"); v != "file2" {
+		t.Fatalf("KEEP = %q after an edit", v)
+	}
+	ApplyDotEnv(Config{DotEnv: map[string]string{}})
+	if v := os.Getenv("MYBOT_TEST_KEEP"); v != "shell" {
+		t.Fatalf("KEEP = %q, want the shell value back", v)
+	}
+}
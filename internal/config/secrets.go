@@ -0,0 +1,389 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Secrets can be kept out of .env and the config file:
+//
+//   - TELEGRAM_BOT_TOKEN_FILE names a file holding just the token;
+//   - TOKEN_CMD is a command printing the token (e.g. `pass show mybot`);
+//   - SECRETS_FILE holds KEY=VALUE lines like .env, optionally sealed with
+//     `mybot secrets encrypt` and opened with SECRETS_KEY_FILE or
+//     SECRETS_PASSPHRASE. Config keys found there rank between the
+//     environment and the config file; other keys (provider API keys) go to
+//     Config.SecretEnv.
+//
+// Files holding plaintext secrets must not be accessible by group or others.
+
+// sealedMagic starts the first line of a sealed secrets file, followed by the
+// key derivation: "key" (a 32-byte key file) or "pbkdf2-sha256 <iterations>".
+// The base64 body is [salt (pbkdf2 only)] nonce ciphertext, AES-256-GCM with
+// the first line as additional data.
+//
+// Opening accepts iteration counts from pbkdf2Rounds to pbkdf2MaxRounds only:
+// fewer would let an edited header weaken the derivation a guess costs, more
+// would let it stall startup.
+const (
+	sealedMagic     = "mybot-secrets v1"
+	pbkdf2Rounds    = 600000
+	pbkdf2MaxRounds = 10 * pbkdf2Rounds
+	saltSize        = 16
+)
+
+// tokenCmdTimeout bounds TOKEN_CMD, which may wait on an agent (gpg, pass).
+const tokenCmdTimeout = 30 * time.Second
+
+// NewSecretsKey returns a random key for SECRETS_KEY_FILE, hex-encoded.
+func NewSecretsKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key) + "\n", nil
+}
+
+// ReadSecretsKey reads a key file: 32 bytes, hex or base64 encoded, or raw.
+func ReadSecretsKey(path string) ([]byte, error) {
+	b, err := readPrivate(path)
+	if err != nil {
+		return nil, err
+	}
+	s := strings.TrimSpace(string(b))
+	if k, err := hex.DecodeString(s); err == nil && len(k) == 32 {
+		return k, nil
+	}
+	if k, err := base64.StdEncoding.DecodeString(s); err == nil && len(k) == 32 {
+		return k, nil
+	}
+	if len(b) == 32 {
+		return b, nil
+	}
+	return nil, fmt.Errorf("%s: want a 32-byte key (hex, base64 or raw); create one with `mybot secrets keygen`", path)
+}
+
+// SealSecrets encrypts plain with key (from ReadSecretsKey) or, when key is
+// nil, with a key derived from passphrase.
+func SealSecrets(plain, key []byte, passphrase string) ([]byte, error) {
+	header := sealedMagic + " key"
+	var salt []byte
+	if key == nil {
+		if passphrase == "" {
+			return nil, errors.New("need a key file or a passphrase")
+		}
+		header = fmt.Sprintf("%s pbkdf2-sha256 %d", sealedMagic, pbkdf2Rounds)
+		salt = make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		var err error
+		if key, err = pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Rounds, 32); err != nil {
+			return nil, err
+		}
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	body := append(append(salt, nonce...), aead.Seal(nil, nonce, plain, []byte(header))...)
+
+	var out bytes.Buffer
+	out.WriteString(header + "\n")
+	enc := base64.StdEncoding.EncodeToString(body)
+	for len(enc) > 64 {
+		out.WriteString(enc[:64] + "\n")
+		enc = enc[64:]
+	}
+	out.WriteString(enc + "\n")
+	return out.Bytes(), nil
+}
+
+// OpenSecrets decrypts a file written by SealSecrets. The file says which of
+// key and passphrase it needs.
+func OpenSecrets(data, key []byte, passphrase string) ([]byte, error) {
+	header, body, _ := strings.Cut(string(data), "\n")
+	header = strings.TrimSpace(header)
+	kdf, ok := strings.CutPrefix(header, sealedMagic+" ")
+	if !ok {
+		return nil, errors.New("not a sealed secrets file")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return nil, errors.New("corrupt secrets file")
+	}
+	switch f := strings.Fields(kdf); {
+	case len(f) == 1 && f[0] == "key":
+		if key == nil {
+			return nil, errors.New("sealed with a key file: set SECRETS_KEY_FILE")
+		}
+	case len(f) == 2 && f[0] == "pbkdf2-sha256":
+		rounds, err := strconv.Atoi(f[1])
+		if err != nil || rounds < pbkdf2Rounds || rounds > pbkdf2MaxRounds {
+			return nil, fmt.Errorf("bad key derivation %q: want %d to %d iterations", kdf, pbkdf2Rounds, pbkdf2MaxRounds)
+		}
+		if passphrase == "" {
+			return nil, errors.New("sealed with a passphrase: set SECRETS_PASSPHRASE")
+		}
+		if len(raw) < saltSize {
+			return nil, errors.New("corrupt secrets file")
+		}
+		if key, err = pbkdf2.Key(sha256.New, passphrase, raw[:saltSize], rounds, 32); err != nil {
+			return nil, err
+		}
+		raw = raw[saltSize:]
+	default:
+		return nil, fmt.Errorf("unsupported key derivation %q", kdf)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < aead.NonceSize() {
+		return nil, errors.New("corrupt secrets file")
+	}
+	plain, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], []byte(header))
+	if err != nil {
+		return nil, errors.New("cannot decrypt: wrong key or passphrase, or the file was modified")
+	}
+	return plain, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func isSealed(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(sealedMagic+" "))
+}
+
+// readPrivate reads a file holding secrets, refusing one that group or
+// others may access.
+func readPrivate(path string) ([]byte, error) {
+	if err := checkPrivate(path); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func checkPrivate(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("%s is accessible by group or others (mode %04o); run chmod 600 %s", path, fi.Mode().Perm(), path)
+	}
+	return nil
+}
+
+// loadSecrets reads SECRETS_FILE so that lookup can find its entries. It
+// runs before any other key is looked up.
+func (l *loader) loadSecrets() {
+	path := l.str("SECRETS_FILE", "")
+	keyFile := l.str("SECRETS_KEY_FILE", "")
+	passphrase := l.str("SECRETS_PASSPHRASE", "")
+	if path == "" {
+		return
+	}
+	r, _ := l.lookup("SECRETS_FILE")
+	data, err := os.ReadFile(path)
+	if err == nil && !isSealed(data) {
+		err = checkPrivate(path) // a sealed file may be readable, it is ciphertext
+	}
+	if err != nil {
+		l.fail(r, "%v", err)
+		return
+	}
+	if isSealed(data) {
+		var key []byte
+		if keyFile != "" {
+			if key, err = ReadSecretsKey(keyFile); err != nil {
+				kr, _ := l.lookup("SECRETS_KEY_FILE")
+				l.fail(kr, "%v", err)
+				return
+			}
+		}
+		if data, err = OpenSecrets(data, key, passphrase); err != nil {
+			l.fail(r, "%v", err)
+			return
+		}
+	}
+	l.secrets, l.secretsFile = map[string]string{}, path
+	for _, line := range strings.Split(string(data), "\n") {
+		if k, v, ok := parseEnvLine(line); ok && v != "" {
+			l.secrets[k] = v
+		}
+	}
+}
+
+// secretEnv returns the secrets file's entries that are not config keys.
+func (l *loader) secretEnv() map[string]string {
+	env := map[string]string{}
+	names := make([]string, 0, len(l.secrets))
+	for k := range l.secrets {
+		if _, ok := fileKeyOf[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		env[k] = l.secrets[k]
+		l.noteSecret(k, l.secrets[k], l.secretsFile)
+	}
+	return env
+}
+
+// token reads the bot token from TELEGRAM_BOT_TOKEN (environment, secrets
+// file or config file), TELEGRAM_BOT_TOKEN_FILE or TOKEN_CMD.
+func (l *loader) token() string {
+	tok := l.str("TELEGRAM_BOT_TOKEN", "")
+	file := l.str("TELEGRAM_BOT_TOKEN_FILE", "")
+	cmd := l.args("TOKEN_CMD")
+	n := 0
+	for _, set := range []bool{tok != "", file != "", len(cmd) > 0} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		l.errs = append(l.errs, errors.New("set only one of TELEGRAM_BOT_TOKEN, TELEGRAM_BOT_TOKEN_FILE and TOKEN_CMD"))
+		return tok
+	}
+	var src string
+	switch {
+	case file != "":
+		r, _ := l.lookup("TELEGRAM_BOT_TOKEN_FILE")
+		b, err := readPrivate(file)
+		if err != nil {
+			l.fail(r, "%v", err)
+			return ""
+		}
+		if tok = strings.TrimSpace(string(b)); tok == "" {
+			l.fail(r, "file is empty")
+		}
+		src = "TELEGRAM_BOT_TOKEN_FILE"
+	case len(cmd) > 0:
+		r, _ := l.lookup("TOKEN_CMD")
+		out, err := runTokenCmd(cmd)
+		if err != nil {
+			l.fail(r, "%v", err)
+			return ""
+		}
+		if tok = out; tok == "" {
+			l.fail(r, "printed no token")
+		}
+		src = "TOKEN_CMD"
+	default:
+		return tok
+	}
+	if tok != "" {
+		l.note("TELEGRAM_BOT_TOKEN", tok, src)
+	}
+	return tok
+}
+
+// runTokenCmd runs cmd and returns the first line of its output, like
+// `pass show` prints the password first.
+func runTokenCmd(cmd []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenCmdTimeout)
+	defer cancel()
+	c := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			if len(msg) > 200 {
+				msg = msg[:200] + "…"
+			}
+			return "", fmt.Errorf("%v: %s", err, msg)
+		}
+		return "", err
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(line), nil
+}
+
+var (
+	exportMu sync.Mutex
+	exported = map[string]bool{}
+)
+
+// ExportSecrets puts cfg.SecretEnv into the process environment, where codex
+// and the other commands mybot runs inherit it. Variables set outside mybot
+// win; entries dropped from the secrets file since the last call are unset.
+func ExportSecrets(cfg Config) {
+	exportMu.Lock()
+	defer exportMu.Unlock()
+	for k := range exported {
+		if _, ok := cfg.SecretEnv[k]; !ok {
+			_ = os.Unsetenv(k)
+			delete(exported, k)
+		}
+	}
+	for k, v := range cfg.SecretEnv {
+		if _, set := os.LookupEnv(k); set && !exported[k] {
+			continue
+		}
+		_ = os.Setenv(k, v)
+		exported[k] = true
+	}
+}
+
+// SecretFiles lists the files mybot reads its settings and secrets from:
+// .env, the config file, SECRETS_FILE, SECRETS_KEY_FILE and
+// TELEGRAM_BOT_TOKEN_FILE, as configured (possibly relative).
+func (c Config) SecretFiles() []string {
+	g := c
+	if c.global != nil {
+		g = *c.global
+	}
+	out := []string{DotEnvFile}
+	if g.ConfigFile != "" {
+		out = append(out, g.ConfigFile)
+	}
+	for _, k := range []string{"SECRETS_FILE", "SECRETS_KEY_FILE", "TELEGRAM_BOT_TOKEN_FILE"} {
+		if s, ok := g.setting(k); ok && s.Value != "" {
+			out = append(out, s.Value)
+		}
+	}
+	return out
+}
+
+// Secrets returns the secret values in c: the bot token, the secrets file's
+// entries and the passphrase, e.g. to redact them from logs.
+func (c Config) Secrets() []string {
+	var out []string
+	for _, s := range c.settings {
+		if s.Secret && s.Value != "" {
+			out = append(out, s.Value)
+		}
+	}
+	return out
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePrivate(t *testing.T, name, body string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestSealSecrets(t *testing.T) {
+	plain := []byte("TELEGRAM_BOT_TOKEN=123:abc\n")
+	keyHex, err := NewSecretsKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ReadSecretsKey(writePrivate(t, "key", keyHex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := SealSecrets(plain, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := OpenSecrets(sealed, key, ""); err != nil || string(got) != string(plain) {
+		t.Fatalf("key: %q, %v", got, err)
+	}
+	if _, err := OpenSecrets(sealed, nil, "pw"); err == nil || !strings.Contains(err.Error(), "SECRETS_KEY_FILE") {
+		t.Fatalf("without key: %v", err)
+	}
+
+	sealed, err = SealSecrets(plain, nil, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := OpenSecrets(sealed, nil, "correct horse"); err != nil || string(got) != string(plain) {
+		t.Fatalf("passphrase: %q, %v", got, err)
+	}
+	if _, err := OpenSecrets(sealed, nil, "wrong"); err == nil || !strings.Contains(err.Error(), "wrong key or passphrase") {
+		t.Fatalf("wrong passphrase: %v", err)
+	}
+	// The header is authenticated: claiming another derivation fails too,
+	// and iteration counts out of range are refused before any work.
+	forged := strings.Replace(string(sealed), "600000", "700000", 1)
+	if _, err := OpenSecrets([]byte(forged), nil, "correct horse"); err == nil || !strings.Contains(err.Error(), "wrong key or passphrase") {
+		t.Fatalf("forged header: %v", err)
+	}
+	for _, rounds := range []string{"1000", "0", "1000000000"} {
+		forged := strings.Replace(string(sealed), "600000", rounds, 1)
+		if _, err := OpenSecrets([]byte(forged), nil, "correct horse"); err == nil || !strings.Contains(err.Error(), "bad key derivation") {
+			t.Fatalf("%s iterations: %v", rounds, err)
+		}
+	}
+}
+
+func TestLoadFile_SecretsFile(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("TELEGRAM_ALLOWLIST", "1")
+	t.Setenv("MYBOT_TEST_API_KEY", "") // restored after the test
+	_ = os.Unsetenv("MYBOT_TEST_API_KEY")
+	body := "TELEGRAM_BOT_TOKEN=123:from-secrets\nMYBOT_TEST_API_KEY='sk-test-key'\n"
+	sealed, err := SealSecrets([]byte(body), nil, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writePrivate(t, "secrets.enc", string(sealed))
+	t.Setenv("SECRETS_FILE", path)
+	t.Setenv("SECRETS_PASSPHRASE", "pw")
+
+	cfg, err := LoadFile(writeConfig(t, "[telegram]\nbot_token = \"123:from-file\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TelegramToken != "123:from-secrets" {
+		t.Fatalf("token = %q (secrets file should win over the config file)", cfg.TelegramToken)
+	}
+	if cfg.SecretEnv["MYBOT_TEST_API_KEY"] != "sk-test-key" {
+		t.Fatalf("SecretEnv = %v", cfg.SecretEnv)
+	}
+	out := cfg.Describe()
+	for _, s := range []string{"from-secrets", "sk-test-key", "= pw "} {
+		if strings.Contains(out, s) {
+			t.Errorf("%q not redacted:\n%s", s, out)
+		}
+	}
+	if !strings.Contains(out, "TELEGRAM_BOT_TOKEN") || !strings.Contains(out, "<redacted>  # "+path) {
+		t.Errorf("missing secrets file source:\n%s", out)
+	}
+	if got := strings.Join(cfg.Secrets(), " "); !strings.Contains(got, "123:from-secrets") || !strings.Contains(got, "sk-test-key") {
+		t.Errorf("Secrets() = %q", got)
+	}
+
+	ExportSecrets(cfg)
+	if os.Getenv("MYBOT_TEST_API_KEY") != "sk-test-key" {
+		t.Fatal("secret not exported")
+	}
+	ExportSecrets(Config{})
+	if _, set := os.LookupEnv("MYBOT_TEST_API_KEY"); set {
+		t.Fatal("dropped secret still exported")
+	}
+
+	t.Setenv("SECRETS_PASSPHRASE", "nope")
+	if _, err := LoadFile(""); err == nil || !strings.Contains(err.Error(), `SECRETS_FILE="`+path+`": cannot decrypt`) {
+		t.Fatalf("wrong passphrase: %v", err)
+	}
+}
+
+func TestLoadFile_TokenSources(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("TELEGRAM_ALLOWLIST", "1")
+	t.Chdir(t.TempDir())
+
+	tokenFile := writePrivate(t, "token", "123:from-file\n")
+	t.Setenv("TELEGRAM_BOT_TOKEN_FILE", tokenFile)
+	cfg, err := Load()
+	if err != nil || cfg.TelegramToken != "123:from-file" {
+		t.Fatalf("token file: %q, %v", cfg.TelegramToken, err)
+	}
+	if !strings.Contains(cfg.Describe(), "<redacted>  # TELEGRAM_BOT_TOKEN_FILE") {
+		t.Fatalf("source:\n%s", cfg.Describe())
+	}
+
+	if err := os.Chmod(tokenFile, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "accessible by group or others") {
+		t.Fatalf("world-readable token file: %v", err)
+	}
+
+	t.Setenv("TELEGRAM_BOT_TOKEN_FILE", "")
+	t.Setenv("TOKEN_CMD", `sh -c "printf '123:from-cmd\nuser: bot\n'"`)
+	cfg, err = Load()
+	if err != nil || cfg.TelegramToken != "123:from-cmd" {
+		t.Fatalf("TOKEN_CMD: %q, %v", cfg.TelegramToken, err)
+	}
+
+	t.Setenv("TOKEN_CMD", `sh -c "echo locked >&2; exit 1"`)
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "exit status 1: locked") {
+		t.Fatalf("failing TOKEN_CMD: %v", err)
+	}
+
+	t.Setenv("TELEGRAM_BOT_TOKEN", "123:env")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "set only one of") {
+		t.Fatalf("two sources: %v", err)
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"mybot/internal/config"
+	"mybot/internal/metrics"
 )
 
 type Adapter interface {
@@ -22,6 +24,12 @@ type Handle interface {
 	SessionID() string
 }
 
+// ImageSender is implemented by adapters that can attach images to a prompt
+// (e.g. `codex exec -i <file>`). Adapters without it get the paths inline.
+type ImageSender interface {
+	SendWithImages(h Handle, input string, images []string) error
+}
+
 type EventType string
 
 const (
@@ -125,12 +133,26 @@ func (m *SessionManager) newWithID(ctx context.Context, chatID int64, sid string
 }
 
 func (m *SessionManager) Send(ctx context.Context, chatID int64, input string) (*Session, error) {
+	return m.SendWithImages(ctx, chatID, input, nil)
+}
+
+// SendWithImages is Send with image attachments (absolute paths).
+func (m *SessionManager) SendWithImages(ctx context.Context, chatID int64, input string, images []string) (*Session, error) {
+	return m.SendRun(ctx, chatID, input, images, nil)
+}
+
+// SendRun is SendWithImages calling started (if not nil) once the prompts
+// queued before this one are done and this one is about to be sent.
+func (m *SessionManager) SendRun(ctx context.Context, chatID int64, input string, images []string, started func()) (*Session, error) {
 	s, err := m.GetOrCreate(ctx, chatID)
 	if err != nil {
 		return nil, err
 	}
 	s.inMu.Lock()
 	defer s.inMu.Unlock()
+	if started != nil {
+		started()
+	}
 	s.lastSeen = time.Now()
 	if !s.IsRunning() {
 		// restart session automatically (prefer resuming)
@@ -140,7 +162,17 @@ func (m *SessionManager) Send(ctx context.Context, chatID int64, input string) (
 		}
 		s = s2
 	}
-	if err := m.adapter.Send(s.h, input); err != nil {
+	metrics.PromptsSent.Inc()
+	if len(images) > 0 {
+		if is, ok := m.adapter.(ImageSender); ok {
+			err = is.SendWithImages(s.h, input, images)
+		} else {
+			err = m.adapter.Send(s.h, input+"\n\nAttached images:\n- "+strings.Join(images, "\n- "))
+		}
+	} else {
+		err = m.adapter.Send(s.h, input)
+	}
+	if err != nil {
 		s.lastErr = err.Error()
 		return s, err
 	}
@@ -157,6 +189,13 @@ func (m *SessionManager) Cancel(chatID int64) error {
 	return m.adapter.Stop(s.h)
 }
 
+// Current returns the active session for a chat, if any.
+func (m *SessionManager) Current(chatID int64) *Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sessions[chatID]
+}
+
 func (m *SessionManager) Status(chatID int64) (string, bool) {
 	m.mu.Lock()
 	s := m.sessions[chatID]
@@ -0,0 +1,253 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A tiny Prometheus text-format exporter.
+// This is intentionally minimal to avoid pulling in client_golang and its deps.
+
+var (
+	UpdatesReceived = NewCounter("mybot_telegram_updates_total", "Telegram updates received.")
+	UpdatesIgnored  = NewCounter("mybot_telegram_updates_ignored_total", "Telegram updates ignored (not allowlisted or unsupported).")
+	PromptsSent     = NewCounter("mybot_prompts_sent_total", "Prompts sent to the agent.")
+
+	ExecDuration = NewHistogram("mybot_codex_exec_duration_seconds", "Duration of codex exec runs, one per message.",
+		[]float64{1, 5, 15, 30, 60, 120, 300, 600, 1200})
+	SessionDuration = NewHistogram("mybot_session_duration_seconds", "Lifetime of interactive (PTY) codex sessions, from start to exit.",
+		[]float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800, 86400})
+	ExitCodes  = NewCounterVec("mybot_codex_exit_codes_total", "Codex process exits by exit code.", "code")
+	TokensUsed = NewCounterVec("mybot_codex_tokens_total", "Tokens reported by codex turn.completed events.", "kind")
+
+	Compactions = NewCounterVec("mybot_memory_compactions_total", "Memory compactions by result.", "result")
+
+	ConfigReloads = NewCounterVec("mybot_config_reloads_total", "Config reloads (SIGHUP or /reload) by result.", "result")
+
+	SchedulerFires  = NewCounter("mybot_scheduler_fires_total", "Scheduled tasks fired.")
+	SchedulerMisses = NewCounter("mybot_scheduler_misses_total", "Scheduled tasks whose daily time passed without firing.")
+
+	UploadBytes = NewCounter("mybot_upload_bytes_total", "Bytes saved from Telegram uploads.")
+
+	EventsDropped = NewCounter("mybot_events_dropped_total", "Agent events dropped because the session channel was full.")
+
+	SendRetries  = NewCounterVec("mybot_telegram_send_retries_total", "Telegram sends retried, by reason (flood, parse, network).", "reason")
+	SendFailures = NewCounterVec("mybot_telegram_send_failures_total", "Telegram sends that failed for good, by reason.", "reason")
+)
+
+type metric interface {
+	name() string
+	write(b *strings.Builder)
+}
+
+var (
+	regMu    sync.Mutex
+	registry []metric
+)
+
+func register(m metric) {
+	regMu.Lock()
+	registry = append(registry, m)
+	regMu.Unlock()
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	n, help string
+
+	mu sync.Mutex
+	v  float64
+}
+
+func NewCounter(name, help string) *Counter {
+	c := &Counter{n: name, help: help}
+	register(c)
+	return c
+}
+
+func (c *Counter) Inc() { c.Add(1) }
+
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.v += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) name() string { return c.n }
+
+func (c *Counter) write(b *strings.Builder) {
+	c.mu.Lock()
+	v := c.v
+	c.mu.Unlock()
+	writeHeader(b, c.n, c.help, "counter")
+	fmt.Fprintf(b, "%s %s\n", c.n, formatFloat(v))
+}
+
+// CounterVec is a set of counters partitioned by a single label.
+type CounterVec struct {
+	n, help, label string
+
+	mu sync.Mutex
+	vs map[string]float64
+}
+
+func NewCounterVec(name, help, label string) *CounterVec {
+	c := &CounterVec{n: name, help: help, label: label, vs: map[string]float64{}}
+	register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(value string) { c.Add(value, 1) }
+
+func (c *CounterVec) Add(value string, v float64) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	c.vs[value] += v
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) name() string { return c.n }
+
+func (c *CounterVec) write(b *strings.Builder) {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.vs))
+	for k := range c.vs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	vals := make([]float64, len(keys))
+	for i, k := range keys {
+		vals[i] = c.vs[k]
+	}
+	c.mu.Unlock()
+
+	writeHeader(b, c.n, c.help, "counter")
+	for i, k := range keys {
+		fmt.Fprintf(b, "%s{%s=\"%s\"} %s\n", c.n, c.label, escapeLabel(k), formatFloat(vals[i]))
+	}
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	n, help string
+	bounds  []float64
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, non-cumulative; last is +Inf
+	sum    float64
+	total  uint64
+}
+
+func NewHistogram(name, help string, bounds []float64) *Histogram {
+	bs := append([]float64(nil), bounds...)
+	sort.Float64s(bs)
+	h := &Histogram{n: name, help: help, bounds: bs, counts: make([]uint64, len(bs)+1)}
+	register(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.total++
+	h.mu.Unlock()
+}
+
+// Since observes the elapsed time since start, in seconds.
+func (h *Histogram) Since(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) name() string { return h.n }
+
+func (h *Histogram) write(b *strings.Builder) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, total := h.sum, h.total
+	h.mu.Unlock()
+
+	writeHeader(b, h.n, h.help, "histogram")
+	var cum uint64
+	for i, le := range h.bounds {
+		cum += counts[i]
+		fmt.Fprintf(b, "%s_bucket{le=\"%s\"} %d\n", h.n, formatFloat(le), cum)
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", h.n, total)
+	fmt.Fprintf(b, "%s_sum %s\n", h.n, formatFloat(sum))
+	fmt.Fprintf(b, "%s_count %d\n", h.n, total)
+}
+
+func writeHeader(b *strings.Builder, name, help, typ string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, typ)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabel(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
+
+// Render returns all registered metrics in Prometheus text exposition format.
+func Render() string {
+	regMu.Lock()
+	ms := append([]metric(nil), registry...)
+	regMu.Unlock()
+	sort.Slice(ms, func(i, j int) bool { return ms[i].name() < ms[j].name() })
+
+	var b strings.Builder
+	for _, m := range ms {
+		m.write(&b)
+	}
+	return b.String()
+}
+
+// Handler serves Render() on GET.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write([]byte(Render()))
+	})
+}
+
+// Serve exposes /metrics on addr until ctx is done.
+func Serve(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutCtx)
+	}()
+
+	log.Printf("metrics: listening on %s/metrics", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("metrics: %v", err)
+	}
+}
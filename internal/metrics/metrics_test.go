@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// TestRender_Golden renders every registered metric plus a few test ones.
+// Run `go test ./internal/metrics -update` after intended changes.
+func TestRender_Golden(t *testing.T) {
+	c := NewCounter("test_requests_total", "Test counter.")
+	c.Add(2)
+	c.Add(-1) // ignored: counters only go up
+	v := NewCounterVec("test_errors_total", "Test counter vec.", "reason")
+	v.Inc(`quote " and \ backslash`)
+	v.Inc("line\nbreak")
+	v.Add("plain", 3)
+	h := NewHistogram("test_duration_seconds", "Test histogram.", []float64{5, 1, 2.5})
+	for _, x := range []float64{0.5, 1, 2, 4, 100} {
+		h.Observe(x)
+	}
+
+	got := Render()
+	golden := filepath.Join("testdata", "render.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with -update)", err)
+	}
+	if got != string(want) {
+		t.Fatalf("--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+}
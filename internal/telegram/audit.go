@@ -0,0 +1,330 @@
+package telegram
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+	"mybot/internal/util"
+)
+
+// AuditLog is an append-only, hash-chained record of privileged actions
+// (LOG_DIR/audit.jsonl). Each entry stores the previous entry's hash, so
+// editing or deleting a line breaks verification from that point on.
+// The newest seq and hash are also kept in audit.jsonl.head, which exposes
+// lines cut off the end of the log (the chain alone cannot).
+type AuditLog struct {
+	path string
+}
+
+// auditHead is the content of the .head file.
+type auditHead struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// auditTail is the end of a log as last read or written, so appends need not
+// re-read the file; size tells when the file changed behind our back.
+type auditTail struct {
+	seq        int64
+	hash, prev string
+	size       int64
+}
+
+type AuditEntry struct {
+	Seq     int64     `json:"seq"`
+	Time    time.Time `json:"ts"`
+	UserID  int64     `json:"user_id"`
+	User    string    `json:"user,omitempty"`
+	ChatID  int64     `json:"chat_id"`
+	Command string    `json:"command"`
+	Args    string    `json:"args,omitempty"`
+	Result  string    `json:"result"`
+	Prev    string    `json:"prev"`
+	Hash    string    `json:"hash"`
+}
+
+// auditMu serializes appends across AuditLog values sharing a file and
+// guards auditTails (keyed by path).
+var (
+	auditMu    sync.Mutex
+	auditTails = map[string]auditTail{}
+)
+
+func NewAuditLog(cfg config.Config) *AuditLog {
+	return &AuditLog{path: filepath.Join(cfg.LogDir, "audit.jsonl")}
+}
+
+func (e AuditEntry) computeHash() string {
+	e.Hash = ""
+	b, _ := json.Marshal(e)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Record appends an entry. The result is "ok" when err is nil. It refuses to
+// append when the log cannot be read back cleanly, rather than fork the chain.
+func (l *AuditLog) Record(msg *tgbotapi.Message, command, args string, err error) error {
+	result := "ok"
+	if err != nil {
+		result = "error: " + err.Error()
+	}
+	e := AuditEntry{
+		Time:    time.Now().UTC(),
+		UserID:  senderID(msg),
+		User:    userLabel(msg),
+		ChatID:  msg.Chat.ID,
+		Command: command,
+		Args:    util.Redact(args),
+		Result:  util.Redact(result),
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	t, terr := l.tail()
+	if terr != nil {
+		return fmt.Errorf("not appending to a damaged log: %w", terr)
+	}
+	e.Seq = t.seq + 1
+	e.Prev = t.hash
+	e.Hash = e.computeHash()
+
+	b, merr := json.Marshal(e)
+	if merr != nil {
+		return merr
+	}
+	line := append(b, '\n')
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+	f, ferr := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if ferr != nil {
+		return ferr
+	}
+	_, werr := f.Write(line)
+	if werr == nil {
+		werr = f.Sync()
+	}
+	if cerr := f.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr != nil {
+		delete(auditTails, l.path) // a partial line may have been written
+		return werr
+	}
+	auditTails[l.path] = auditTail{seq: e.Seq, hash: e.Hash, prev: e.Prev, size: t.size + int64(len(line))}
+	return l.writeHead(auditHead{Seq: e.Seq, Hash: e.Hash})
+}
+
+// tail returns the end of the log, from the cache unless the file's size
+// changed since. Reading the file checks it against the .head file.
+func (l *AuditLog) tail() (auditTail, error) {
+	var size int64
+	if fi, err := os.Stat(l.path); err == nil {
+		size = fi.Size()
+	} else if !os.IsNotExist(err) {
+		return auditTail{}, err
+	}
+	if t, ok := auditTails[l.path]; ok && t.size == size {
+		return t, nil
+	}
+	all, err := l.readAll()
+	if err != nil {
+		return auditTail{}, fmt.Errorf("%s: %w", l.path, err)
+	}
+	t := auditTail{size: size}
+	if n := len(all); n > 0 {
+		t.seq, t.hash, t.prev = all[n-1].Seq, all[n-1].Hash, all[n-1].Prev
+	}
+	if err := l.checkHead(t); err != nil {
+		return auditTail{}, err
+	}
+	auditTails[l.path] = t
+	return t, nil
+}
+
+func (l *AuditLog) headPath() string { return l.path + ".head" }
+
+func (l *AuditLog) readHead() (*auditHead, error) {
+	b, err := os.ReadFile(l.headPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil // logs written before the head file existed
+		}
+		return nil, err
+	}
+	var h auditHead
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, fmt.Errorf("%s: %v", l.headPath(), err)
+	}
+	return &h, nil
+}
+
+// checkHead compares the end of the log with the .head file. The head may
+// lag one entry behind after a crash between the two writes.
+func (l *AuditLog) checkHead(t auditTail) error {
+	h, err := l.readHead()
+	if err != nil || h == nil {
+		return err
+	}
+	if (h.Seq == t.seq && h.Hash == t.hash) || (h.Seq == t.seq-1 && h.Hash == t.prev) {
+		return nil
+	}
+	return fmt.Errorf("log ends at seq %d but %s records seq %d: entries were removed or the log was replaced", t.seq, filepath.Base(l.headPath()), h.Seq)
+}
+
+func (l *AuditLog) writeHead(h auditHead) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	tmp := l.headPath() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.headPath())
+}
+
+func (l *AuditLog) readAll() ([]AuditEntry, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var out []AuditEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		var e AuditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return out, fmt.Errorf("line %d: %v", line, err)
+		}
+		out = append(out, e)
+	}
+	return out, sc.Err()
+}
+
+// Verify walks the chain and reports the number of valid entries,
+// or an error pointing at the first entry that does not check out.
+func (l *AuditLog) Verify() (int, error) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	all, err := l.readAll()
+	if err != nil {
+		return len(all), err
+	}
+	prev := ""
+	for i, e := range all {
+		if e.Seq != int64(i+1) {
+			return i, fmt.Errorf("seq %d: expected seq %d", e.Seq, i+1)
+		}
+		if e.Prev != prev {
+			return i, fmt.Errorf("seq %d: prev hash mismatch", e.Seq)
+		}
+		if e.computeHash() != e.Hash {
+			return i, fmt.Errorf("seq %d: hash mismatch (entry modified)", e.Seq)
+		}
+		prev = e.Hash
+	}
+	t := auditTail{}
+	if n := len(all); n > 0 {
+		t.seq, t.hash, t.prev = all[n-1].Seq, all[n-1].Hash, all[n-1].Prev
+	}
+	if err := l.checkHead(t); err != nil {
+		return len(all), err
+	}
+	return len(all), nil
+}
+
+// Tail returns the last n entries.
+func (l *AuditLog) Tail(n int) ([]AuditEntry, error) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	all, err := l.readAll()
+	if n > 0 && len(all) > n {
+		all = all[len(all)-n:]
+	}
+	return all, err
+}
+
+// auditAction is the one-liner used by command handlers. A failed append is
+// logged and returned.
+func auditAction(cfg config.Config, msg *tgbotapi.Message, command, args string, err error) error {
+	if msg == nil {
+		return nil
+	}
+	if rerr := NewAuditLog(cfg).Record(msg, command, args, err); rerr != nil {
+		log.Printf("audit: %s %q by user %d: %v", command, args, senderID(msg), rerr)
+		return rerr
+	}
+	return nil
+}
+
+// auditFound turns a "not found" outcome into an audit error.
+func auditFound(ok bool, err error) error {
+	if err == nil && !ok {
+		return errors.New("not found")
+	}
+	return err
+}
+
+// handleAuditCmd: /audit [n]
+func handleAuditCmd(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, cmd []string) {
+	n := 20
+	if len(cmd) >= 2 {
+		v, err := strconv.Atoi(cmd[1])
+		if err != nil || v <= 0 {
+			sendText(bot, chatID, "usage: /audit [n]")
+			return
+		}
+		n = v
+	}
+	l := NewAuditLog(cfg)
+	count, verr := l.Verify()
+	entries, err := l.Tail(n)
+	if err != nil && len(entries) == 0 {
+		sendText(bot, chatID, fmt.Sprintf("audit: %v", err))
+		return
+	}
+
+	var b strings.Builder
+	if verr != nil {
+		b.WriteString(fmt.Sprintf("audit chain: BROKEN after %d valid entries: %v\n\n", count, verr))
+	} else {
+		b.WriteString(fmt.Sprintf("audit chain: ok (%d entries)\n\n", count))
+	}
+	if len(entries) == 0 {
+		b.WriteString("(empty)")
+	}
+	for _, e := range entries {
+		line := fmt.Sprintf("#%d %s %s(%d) chat=%d %s", e.Seq, e.Time.Local().Format("01-02 15:04:05"), e.User, e.UserID, e.ChatID, e.Command)
+		if e.Args != "" {
+			args := []rune(e.Args)
+			if len(args) > 80 {
+				args = append(args[:80], '…')
+			}
+			line += " " + string(args)
+		}
+		b.WriteString(line + " -> " + e.Result + "\n")
+	}
+	sendText(bot, chatID, b.String())
+}
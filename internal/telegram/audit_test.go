@@ -0,0 +1,90 @@
+package telegram
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+)
+
+func TestAuditLog_ChainDetectsTampering(t *testing.T) {
+	cfg := config.Config{LogDir: t.TempDir()}
+	msg := &tgbotapi.Message{
+		Chat: &tgbotapi.Chat{ID: -100},
+		From: &tgbotapi.User{ID: 7, UserName: "alice"},
+	}
+	auditAction(cfg, msg, "/skills install", "https://example.com/a.git", nil)
+	auditAction(cfg, msg, "/delete", "a.txt", os.ErrNotExist)
+	auditAction(cfg, msg, "/cancel", "", nil)
+
+	l := NewAuditLog(cfg)
+	n, err := l.Verify()
+	if err != nil || n != 3 {
+		t.Fatalf("verify: n=%d err=%v", n, err)
+	}
+
+	b, err := os.ReadFile(l.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(b), `"args":"a.txt"`, `"args":"b.txt"`, 1)
+	if tampered == string(b) {
+		t.Fatal("test setup: nothing replaced")
+	}
+	if err := os.WriteFile(l.path, []byte(tampered), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	n, err = l.Verify()
+	if err == nil || n != 1 {
+		t.Fatalf("expected chain break after 1 entry, got n=%d err=%v", n, err)
+	}
+}
+
+func TestAuditLog_TruncationAndDamage(t *testing.T) {
+	cfg := config.Config{LogDir: t.TempDir()}
+	msg := &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 1}, From: &tgbotapi.User{ID: 1}}
+	for _, c := range []string{"/a", "/b", "/c"} {
+		if err := auditAction(cfg, msg, c, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l := NewAuditLog(cfg)
+	b, err := os.ReadFile(l.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+
+	// Cutting the last entry leaves a valid chain; the head file gives it away.
+	if err := os.WriteFile(l.path, []byte(lines[0]+lines[1]), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := l.Verify(); err == nil || !strings.Contains(err.Error(), "entries were removed") || n != 2 {
+		t.Fatalf("truncated log: n=%d err=%v", n, err)
+	}
+	if err := auditAction(cfg, msg, "/d", "", nil); err == nil {
+		t.Fatal("appended to a truncated log")
+	}
+
+	// A corrupt tail line must not make the next entry chain to an older one.
+	if err := os.WriteFile(l.path, []byte(lines[0]+lines[1]+lines[2]+`{"seq":4,"trunc`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := auditAction(cfg, msg, "/d", "", nil); err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Fatalf("append after a corrupt line: %v", err)
+	}
+
+	// Restored, appends continue the chain.
+	if err := os.WriteFile(l.path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := auditAction(cfg, msg, "/d", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := l.Verify(); err != nil || n != 4 {
+		t.Fatalf("verify: n=%d err=%v", n, err)
+	}
+}
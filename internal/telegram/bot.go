@@ -3,9 +3,7 @@ package telegram
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -15,11 +13,16 @@ import (
 
 	"mybot/internal/config"
 	"mybot/internal/core"
+	"mybot/internal/metrics"
 	"mybot/internal/util"
 )
 
-func Run(ctx context.Context, cfg config.Config, sessions *core.SessionManager) error {
-	bot, err := tgbotapi.NewBotAPI(cfg.TelegramToken)
+func Run(ctx context.Context, live *config.Live, sessions *core.SessionManager) error {
+	cfg := live.Get()
+	// The library logs request errors, which carry the token in the URL; send
+	// them through the standard logger, whose output main redacts.
+	_ = tgbotapi.SetLogger(log.Default())
+	bot, err := newBotAPI(cfg)
 	if err != nil {
 		return err
 	}
@@ -36,25 +39,46 @@ func Run(ctx context.Context, cfg config.Config, sessions *core.SessionManager)
 	log.Printf("telegram: started as @%s", bot.Self.UserName)
 
 	store := NewScheduleStore(cfg)
-	go RunScheduler(ctx, bot, cfg, sessions, store)
+	roles := NewRoleStore(cfg)
+	live.OnReload(func(next config.Config) {
+		roles.setConfig(next)
+		if err := store.load(); err != nil {
+			log.Printf("reload: schedules: %v", err)
+		}
+	})
+	go RunScheduler(ctx, bot, live, sessions, store)
+	if n, err := migrateLegacyUploads(cfg); err != nil {
+		log.Printf("uploads: moving legacy uploads: %v", err)
+	} else if n > 0 {
+		log.Printf("uploads: moved %d legacy uploads into %s", n, cfg.UploadDir+"/<chat_id>")
+	}
+	go RunUploadCleaner(ctx, live)
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 		case up := <-updates:
+			metrics.UpdatesReceived.Inc()
+			cfg := live.Get()
+			if up.CallbackQuery != nil {
+				handleCallback(bot, cfg, roles, up.CallbackQuery)
+				continue
+			}
 			if up.Message == nil {
+				metrics.UpdatesIgnored.Inc()
 				continue
 			}
 			chatID := up.Message.Chat.ID
 			if _, ok := cfg.Allowlist[chatID]; !ok {
+				metrics.UpdatesIgnored.Inc()
 				if cfg.LogUnknown {
 					log.Printf("telegram: ignored chat_id=%d user=%s text=%q", chatID, userLabel(up.Message), up.Message.Text)
 				}
 				// Ignore silently for safety.
 				continue
 			}
-			handleMessage(ctx, bot, cfg, sessions, store, up.Message)
+			handleMessage(ctx, bot, live, sessions, store, roles, up.Message)
 		}
 	}
 }
@@ -68,10 +92,20 @@ func setBotMenuCommands(bot *tgbotapi.BotAPI) {
 		{Command: "cancel", Description: "中断当前任务（Ctrl+C）"},
 		{Command: "uploads", Description: "列出最近上传文件"},
 		{Command: "delete", Description: "删除上传文件：/delete <name|path>"},
-		{Command: "skills", Description: "skills 管理：/skills ls|install|rm|path"},
+		{Command: "skills", Description: "skills 管理：/skills ls|info|install|enable|disable|profile|unused|update|pin|rm|path"},
 		{Command: "memory", Description: "记忆体：/memory 或 /memory ideas"},
-		{Command: "skillify", Description: "把记忆 ideas 生成/升级为 skill：/skillify <name> <idx>"},
+		{Command: "skillify", Description: "把记忆 ideas 生成/升级为 skill：/skillify <name> <idx>|--from-transcript（预览 diff 后确认）"},
 		{Command: "schedule", Description: "定时任务：/schedule ls|add|rm|on|off|run"},
+		{Command: "get", Description: "取回工作目录里的文件：/get <path>"},
+		{Command: "full", Description: "取回最近一条长回复的完整文件：/full [md|html]"},
+		{Command: "apply", Description: "应用上传的 patch：/apply <name>"},
+		{Command: "revert", Description: "撤销最近一次 /apply"},
+		{Command: "export", Description: "导出会话：/export [md|html] [session_id]"},
+		{Command: "sessions", Description: "列出最近会话记录"},
+		{Command: "whoami", Description: "查看自己的 user_id 与角色"},
+		{Command: "role", Description: "角色管理（admin）：/role ls|grant|revoke"},
+		{Command: "audit", Description: "审计日志（admin）：/audit [n]"},
+		{Command: "reload", Description: "重新加载 .env 与配置文件（admin）"},
 		{Command: "help", Description: "帮助与用法"},
 	}
 	_, err := bot.Request(tgbotapi.NewSetMyCommands(cmds...))
@@ -94,28 +128,29 @@ func userLabel(m *tgbotapi.Message) string {
 	return fmt.Sprintf("%d", u.ID)
 }
 
-func handleMessage(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.SessionManager, store *ScheduleStore, msg *tgbotapi.Message) {
+func handleMessage(ctx context.Context, bot *tgbotapi.BotAPI, live *config.Live, sessions *core.SessionManager, store *ScheduleStore, roles *RoleStore, msg *tgbotapi.Message) {
 	chatID := msg.Chat.ID
+	cfg := live.Get().ForChat(chatID)
 
-	// Document upload support.
-	if msg.Document != nil {
-		prompt, err := saveAndBuildPrompt(ctx, bot, cfg, msg)
-		if err != nil {
-			sendText(bot, chatID, fmt.Sprintf("file save failed: %v", err))
-			return
-		}
-		// If user also typed a caption, append it.
-		if strings.TrimSpace(msg.Caption) != "" {
-			prompt += "\n\nUser caption:\n" + msg.Caption
+	group := isGroupChat(msg)
+
+	// A skill archive sent with the caption "/skills install [name]".
+	if cmd, ok := skillInstallCaption(bot, msg); ok {
+		if authorize(bot, roles, msg, cmd) {
+			handleSkillUpload(ctx, bot, cfg, msg, cmd)
 		}
-		s, err := sessions.Send(ctx, chatID, prompt)
-		if err != nil {
-			sendText(bot, chatID, fmt.Sprintf("send failed: %v", err))
-			if s == nil {
-				return
-			}
+		return
+	}
+
+	// Attachments: documents, photos, voice/audio, video, stickers; albums are collected first.
+	if hasMedia(msg) {
+		if msg.MediaGroupID != "" {
+			collectAlbum(ctx, bot, cfg, sessions, roles, msg)
+			return
 		}
-		go pumpEvents(bot, cfg, chatID, s)
+		inChatOrder(chatID, func() {
+			handleMedia(ctx, bot, cfg, sessions, roles, []*tgbotapi.Message{msg})
+		})
 		return
 	}
 
@@ -125,7 +160,16 @@ func handleMessage(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config,
 	}
 
 	if strings.HasPrefix(text, "/") {
-		cmd := strings.Fields(text)
+		cmd := splitCommand(text)
+		name, ok := normalizeCommand(cmd[0], bot.Self.UserName)
+		if !ok {
+			// Addressed to another bot in the same group.
+			return
+		}
+		cmd[0] = name
+		if !authorize(bot, roles, msg, cmd) {
+			return
+		}
 		switch cmd[0] {
 		case "/new":
 			s, err := sessions.NewFresh(ctx, chatID)
@@ -137,7 +181,12 @@ func handleMessage(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config,
 			go pumpEvents(bot, cfg, chatID, s)
 			return
 		case "/cancel":
-			_ = sessions.Cancel(chatID)
+			if !canCancel(roles, msg) {
+				sendText(bot, chatID, "cancel: only the user who started this run or an admin can cancel it")
+				return
+			}
+			err := sessions.Cancel(chatID)
+			auditAction(cfg, msg, "/cancel", "", err)
 			sendText(bot, chatID, "sent interrupt")
 			return
 		case "/status":
@@ -148,40 +197,62 @@ func handleMessage(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config,
 			}
 			sendText(bot, chatID, st)
 			return
+		case "/whoami":
+			sendText(bot, chatID, fmt.Sprintf("user_id=%d chat_id=%d role=%s", senderID(msg), chatID, roles.RoleOf(senderID(msg), chatID)))
+			return
+		case "/role":
+			handleRoleCmd(bot, cfg, roles, msg, cmd)
+			return
+		case "/audit":
+			handleAuditCmd(bot, cfg, chatID, cmd)
+			return
+		case "/reload":
+			handleReloadCmd(bot, cfg, live, msg)
+			return
 		case "/help":
-			sendText(bot, chatID, "/new /cancel /status /uploads /delete <name-or-path>\n/skills [/ls]\n/skills install <git-url-or-local-path> [name]\n/skills rm <name>\n/skills path\n/memory [/ideas]\n/skillify <name> <ideaIndex>\n/schedule [/ls]\n/schedule add HH:MM <prompt>\n/schedule rm <id>\n/schedule on|off <id>\n\n自然语言示例：每天上午9点获取最新AI资讯发送给我")
+			sendText(bot, chatID, "/new /cancel /status /delete <name-or-path>\n/uploads [clean [older-than]]\n/skills [/ls]\n/skills install <dir|git-url[#path@ref]|upload> [name]\n/skills info|update|pin <name> ...\n/skills enable|disable <name...|all>\n/skills profile\n/skills unused [age]\n/skills rm <name>\n/skills path\n/memory [/ideas]\n/skillify <name> <ideaIndex>|--from-transcript\n/schedule [/ls]\n/schedule add HH:MM <prompt>\n/schedule rm <id>\n/schedule on|off <id>\n/get <path>\n/full [md|html]\n/apply <patch-upload>\n/revert\n/export [md|html] [session_id]\n/sessions\n/whoami\n/role ls|grant|revoke (admin)\n/audit [n] (admin)\n/reload (admin)\n\n自然语言示例：每天上午9点获取最新AI资讯发送给我")
 			return
 		case "/skills":
-			handleSkillsCmd(bot, cfg, chatID, cmd)
+			handleSkillsCmd(bot, cfg, msg, cmd)
 			return
 		case "/memory":
 			handleMemoryCmd(bot, cfg, chatID, cmd)
 			return
 		case "/skillify":
-			handleSkillifyCmd(ctx, bot, cfg, chatID, cmd)
+			handleSkillifyCmd(ctx, bot, cfg, sessions, msg, cmd)
 			return
 		case "/schedule":
-			handleScheduleCmd(bot, cfg, sessions, store, chatID, cmd)
+			handleScheduleCmd(bot, cfg, sessions, store, msg, cmd)
+			return
+		case "/export":
+			handleExportCmd(bot, cfg, sessions, chatID, cmd)
+			return
+		case "/sessions":
+			handleSessionsCmd(bot, cfg, chatID)
+			return
+		case "/apply":
+			handleApplyCmd(bot, cfg, chatID, cmd)
+			return
+		case "/revert":
+			handleRevertCmd(bot, cfg, msg)
+			return
+		case "/get":
+			handleGetCmd(bot, cfg, chatID, cmd)
+			return
+		case "/full":
+			handleFullCmd(bot, cfg, chatID, cmd)
 			return
 		case "/uploads":
-			root := uploadsRoot(cfg)
-			names, err := listUploads(root, cfg.UploadDir, 20)
-			if err != nil {
-				sendText(bot, chatID, fmt.Sprintf("uploads: %v", err))
-				return
-			}
-			if len(names) == 0 {
-				sendText(bot, chatID, "uploads: (empty)")
-				return
-			}
-			sendText(bot, chatID, "uploads:\n- "+strings.Join(names, "\n- "))
+			handleUploadsCmd(bot, cfg, msg, cmd)
 			return
 		case "/delete", "/rm":
 			if len(cmd) < 2 {
 				sendText(bot, chatID, "usage: /delete <filename|relative-path|absolute-path>")
 				return
 			}
-			target, err := deleteUpload(cfg, strings.Join(cmd[1:], " "))
+			arg := strings.Join(cmd[1:], " ")
+			target, err := deleteUpload(cfg, chatID, arg)
+			auditAction(cfg, msg, "/delete", arg, err)
 			if err != nil {
 				sendText(bot, chatID, fmt.Sprintf("delete failed: %v", err))
 				return
@@ -194,6 +265,20 @@ func handleMessage(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config,
 		}
 	}
 
+	// In groups, plain chatter is ignored unless the bot is mentioned or replied to.
+	if group {
+		t, ok := groupTrigger(cfg, bot, msg, text)
+		if !ok || t == "" {
+			return
+		}
+		text = t
+	}
+
+	// Everything below acts on the agent, schedules or uploads.
+	if !authorize(bot, roles, msg, nil) {
+		return
+	}
+
 	// Natural-language schedule: "每天上午9点获取最新AI资讯发送给我"
 	if ts, ok := parseDailySchedules(text); ok {
 		prompt := ts[0].Prompt
@@ -204,6 +289,7 @@ func handleMessage(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config,
 		var tasks []ScheduledTask
 		for _, t := range ts {
 			task, err := store.UpsertDaily(chatID, t.HHMM, prompt)
+			auditAction(cfg, msg, "schedule add (natural language)", t.HHMM+" "+text, err)
 			if err != nil {
 				sendText(bot, chatID, fmt.Sprintf("schedule failed: %v", err))
 				return
@@ -225,9 +311,10 @@ func handleMessage(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config,
 	}
 
 	// Natural-language delete helper (opt-in by wording).
-	// We keep this conservative and only delete inside UPLOAD_DIR.
+	// We keep this conservative and only delete inside this chat's uploads.
 	if arg, ok := nlDeleteArg(text); ok {
-		target, err := deleteUpload(cfg, arg)
+		target, err := deleteUpload(cfg, chatID, arg)
+		auditAction(cfg, msg, "delete (natural language)", arg, err)
 		if err != nil {
 			sendText(bot, chatID, fmt.Sprintf("delete failed: %v", err))
 			return
@@ -236,14 +323,92 @@ func handleMessage(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config,
 		return
 	}
 
-	s, err := sessions.Send(ctx, chatID, text)
-	if err != nil {
-		sendText(bot, chatID, fmt.Sprintf("send failed: %v", err))
-		if s == nil {
-			return
+	// Behind any attachment of this chat still being downloaded.
+	inChatOrder(chatID, func() {
+		runPrompt(ctx, bot, cfg, sessions, chatID, senderID(msg), attributePrompt(msg, text))
+	})
+}
+
+// callbackCommands maps inline-button data prefixes to the command whose role they need.
+var callbackCommands = map[string]string{
+	"get":      "/get",
+	"apply":    "/apply",
+	"skillify": "/skillify",
+}
+
+// handleCallback serves inline keyboard presses with the same allowlist and role
+// checks as the equivalent command.
+func handleCallback(bot *tgbotapi.BotAPI, cfg config.Config, roles *RoleStore, cq *tgbotapi.CallbackQuery) {
+	if cq.Message == nil || cq.Message.Chat == nil {
+		return
+	}
+	chatID := cq.Message.Chat.ID
+	if _, ok := cfg.Allowlist[chatID]; !ok {
+		metrics.UpdatesIgnored.Inc()
+		return
+	}
+	cfg = cfg.ForChat(chatID)
+
+	prefix, _, _ := strings.Cut(cq.Data, ":")
+	answer := ""
+	if cmd, ok := callbackCommands[prefix]; !ok {
+		answer = "unknown action"
+	} else if need, have := requiredRole([]string{cmd}), roles.RoleOf(cq.From.ID, chatID); have < need {
+		answer = fmt.Sprintf("permission denied: requires %s (you: %s)", need, have)
+	} else {
+		// The presser, not the bot, is the actor for audit purposes.
+		msg := *cq.Message
+		msg.From = cq.From
+		switch prefix {
+		case "get":
+			answer = handleGetCallback(bot, cfg, chatID, cq.Data)
+		case "apply":
+			answer = handleApplyCallback(bot, cfg, &msg, cq.Data)
+		case "skillify":
+			answer = handleSkillifyCallback(bot, cfg, &msg, cq.Data)
 		}
 	}
-	go pumpEvents(bot, cfg, chatID, s)
+	_, _ = bot.Request(tgbotapi.NewCallback(cq.ID, answer))
+}
+
+// runPrompt sends a prompt in the background so the update loop stays responsive
+// (Send blocks until the agent finishes; /cancel must still get through).
+// ownerID is the user who started the run (0 for scheduled runs).
+func runPrompt(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.SessionManager, chatID, ownerID int64, prompt string, images ...string) {
+	go func() {
+		// Start pumping before the run so output streams instead of arriving at the end.
+		if s, err := sessions.GetOrCreate(ctx, chatID); err == nil {
+			go pumpEvents(bot, cfg, chatID, s)
+		}
+		var before map[string]fileStamp
+		if cfg.ReturnFiles {
+			before = snapshotWorkdir(cfg)
+		}
+		// The owner applies from the moment this prompt leaves the queue until
+		// it finishes, not while earlier prompts are still running.
+		var run uint64
+		s, err := sessions.SendRun(ctx, chatID, prompt, images, func() { run = startRun(chatID, ownerID) })
+		endRun(chatID, run)
+		if err != nil {
+			sendText(bot, chatID, fmt.Sprintf("send failed: %v", err))
+			if s == nil {
+				return
+			}
+		}
+		go pumpEvents(bot, cfg, chatID, s)
+
+		// Exec mode returns once the turn is done, so the diff covers this run.
+		// (Interactive mode returns immediately and usually finds nothing.)
+		if before != nil {
+			if after := snapshotWorkdir(cfg); after != nil {
+				if changed := changedFiles(before, after); len(changed) > 0 {
+					// Let the pump flush the final reply first.
+					time.Sleep(cfg.FlushInterval)
+					offerChangedFiles(bot, cfg, chatID, changed)
+				}
+			}
+		}
+	}()
 }
 
 // pumpEvents reads session events and posts to Telegram with batching.
@@ -271,7 +436,11 @@ func pumpEvents(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, s *core.S
 		}
 		out := buf.String()
 		buf.Reset()
-		sendText(bot, chatID, util.TrimToBytes(out, cfg.MaxChunkBytes))
+		if cfg.LongReplyBytes > 0 && len(out) > cfg.LongReplyBytes {
+			sendLongReply(bot, cfg, chatID, out)
+			return
+		}
+		sendText(bot, chatID, out)
 	}
 
 	events := s.Events()
@@ -304,17 +473,8 @@ func pumpEvents(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, s *core.S
 	}
 }
 
-func sendText(bot *tgbotapi.BotAPI, chatID int64, text string) {
-	if strings.TrimSpace(text) == "" {
-		return
-	}
-	body, _ := util.FormatTelegramHTML(text)
-	m := tgbotapi.NewMessage(chatID, body)
-	m.ParseMode = "HTML"
-	_, _ = bot.Send(m)
-}
-
-func handleSkillsCmd(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, cmd []string) {
+func handleSkillsCmd(bot *tgbotapi.BotAPI, cfg config.Config, msg *tgbotapi.Message, cmd []string) {
+	chatID := msg.Chat.ID
 	if len(cmd) == 1 || (len(cmd) >= 2 && (cmd[1] == "ls" || cmd[1] == "list")) {
 		names, err := listSkills(cfg)
 		if err != nil {
@@ -325,6 +485,17 @@ func handleSkillsCmd(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, cmd
 			sendText(bot, chatID, "skills: (empty)")
 			return
 		}
+		key := chatKeyFromChatID(chatID)
+		p, profiled, _ := NewSkillProfiles(cfg).Get(key)
+		usage, _ := NewSkillUsage(cfg).All()
+		now := time.Now()
+		for i, n := range names {
+			line := n + " — " + describeSkillUse(usage[n], key, now)
+			if profiled && !p.Allows(n) {
+				line += " (disabled here)"
+			}
+			names[i] = line
+		}
 		sendText(bot, chatID, "skills:\n- "+strings.Join(names, "\n- "))
 		return
 	}
@@ -339,6 +510,7 @@ func handleSkillsCmd(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, cmd
 			return
 		}
 		name, err := removeSkill(cfg, cmd[2])
+		auditAction(cfg, msg, "/skills rm", cmd[2], err)
 		if err != nil {
 			sendText(bot, chatID, fmt.Sprintf("skills rm failed: %v", err))
 			return
@@ -347,7 +519,7 @@ func handleSkillsCmd(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, cmd
 		return
 	case "install", "add":
 		if len(cmd) < 3 {
-			sendText(bot, chatID, "usage: /skills install <git-url-or-local-path> [name]")
+			sendText(bot, chatID, skillsInstallUsage)
 			return
 		}
 		source := cmd[2]
@@ -355,86 +527,204 @@ func handleSkillsCmd(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, cmd
 		if len(cmd) >= 4 {
 			name = cmd[3]
 		}
-		installed, err := installSkill(cfg, name, source)
-		if err != nil {
-			// installSkill may return success-with-warning via err; include message.
-			sendText(bot, chatID, fmt.Sprintf("skills install: %v", err))
-			if installed != "" {
-				sendText(bot, chatID, "installed: "+installed)
+		// A bare name that is neither a path nor a git URL refers to an earlier upload.
+		if _, err := os.Stat(source); err != nil && !looksLikeGitURL(source) {
+			if p, err := resolveUpload(cfg, chatID, source); err == nil {
+				source = p
 			}
+		}
+		// Cloning may take a while; do not hold up the update loop.
+		go runSkillInstall(bot, cfg, msg, name, source, strings.Join(cmd[2:], " "))
+		return
+	case "enable", "disable":
+		handleSkillToggle(bot, cfg, msg, cmd)
+		return
+	case "unused":
+		age := 30 * 24 * time.Hour
+		if len(cmd) >= 3 {
+			d, err := parseAge(cmd[2])
+			if err != nil {
+				sendText(bot, chatID, fmt.Sprintf("skills unused: %v", err))
+				return
+			}
+			age = d
+		}
+		list, err := unusedSkills(cfg, age, time.Now())
+		if err != nil {
+			sendText(bot, chatID, fmt.Sprintf("skills unused: %v", err))
+			return
+		}
+		if len(list) == 0 {
+			sendText(bot, chatID, fmt.Sprintf("skills unused: every skill was used in the last %s", formatAge(age)))
 			return
 		}
-		sendText(bot, chatID, "installed: "+installed)
+		sendText(bot, chatID, fmt.Sprintf("skills not used in the last %s (candidates for /skills rm):\n- %s", formatAge(age), strings.Join(list, "\n- ")))
+		return
+	case "profile":
+		desc, err := describeSkillProfile(cfg, chatID)
+		if err != nil {
+			sendText(bot, chatID, fmt.Sprintf("skills profile: %v", err))
+			return
+		}
+		sendText(bot, chatID, desc)
+		return
+	case "info":
+		if len(cmd) < 3 {
+			sendText(bot, chatID, "usage: /skills info <name>")
+			return
+		}
+		info, err := skillInfo(cfg, cmd[2])
+		if err != nil {
+			sendText(bot, chatID, fmt.Sprintf("skills info: %v", err))
+			return
+		}
+		sendText(bot, chatID, info)
+		return
+	case "update", "upgrade":
+		target := "all"
+		if len(cmd) >= 3 {
+			target = cmd[2]
+		}
+		// Each git-sourced skill is fetched; do not hold up the update loop.
+		go runSkillUpdate(bot, cfg, msg, target)
+		return
+	case "pin":
+		if len(cmd) < 4 {
+			sendText(bot, chatID, "usage: /skills pin <name> <branch|tag|commit>  (ref - removes the pin)")
+			return
+		}
+		// Pinning may fetch from the remote too.
+		go func() {
+			summary, err := pinSkill(cfg, cmd[2], cmd[3])
+			auditAction(cfg, msg, "/skills pin", cmd[2]+" "+cmd[3], err)
+			if err != nil {
+				sendText(bot, chatID, fmt.Sprintf("skills pin failed: %v", err))
+				return
+			}
+			sendText(bot, chatID, summary)
+		}()
 		return
 	default:
-		sendText(bot, chatID, "usage:\n/skills\n/skills install <git-url-or-local-path> [name]\n/skills rm <name>\n/skills path")
+		sendText(bot, chatID, "usage:\n/skills\n/skills info <name>\n/skills install <source> [name]\n/skills enable|disable <name...|all>\n/skills profile\n/skills unused [30d]\n/skills update [name|all]\n/skills pin <name> <ref>\n/skills rm <name>\n/skills path")
 		return
 	}
 }
 
-func saveAndBuildPrompt(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config, msg *tgbotapi.Message) (string, error) {
+const skillsInstallUsage = "usage: /skills install <source> [name]\n" +
+	"source: a local directory, a git URL (repo.git#sub/dir@ref), an uploaded .zip/.tar.gz/SKILL.md\n" +
+	"or send the archive / SKILL.md as a document with the caption /skills install [name]"
+
+// runSkillUpdate updates one skill or all of them and reports the result.
+func runSkillUpdate(bot *tgbotapi.BotAPI, cfg config.Config, msg *tgbotapi.Message, target string) {
 	chatID := msg.Chat.ID
-	doc := msg.Document
-	if doc == nil {
-		return "", fmt.Errorf("no document")
+	names := []string{target}
+	if target == "all" {
+		all, err := listSkills(cfg)
+		if err != nil {
+			sendText(bot, chatID, fmt.Sprintf("skills update: %v", err))
+			return
+		}
+		names = all
+	}
+	var report []string
+	var failed error
+	for _, n := range names {
+		summary, err := updateSkill(cfg, n)
+		if err != nil {
+			failed = err
+			summary = fmt.Sprintf("%s: %v", n, err)
+		}
+		report = append(report, summary)
 	}
-	if doc.FileSize > int(cfg.MaxUploadBytes) && cfg.MaxUploadBytes > 0 {
-		return "", fmt.Errorf("file too large: %d bytes (max %d)", doc.FileSize, cfg.MaxUploadBytes)
+	auditAction(cfg, msg, "/skills update", target, failed)
+	if len(report) == 0 {
+		sendText(bot, chatID, "skills update: no skills installed")
+		return
 	}
+	sendText(bot, chatID, "skills update:\n"+strings.Join(report, "\n"))
+}
 
-	workdir := cfg.WorkDir
-	uploadDir := filepath.Join(workdir, cfg.UploadDir)
-	if err := os.MkdirAll(uploadDir, 0o755); err != nil {
-		return "", err
+func runSkillInstall(bot *tgbotapi.BotAPI, cfg config.Config, msg *tgbotapi.Message, name, source, auditArg string) {
+	chatID := msg.Chat.ID
+	installed, report, err := installSkill(cfg, name, source)
+	auditAction(cfg, msg, "/skills install", auditArg, err)
+	if len(report.Issues) > 0 {
+		sendText(bot, chatID, report.String())
 	}
-
-	dstName := util.UniqueUploadName(doc.FileName)
-	dstPath := filepath.Join(uploadDir, dstName)
-
-	f, err := bot.GetFile(tgbotapi.FileConfig{FileID: doc.FileID})
 	if err != nil {
-		return "", err
+		sendText(bot, chatID, fmt.Sprintf("skills install failed: %v", err))
+		return
 	}
-	url := f.Link(bot.Token)
+	sendText(bot, chatID, "installed: "+installed)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return "", err
+// skillInstallCaption reports whether a document's caption is "/skills install [name]".
+func skillInstallCaption(bot *tgbotapi.BotAPI, msg *tgbotapi.Message) ([]string, bool) {
+	if msg.Document == nil || msg.MediaGroupID != "" {
+		return nil, false
 	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
+	cmd := splitCommand(msg.Caption)
+	if len(cmd) < 2 || (cmd[1] != "install" && cmd[1] != "add") {
+		return nil, false
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("download failed: %s", resp.Status)
+	name, ok := normalizeCommand(cmd[0], bot.Self.UserName)
+	if !ok || name != "/skills" {
+		return nil, false
 	}
+	cmd[0] = name
+	return cmd, true
+}
 
-	out, err := os.OpenFile(dstPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
-	if err != nil {
-		return "", err
+// handleSkillUpload installs the skill in an uploaded archive or SKILL.md. The
+// download and install run in the background, off the update loop.
+func handleSkillUpload(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config, msg *tgbotapi.Message, cmd []string) {
+	doc := msg.Document
+	if util.ArchiveExt(doc.FileName) == "" && !strings.EqualFold(filepath.Ext(doc.FileName), ".md") {
+		sendText(bot, msg.Chat.ID, "skills install: send a .zip, .tar.gz, .tgz, .tar or SKILL.md file")
+		return
 	}
-	defer out.Close()
+	name := ""
+	if len(cmd) >= 3 {
+		name = cmd[2]
+	}
+	go func() {
+		_, abs, err := downloadUpload(ctx, bot, cfg, msg.Chat.ID, doc.FileID, doc.FileSize, doc.FileName)
+		if err != nil {
+			sendText(bot, msg.Chat.ID, fmt.Sprintf("skills install failed: %v", err))
+			return
+		}
+		runSkillInstall(bot, cfg, msg, name, abs, "upload "+doc.FileName)
+	}()
+}
 
-	var r io.Reader = resp.Body
-	if cfg.MaxUploadBytes > 0 {
-		r = io.LimitReader(resp.Body, cfg.MaxUploadBytes+1)
+// saveAndBuildPrompt saves an uploaded document and returns the prompt and the saved file's absolute path.
+func saveAndBuildPrompt(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config, msg *tgbotapi.Message) (string, string, error) {
+	chatID := msg.Chat.ID
+	doc := msg.Document
+	if doc == nil {
+		return "", "", fmt.Errorf("no document")
 	}
-	n, err := io.Copy(out, r)
+
+	rel, abs, err := downloadUpload(ctx, bot, cfg, chatID, doc.FileID, doc.FileSize, doc.FileName)
 	if err != nil {
-		return "", err
-	}
-	if cfg.MaxUploadBytes > 0 && n > cfg.MaxUploadBytes {
-		return "", fmt.Errorf("file too large: %d bytes (max %d)", n, cfg.MaxUploadBytes)
+		return "", "", err
 	}
 
 	// User-facing confirmation.
-	rel := filepath.ToSlash(filepath.Join(cfg.UploadDir, dstName))
 	sendText(bot, chatID, fmt.Sprintf("saved: %s", rel))
 
-	ext := strings.ToLower(filepath.Ext(dstPath))
+	if cfg.ArchiveExtract && util.ArchiveExt(abs) != "" {
+		p, err := extractUpload(cfg, rel, abs)
+		if err == nil {
+			return p, abs, nil
+		}
+		sendText(bot, chatID, fmt.Sprintf("extract failed: %v", err))
+	}
+
+	ext := strings.ToLower(filepath.Ext(rel))
 	if ext == ".patch" || ext == ".diff" {
-		return fmt.Sprintf("User uploaded a patch file saved at: %s\nPlease read it and summarize what it changes. Do not apply it unless explicitly asked.", rel), nil
+		sendText(bot, chatID, fmt.Sprintf("to apply it: /apply %s", filepath.Base(rel)))
+		return fmt.Sprintf("User uploaded a patch file saved at: %s\nPlease read it and summarize what it changes. Do not apply it unless explicitly asked.", rel), abs, nil
 	}
-	return fmt.Sprintf("User uploaded a file saved at: %s\nPlease read it and use it as context.", rel), nil
+	return fmt.Sprintf("User uploaded a file saved at: %s\nPlease read it and use it as context.", rel), abs, nil
 }
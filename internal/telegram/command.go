@@ -0,0 +1,56 @@
+package telegram
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"mybot/internal/util"
+)
+
+// smartQuotes maps the curly double quotes phone keyboards insert to ASCII.
+var smartQuotes = strings.NewReplacer("“", `"`, "”", `"`, "„", `"`)
+
+// splitCommand splits a command message into words with shell-style quoting,
+// so `/get "my report.pdf"` names one file. Text that does not parse (e.g. a
+// lone apostrophe in "what's new") is split on blanks as before.
+func splitCommand(text string) []string {
+	words, err := util.SplitWords(smartQuotes.Replace(text))
+	if err != nil || len(words) == 0 {
+		return strings.Fields(text)
+	}
+	return words
+}
+
+// commandTail returns the free text after the first n words of a command as
+// typed, keeping line breaks, spacing and curly quotes: it is a prompt, not
+// arguments. Curly quotes delimit words only in the first n, as in
+// splitCommand. A tail that is a single ASCII-quoted string is unquoted.
+func commandTail(text string, n int) string {
+	_, rest, err := util.SplitWordsN(smartQuotes.Replace(text), n)
+	if err != nil {
+		f := strings.Fields(text)
+		if len(f) <= n {
+			return ""
+		}
+		return strings.Join(f[n:], " ")
+	}
+	// The replacer maps rune for rune, so the tail is as many runes of text.
+	rest = lastRunes(text, utf8.RuneCountInString(rest))
+	rest = strings.TrimSpace(rest)
+	if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+		if w, err := util.SplitWords(rest); err == nil && len(w) == 1 {
+			return w[0]
+		}
+	}
+	return rest
+}
+
+// lastRunes returns the last n runes of s.
+func lastRunes(s string, n int) string {
+	i := len(s)
+	for ; n > 0 && i > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(s[:i])
+		i -= size
+	}
+	return s[i:]
+}
@@ -0,0 +1,47 @@
+package telegram
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{`/get "reports/Q1 summary.pdf"`, []string{"/get", "reports/Q1 summary.pdf"}},
+		{`/delete my\ notes.md`, []string{"/delete", "my notes.md"}},
+		{"/get “my file.txt”", []string{"/get", "my file.txt"}},
+		// Unbalanced quotes fall back to plain splitting.
+		{"/schedule add 09:00 what's new", []string{"/schedule", "add", "09:00", "what's", "new"}},
+		{"", nil},
+	} {
+		if got := splitCommand(tc.in); !slices.Equal(got, tc.want) {
+			t.Errorf("splitCommand(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestCommandTail(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"/schedule add 09:00 summarize  the news\nin 3 bullets", 3, "summarize  the news\nin 3 bullets"},
+		{`/schedule add 09:00 "check the build"`, 3, "check the build"},
+		{"/schedule add “09:00 daily” check the build", 3, "check the build"},
+		{"/schedule add 09:00 “check the build”", 3, "“check the build”"},
+		{"/ask it’s “fine”", 1, "it’s “fine”"},
+		{"/schedule add 09:00 say „hallo“ and it's done", 3, "say „hallo“ and it's done"},
+		{`/schedule add 09:00 "a" and "b"`, 3, `"a" and "b"`},
+		{"/schedule add 09:00 what's new", 3, "what's new"},
+		{"/schedule add 每天下午4点提醒我喝水", 2, "每天下午4点提醒我喝水"},
+		{"/schedule add", 2, ""},
+	} {
+		if got := commandTail(tc.in, tc.n); got != tc.want {
+			t.Errorf("commandTail(%q, %d) = %q, want %q", tc.in, tc.n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+	"mybot/internal/util"
+)
+
+const (
+	// Files above progressMinBytes get a progress message, edited at most every progressEvery.
+	progressMinBytes = 5 * 1024 * 1024
+	progressEvery    = 3 * time.Second
+)
+
+// newBotAPI connects to api.telegram.org or to TELEGRAM_API_URL.
+func newBotAPI(cfg config.Config) (*tgbotapi.BotAPI, error) {
+	if cfg.BotAPIURL == "" {
+		return tgbotapi.NewBotAPI(cfg.TelegramToken)
+	}
+	return tgbotapi.NewBotAPIWithAPIEndpoint(cfg.TelegramToken, cfg.BotAPIURL+"/bot%s/%s")
+}
+
+// fileURL is the download URL for a getFile file_path.
+func fileURL(cfg config.Config, token, filePath string) string {
+	if cfg.BotAPIURL == "" {
+		return fmt.Sprintf(tgbotapi.FileEndpoint, token, filePath)
+	}
+	return cfg.BotAPIURL + "/file/bot" + token + "/" + strings.TrimPrefix(filePath, "/")
+}
+
+// sendLimit is the largest file the bot can upload to Telegram.
+func sendLimit(cfg config.Config) int64 {
+	if cfg.BotAPIURL != "" {
+		return 2000 * 1024 * 1024
+	}
+	return 50 * 1024 * 1024
+}
+
+// errPermanent marks download errors that retrying cannot fix.
+type errPermanent struct{ err error }
+
+func (e errPermanent) Error() string { return e.err.Error() }
+func (e errPermanent) Unwrap() error { return e.err }
+
+type fetchOptions struct {
+	Want     int64 // expected size (0 = unknown)
+	Limit    int64 // max bytes accepted (0 = unlimited)
+	Retries  int
+	Backoff  time.Duration // first retry delay, doubled per attempt
+	Progress func(done, total int64)
+}
+
+// fetchFile streams url into dst. Interrupted transfers are resumed with a Range
+// request when the server supports it, otherwise restarted. The result is
+// checked against opts.Want and opts.Limit; on error dst is removed.
+func fetchFile(ctx context.Context, client *http.Client, url, dst string, opts fetchOptions) (int64, error) {
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	n, err := fetchInto(ctx, client, url, out, opts)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		return n, err
+	}
+	return n, nil
+}
+
+func fetchInto(ctx context.Context, client *http.Client, url string, out *os.File, opts fetchOptions) (int64, error) {
+	var n int64
+	backoff := opts.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	var lastErr error
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return n, fmt.Errorf("download: %w (last error: %v)", ctx.Err(), lastErr)
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		got, err := fetchAttempt(ctx, client, url, out, n, opts)
+		n = got
+		if err == nil {
+			if opts.Want > 0 && n != opts.Want {
+				return n, fmt.Errorf("download: size mismatch: got %d bytes, want %d", n, opts.Want)
+			}
+			return n, nil
+		}
+		var perm errPermanent
+		if errors.As(err, &perm) || ctx.Err() != nil {
+			return n, err
+		}
+		lastErr = err
+	}
+	return n, fmt.Errorf("download failed after %d attempts: %v", opts.Retries+1, lastErr)
+}
+
+// fetchAttempt continues the download at offset and returns the new total size.
+func fetchAttempt(ctx context.Context, client *http.Client, url string, out *os.File, offset int64, opts fetchOptions) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return offset, errPermanent{err}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return offset, withoutURL(err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		// Resume where we stopped.
+	case resp.StatusCode == http.StatusOK:
+		// No range support (or fresh start): rewrite from the beginning.
+		if offset > 0 {
+			if err := out.Truncate(0); err != nil {
+				return offset, errPermanent{err}
+			}
+			offset = 0
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 && offset == opts.Want:
+		return offset, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout:
+		return offset, fmt.Errorf("download: %s", resp.Status)
+	default:
+		return offset, errPermanent{fmt.Errorf("download failed: %s", resp.Status)}
+	}
+	if _, err := out.Seek(offset, io.SeekStart); err != nil {
+		return offset, errPermanent{err}
+	}
+
+	total := opts.Want
+	if total == 0 && resp.ContentLength > 0 {
+		total = offset + resp.ContentLength
+	}
+	var r io.Reader = resp.Body
+	if opts.Limit > 0 {
+		r = io.LimitReader(resp.Body, opts.Limit-offset+1)
+	}
+	buf := make([]byte, 64*1024)
+	n := offset
+	for {
+		k, rerr := r.Read(buf)
+		if k > 0 {
+			if _, err := out.Write(buf[:k]); err != nil {
+				return n, errPermanent{err}
+			}
+			n += int64(k)
+			if opts.Limit > 0 && n > opts.Limit {
+				return n, errPermanent{fmt.Errorf("file too large: more than %d bytes", opts.Limit)}
+			}
+			if opts.Progress != nil {
+				opts.Progress(n, total)
+			}
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// copyLocalFile handles a --local Bot API server, where getFile returns a path on this host.
+func copyLocalFile(src, dst string, opts fetchOptions) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, fmt.Errorf("local Bot API file not readable (is the server's data dir shared with the bot?): %w", err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	var r io.Reader = in
+	if opts.Limit > 0 {
+		r = io.LimitReader(in, opts.Limit+1)
+	}
+	n, err := io.Copy(out, r)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	switch {
+	case err != nil:
+	case opts.Limit > 0 && n > opts.Limit:
+		err = fmt.Errorf("file too large: more than %d bytes", opts.Limit)
+	case opts.Want > 0 && n != opts.Want:
+		err = fmt.Errorf("size mismatch: got %d bytes, want %d", n, opts.Want)
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		return n, err
+	}
+	return n, nil
+}
+
+// downloadProgress returns a Progress callback that keeps one status message up to date.
+func downloadProgress(bot *tgbotapi.BotAPI, chatID int64, name string, size int64) func(done, total int64) {
+	if size < progressMinBytes {
+		return nil
+	}
+	// The first status message is sent without waiting for it: the download
+	// goes on, and edits start once its ID is known.
+	var msgID atomic.Int64
+	var started bool
+	var last time.Time
+	return func(done, total int64) {
+		if time.Since(last) < progressEvery && done < total {
+			return
+		}
+		last = time.Now()
+		text := fmt.Sprintf("downloading %s: %s", filepath.Base(name), util.HumanBytes(done))
+		if total > 0 {
+			text = fmt.Sprintf("downloading %s: %d%% (%s / %s)", filepath.Base(name), done*100/total, util.HumanBytes(done), util.HumanBytes(total))
+		}
+		if !started {
+			started = true
+			sent := enqueue(bot, chatID, tgbotapi.NewMessage(chatID, text))
+			go func() {
+				if r := <-sent; r.err == nil {
+					msgID.Store(int64(r.msg.MessageID))
+				}
+			}()
+			return
+		}
+		if id := msgID.Load(); id != 0 {
+			queueMessage(bot, chatID, tgbotapi.NewEditMessageText(chatID, int(id), text))
+		}
+	}
+}
+
+// withoutURL drops the request URL from an HTTP client error: file URLs carry
+// the bot token, and download errors are shown in the chat.
+func withoutURL(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return fmt.Errorf("download: %w", ue.Err)
+	}
+	return err
+}
@@ -0,0 +1,163 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mybot/internal/config"
+)
+
+// flakyServer serves body but cuts the first response off halfway.
+// Range requests are honoured when ranges is true.
+func flakyServer(t *testing.T, body []byte, ranges bool) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		start := 0
+		if rg := r.Header.Get("Range"); ranges && rg != "" {
+			if _, err := fmt.Sscanf(rg, "bytes=%d-", &start); err != nil {
+				t.Errorf("bad range %q", rg)
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(body)-1, len(body)))
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)-start))
+			w.WriteHeader(http.StatusPartialContent)
+		} else {
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+			w.WriteHeader(http.StatusOK)
+		}
+		if n == 1 {
+			_, _ = w.Write(body[:len(body)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		_, _ = w.Write(body[start:])
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestFetchFile_ResumesWithRange(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789"), 10000)
+	for _, ranges := range []bool{true, false} {
+		srv, calls := flakyServer(t, body, ranges)
+		dst := filepath.Join(t.TempDir(), "f")
+		var progressed int64
+		n, err := fetchFile(context.Background(), srv.Client(), srv.URL, dst, fetchOptions{
+			Want:     int64(len(body)),
+			Retries:  2,
+			Backoff:  time.Millisecond,
+			Progress: func(done, total int64) { progressed = done },
+		})
+		if err != nil {
+			t.Fatalf("ranges=%v: %v", ranges, err)
+		}
+		got, _ := os.ReadFile(dst)
+		if n != int64(len(body)) || !bytes.Equal(got, body) || progressed != n {
+			t.Fatalf("ranges=%v: n=%d len=%d progress=%d", ranges, n, len(got), progressed)
+		}
+		if *calls != 2 {
+			t.Fatalf("ranges=%v: calls=%d", ranges, *calls)
+		}
+	}
+}
+
+func TestFetchFile_Failures(t *testing.T) {
+	body := []byte(strings.Repeat("x", 1000))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/busy":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			_, _ = w.Write(body)
+		}
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	opts := fetchOptions{Retries: 2, Backoff: time.Millisecond}
+
+	cases := []struct {
+		name string
+		path string
+		opts fetchOptions
+		want string
+	}{
+		{"not found is not retried", "/missing", opts, "404"},
+		{"server errors are retried", "/busy", opts, "after 3 attempts"},
+		{"size mismatch", "/ok", fetchOptions{Want: 999}, "size mismatch"},
+		{"limit", "/ok", fetchOptions{Limit: 500}, "too large"},
+	}
+	for i, c := range cases {
+		dst := filepath.Join(dir, fmt.Sprint(i))
+		_, err := fetchFile(context.Background(), srv.Client(), srv.URL+c.path, dst, c.opts)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("%s: err=%v", c.name, err)
+		}
+		if _, err := os.Stat(dst); !os.IsNotExist(err) {
+			t.Fatalf("%s: partial file left behind", c.name)
+		}
+	}
+
+	// Transport errors leave out the URL, which holds the bot token.
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	_, err := fetchFile(context.Background(), down.Client(), down.URL+"/file/bot1:secret/a.pdf", filepath.Join(dir, "down"), fetchOptions{})
+	if err == nil || strings.Contains(err.Error(), "1:secret") {
+		t.Fatalf("unreachable server: err=%v", err)
+	}
+}
+
+// A fake self-hosted Bot API server: getMe, getFile and /file/ downloads.
+func TestDownloadUpload_LocalBotAPIServer(t *testing.T) {
+	const token = "123:abc"
+	body := []byte("hello from a big file")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bot" + token + "/getMe":
+			fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"t","username":"t_bot"}}`)
+		case "/bot" + token + "/getFile":
+			fmt.Fprintf(w, `{"ok":true,"result":{"file_id":"F","file_unique_id":"U","file_size":%d,"file_path":"documents/a.txt"}}`, len(body))
+		case "/file/bot" + token + "/documents/a.txt":
+			_, _ = w.Write(body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	cfg := config.Config{
+		TelegramToken:   token,
+		BotAPIURL:       srv.URL,
+		WorkDir:         root,
+		UploadDir:       "uploads",
+		MaxUploadBytes:  1024,
+		DownloadTimeout: 5 * time.Second,
+		DownloadRetries: 1,
+	}
+	bot, err := newBotAPI(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, abs, err := downloadUpload(context.Background(), bot, cfg, 42, "F", 0, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(rel, "uploads/42/") {
+		t.Fatalf("rel = %q", rel)
+	}
+	if got, _ := os.ReadFile(abs); !bytes.Equal(got, body) {
+		t.Fatalf("content = %q", got)
+	}
+}
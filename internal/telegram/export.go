@@ -0,0 +1,111 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+	"mybot/internal/core"
+	"mybot/internal/transcript"
+	"mybot/internal/util"
+)
+
+func sessionPrefix(chatID int64) string {
+	return fmt.Sprintf("chat-%d-", chatID)
+}
+
+// handleExportCmd: /export [md|html] [session_id]
+func handleExportCmd(bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.SessionManager, chatID int64, cmd []string) {
+	format := "md"
+	sid := ""
+	for _, a := range cmd[1:] {
+		switch strings.ToLower(a) {
+		case "md", "markdown":
+			format = "md"
+		case "html":
+			format = "html"
+		default:
+			sid = a
+		}
+	}
+	if sid == "" {
+		s := sessions.Current(chatID)
+		if s == nil {
+			// Fall back to the newest transcript for this chat (e.g. after restart).
+			list, err := transcript.List(cfg.LogDir, sessionPrefix(chatID))
+			if err != nil || len(list) == 0 {
+				sendText(bot, chatID, "export: no session; try /sessions")
+				return
+			}
+			sid = list[0].ID
+		} else {
+			sid = s.SessionID
+		}
+	}
+
+	name, body, err := exportSession(cfg, chatID, sid, format)
+	if err != nil {
+		sendText(bot, chatID, fmt.Sprintf("export failed: %v", err))
+		return
+	}
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: name, Bytes: body})
+	doc.Caption = "session: " + sid
+	deliverAsync(bot, chatID, doc, func(err error) {
+		sendText(bot, chatID, fmt.Sprintf("export send failed: %v", err))
+	})
+}
+
+// exportSession renders a session transcript owned by chatID.
+func exportSession(cfg config.Config, chatID int64, sid, format string) (string, []byte, error) {
+	if util.SafeFilename(sid) != sid || !strings.HasPrefix(sid, sessionPrefix(chatID)) {
+		return "", nil, errors.New("unknown session id")
+	}
+
+	recs, err := transcript.Read(transcript.Path(cfg.LogDir, sid))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return "", nil, err
+		}
+		// Interactive/older sessions only have free-form text logs.
+		raw, lerr := os.ReadFile(transcript.LegacyPath(cfg.LogDir, sid))
+		if lerr != nil {
+			return "", nil, errors.New("transcript not found")
+		}
+		return sid + ".txt", raw, nil
+	}
+	if len(recs) == 0 {
+		return "", nil, errors.New("empty transcript")
+	}
+
+	if format == "html" {
+		return sid + ".html", []byte(transcript.RenderHTML(sid, recs)), nil
+	}
+	return sid + ".md", []byte(transcript.RenderMarkdown(sid, recs)), nil
+}
+
+// handleSessionsCmd lists recent transcripts for this chat so they can be exported.
+func handleSessionsCmd(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64) {
+	list, err := transcript.List(cfg.LogDir, sessionPrefix(chatID))
+	if err != nil {
+		sendText(bot, chatID, fmt.Sprintf("sessions: %v", err))
+		return
+	}
+	if len(list) == 0 {
+		sendText(bot, chatID, "sessions: (empty)")
+		return
+	}
+	if len(list) > 10 {
+		list = list[:10]
+	}
+	var b strings.Builder
+	b.WriteString("sessions:\n")
+	for _, it := range list {
+		b.WriteString(fmt.Sprintf("- %s (%s, %d bytes)\n", it.ID, it.ModTime.Format("2006-01-02 15:04"), it.Size))
+	}
+	b.WriteString("\n/export [md|html] <session_id>")
+	sendText(bot, chatID, b.String())
+}
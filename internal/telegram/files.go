@@ -0,0 +1,360 @@
+package telegram
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+	"mybot/internal/util"
+)
+
+const (
+	// maxPhotoBytes is the sendPhoto limit; larger images go out as documents.
+	maxPhotoBytes = 10 * 1024 * 1024
+
+	// snapshotMaxFiles bounds the WORKDIR walk; bigger trees skip change detection.
+	snapshotMaxFiles = 20000
+	// maxOfferFiles caps the number of buttons offered after one run.
+	maxOfferFiles = 10
+	offerTTL      = 24 * time.Hour
+)
+
+// Directories that are never offered back (VCS metadata, dependency caches).
+var snapshotSkipDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	".venv":        true,
+	"__pycache__":  true,
+}
+
+type fileStamp struct {
+	size int64
+	mod  time.Time
+}
+
+// snapshotWorkdir records size/mtime of regular files under WORKDIR, skipping
+// UPLOAD_DIR and LOG_DIR. It returns nil when the tree is too large to scan.
+func snapshotWorkdir(cfg config.Config) map[string]fileStamp {
+	root, err := filepath.Abs(cfg.WorkDir)
+	if err != nil {
+		return nil
+	}
+	skip := map[string]bool{}
+	if p, err := filepath.Abs(uploadsRoot(cfg)); err == nil {
+		skip[p] = true
+	}
+	if p, err := filepath.Abs(cfg.LogDir); err == nil {
+		skip[p] = true
+	}
+
+	out := map[string]fileStamp{}
+	tooMany := errors.New("too many files")
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable entries are simply not tracked.
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && (snapshotSkipDirs[d.Name()] || skip[path]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if len(out) >= snapshotMaxFiles {
+			return tooMany
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		out[filepath.ToSlash(rel)] = fileStamp{size: info.Size(), mod: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// changedFiles lists files that are new or modified in after, sorted by path.
+func changedFiles(before, after map[string]fileStamp) []string {
+	var out []string
+	for p, a := range after {
+		b, ok := before[p]
+		if !ok || b.size != a.size || !b.mod.Equal(a.mod) {
+			out = append(out, p)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// resolveWorkdirFile maps a user-supplied path to a regular file inside WORKDIR.
+// Relative paths resolve from WORKDIR; symlinks must not point outside it, and
+// other chats' upload areas are off limits.
+func resolveWorkdirFile(cfg config.Config, chatID int64, arg string) (string, string, error) {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return "", "", errors.New("empty path")
+	}
+	rootAbs, err := filepath.Abs(cfg.WorkDir)
+	if err != nil {
+		return "", "", err
+	}
+	if !filepath.IsAbs(arg) {
+		arg = filepath.Join(rootAbs, arg)
+	}
+	targetAbs, err := filepath.Abs(filepath.Clean(arg))
+	if err != nil {
+		return "", "", err
+	}
+	if !withinDir(rootAbs, targetAbs) {
+		return "", "", fmt.Errorf("refusing to read outside workdir: %s", targetAbs)
+	}
+
+	// Re-check after resolving symlinks so a link cannot smuggle out a file.
+	realRoot, err := filepath.EvalSymlinks(rootAbs)
+	if err != nil {
+		return "", "", err
+	}
+	realTarget, err := filepath.EvalSymlinks(targetAbs)
+	if err != nil {
+		return "", "", err
+	}
+	if !withinDir(realRoot, realTarget) {
+		return "", "", fmt.Errorf("refusing to read outside workdir: %s -> %s", targetAbs, realTarget)
+	}
+	if up, err := filepath.EvalSymlinks(uploadsRoot(cfg)); err == nil && up != realRoot && withinDir(up, realTarget) && realTarget != up {
+		// Legacy uploads in the UPLOAD_DIR root are shared; chat folders are not.
+		top, _, _ := strings.Cut(realTarget[len(up)+1:], string(os.PathSeparator))
+		own, _ := filepath.EvalSymlinks(chatUploadsDir(cfg, chatID))
+		if isChatDirName(top) && (own == "" || !withinDir(own, realTarget)) {
+			return "", "", fmt.Errorf("refusing to read another chat's uploads: %s", targetAbs)
+		}
+	}
+	if isPrivateFile(cfg, realTarget) {
+		return "", "", fmt.Errorf("refusing to send mybot's own settings, secrets or logs: %s", targetAbs)
+	}
+	info, err := os.Stat(realTarget)
+	if err != nil {
+		return "", "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", "", fmt.Errorf("not a regular file: %s", targetAbs)
+	}
+	rel, _ := filepath.Rel(rootAbs, targetAbs)
+	return realTarget, filepath.ToSlash(rel), nil
+}
+
+// isPrivateFile reports a file (symlinks resolved) that must not leave the
+// host even when it sits in WORKDIR, as it does in the default layout: any
+// .env, the config and secrets files, and everything under LOG_DIR (audit
+// log, transcripts, session logs).
+func isPrivateFile(cfg config.Config, realTarget string) bool {
+	if filepath.Base(realTarget) == config.DotEnvFile {
+		return true
+	}
+	for _, p := range cfg.SecretFiles() {
+		if realPath(p) == realTarget {
+			return true
+		}
+	}
+	return cfg.LogDir != "" && withinDir(realPath(cfg.LogDir), realTarget)
+}
+
+// realPath is p made absolute with symlinks resolved, as far as it exists.
+func realPath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	if r, err := filepath.EvalSymlinks(abs); err == nil {
+		return r
+	}
+	return abs
+}
+
+// sendWorkdirFile uploads a WORKDIR file: images as photos, everything else as a
+// document. It returns once the file is queued; a failed send is reported to
+// the chat.
+func sendWorkdirFile(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, arg string) error {
+	abs, rel, err := resolveWorkdirFile(cfg, chatID, arg)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("empty file: %s", rel)
+	}
+	if max := sendLimit(cfg); info.Size() > max {
+		return fmt.Errorf("file too large to send: %s (%d bytes, max %d)", rel, info.Size(), max)
+	}
+	if err := checkNoSecrets(abs, rel); err != nil {
+		return err
+	}
+
+	var c tgbotapi.Chattable
+	if isImageName(abs) && info.Size() <= maxPhotoBytes {
+		p := tgbotapi.NewPhoto(chatID, tgbotapi.FilePath(abs))
+		p.Caption = rel
+		c = p
+	} else {
+		d := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(abs))
+		d.Caption = rel
+		c = d
+	}
+	deliverAsync(bot, chatID, c, func(err error) {
+		sendText(bot, chatID, fmt.Sprintf("get failed: %s: %v", rel, err))
+	})
+	return nil
+}
+
+// checkNoSecrets refuses a file that holds the bot token or another
+// registered secret, e.g. a copy of .env under another name.
+func checkNoSecrets(abs, rel string) error {
+	f, err := os.Open(abs)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	found, err := util.ContainsSecret(f)
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("refusing to send %s: it contains the bot token or another secret", rel)
+	}
+	return nil
+}
+
+// handleGetCmd: /get <path>
+func handleGetCmd(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, cmd []string) {
+	if len(cmd) < 2 {
+		sendText(bot, chatID, "usage: /get <path relative to workdir>")
+		return
+	}
+	if err := sendWorkdirFile(bot, cfg, chatID, strings.Join(cmd[1:], " ")); err != nil {
+		sendText(bot, chatID, fmt.Sprintf("get failed: %v", err))
+	}
+}
+
+// File offers: inline buttons only carry 64 bytes of callback data, so paths are
+// kept here and the button holds a short token.
+type fileOffer struct {
+	chatID  int64
+	paths   []string
+	created time.Time
+}
+
+var (
+	offersMu sync.Mutex
+	offers   = map[string]*fileOffer{}
+)
+
+func newOfferToken() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// offerChangedFiles posts the files changed by a run with one send button per file.
+func offerChangedFiles(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	total := len(paths)
+	if len(paths) > maxOfferFiles {
+		paths = paths[:maxOfferFiles]
+	}
+
+	token := newOfferToken()
+	offersMu.Lock()
+	for k, o := range offers {
+		if time.Since(o.created) > offerTTL {
+			delete(offers, k)
+		}
+	}
+	offers[token] = &fileOffer{chatID: chatID, paths: paths, created: time.Now()}
+	offersMu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("files changed in this run:\n")
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, p := range paths {
+		size := ""
+		if info, err := os.Stat(filepath.Join(cfg.WorkDir, filepath.FromSlash(p))); err == nil {
+			size = fmt.Sprintf(" (%d bytes)", info.Size())
+		}
+		b.WriteString(fmt.Sprintf("- %s%s\n", p, size))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📎 "+filepath.Base(p), fmt.Sprintf("get:%s:%d", token, i)),
+		))
+	}
+	if total > len(paths) {
+		b.WriteString(fmt.Sprintf("… and %d more (use /get <path>)\n", total-len(paths)))
+	}
+	if len(paths) > 1 {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("📦 send all", "get:"+token+":all"),
+		))
+	}
+
+	m := tgbotapi.NewMessage(chatID, strings.TrimSpace(b.String()))
+	m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	queueMessage(bot, chatID, m)
+}
+
+// handleGetCallback serves "get:<token>:<index|all>" button presses.
+func handleGetCallback(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, data string) string {
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 {
+		return "bad request"
+	}
+	offersMu.Lock()
+	o := offers[parts[1]]
+	offersMu.Unlock()
+	if o == nil || o.chatID != chatID {
+		return "offer expired; use /get <path>"
+	}
+
+	var paths []string
+	if parts[2] == "all" {
+		paths = o.paths
+	} else {
+		var i int
+		if _, err := fmt.Sscanf(parts[2], "%d", &i); err != nil || i < 0 || i >= len(o.paths) {
+			return "bad request"
+		}
+		paths = []string{o.paths[i]}
+	}
+	for _, p := range paths {
+		if err := sendWorkdirFile(bot, cfg, chatID, p); err != nil {
+			sendText(bot, chatID, fmt.Sprintf("get failed: %v", err))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+package telegram
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"mybot/internal/config"
+	"mybot/internal/util"
+)
+
+func TestResolveWorkdirFile_StaysInsideWorkdir(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	cfg := config.Config{WorkDir: root, UploadDir: "uploads"}
+
+	if err := os.MkdirAll(filepath.Join(root, "out"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "out", "report.md"), []byte("hi"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2"} {
+		if err := os.MkdirAll(filepath.Join(root, "uploads", id), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, "uploads", id, "f.txt"), []byte(id), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret"), filepath.Join(root, "link")); err != nil {
+		t.Skipf("symlink: %v", err)
+	}
+
+	if _, rel, err := resolveWorkdirFile(cfg, 1, "out/report.md"); err != nil || rel != "out/report.md" {
+		t.Fatalf("relative: rel=%q err=%v", rel, err)
+	}
+	if _, _, err := resolveWorkdirFile(cfg, 1, filepath.Join(root, "out", "report.md")); err != nil {
+		t.Fatalf("absolute inside: %v", err)
+	}
+	if _, _, err := resolveWorkdirFile(cfg, 1, "uploads/1/f.txt"); err != nil {
+		t.Fatalf("own upload: %v", err)
+	}
+	for _, bad := range []string{"../x", filepath.Join(outside, "secret"), "link", "out", "", "uploads/2/f.txt"} {
+		if _, _, err := resolveWorkdirFile(cfg, 1, bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestResolveWorkdirFile_RefusesSecrets(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, body string) string {
+		t.Helper()
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	const token = "123456:get-test-token"
+	for _, k := range []string{"TELEGRAM_BOT_TOKEN", "TOKEN_CMD", "SECRETS_FILE", "SECRETS_KEY_FILE", "MYBOT_CONFIG"} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("TELEGRAM_BOT_TOKEN_FILE", write("token.txt", token+"\n"))
+	t.Setenv("TELEGRAM_ALLOWLIST", "1")
+	cfg, err := config.LoadFile(write("mybot.toml", "[telegram]\nhide_status = true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.WorkDir, cfg.LogDir, cfg.UploadDir = root, filepath.Join(root, "logs"), "uploads"
+	util.AddSecret(token)
+
+	write(".env", "TELEGRAM_BOT_TOKEN="+token+"\n")
+	write("app/.env", "DB_PASSWORD=x\n")
+	write("logs/audit.log", "{}\n")
+	write("copy.txt", "token: "+token+"\n")
+	write("notes.md", "fine\n")
+	for link, to := range map[string]string{"notes": ".env", "key": "token.txt", "old-logs": "logs", "app/up": "."} {
+		if err := os.Symlink(filepath.Join(root, to), filepath.Join(root, link)); err != nil {
+			t.Skipf("symlink: %v", err)
+		}
+	}
+
+	for _, bad := range []string{".env", "./app/../.env", "app/.env", "app/up/.env", "notes", "token.txt", "key", "mybot.toml", "logs/audit.log", "old-logs/audit.log"} {
+		if _, _, err := resolveWorkdirFile(cfg, 1, bad); err == nil || !strings.Contains(err.Error(), "refusing") {
+			t.Errorf("/get %s: %v", bad, err)
+		}
+	}
+	if _, _, err := resolveWorkdirFile(cfg, 1, "notes.md"); err != nil {
+		t.Fatalf("/get notes.md: %v", err)
+	}
+	// A copy of the token under another name is caught by its content.
+	if err := sendWorkdirFile(nil, cfg, 1, "copy.txt"); err == nil || !strings.Contains(err.Error(), "contains the bot token") {
+		t.Fatalf("/get copy.txt: %v", err)
+	}
+}
+
+func TestSnapshotWorkdir_ChangedFiles(t *testing.T) {
+	root := t.TempDir()
+	cfg := config.Config{WorkDir: root, UploadDir: "uploads", LogDir: filepath.Join(root, "logs")}
+	write := func(rel, body string) {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("keep.txt", "a")
+	write("edit.txt", "a")
+
+	before := snapshotWorkdir(cfg)
+	write("edit.txt", "ab")
+	write("new/chart.png", "png")
+	write("uploads/in.txt", "ignored")
+	write("logs/x.log", "ignored")
+	write(".git/HEAD", "ignored")
+	// Same size, newer mtime still counts as changed.
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(root, "keep.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	got := changedFiles(before, snapshotWorkdir(cfg))
+	want := []string{"edit.txt", "keep.txt", "new/chart.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("changed = %v, want %v", got, want)
+	}
+}
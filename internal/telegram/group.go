@@ -0,0 +1,141 @@
+package telegram
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+)
+
+func isGroupChat(msg *tgbotapi.Message) bool {
+	return msg.Chat != nil && (msg.Chat.IsGroup() || msg.Chat.IsSuperGroup())
+}
+
+// normalizeCommand strips the "@botname" suffix Telegram adds to commands in groups.
+// ok is false when the command is addressed to a different bot.
+func normalizeCommand(cmd string, botName string) (string, bool) {
+	name, target, found := strings.Cut(cmd, "@")
+	if !found {
+		return cmd, true
+	}
+	if botName != "" && !strings.EqualFold(target, botName) {
+		return name, false
+	}
+	return name, true
+}
+
+// groupTrigger decides whether a non-command group message is meant for the bot
+// and returns the text with the @mention removed.
+// In "all" mode every message is forwarded (the pre-group-mode behaviour).
+func groupTrigger(cfg config.Config, bot *tgbotapi.BotAPI, msg *tgbotapi.Message, text string) (string, bool) {
+	if cfg.GroupTrigger == "all" {
+		return stripMention(text, bot.Self.UserName), true
+	}
+	if msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil && msg.ReplyToMessage.From.ID == bot.Self.ID {
+		return stripMention(text, bot.Self.UserName), true
+	}
+	if bot.Self.UserName != "" && mentionRE(bot.Self.UserName).MatchString(text) {
+		return stripMention(text, bot.Self.UserName), true
+	}
+	return text, false
+}
+
+func mentionRE(botName string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(botName) + `\b`)
+}
+
+func stripMention(text, botName string) string {
+	if botName == "" {
+		return strings.TrimSpace(text)
+	}
+	return strings.TrimSpace(mentionRE(botName).ReplaceAllString(text, ""))
+}
+
+// attributePrompt tells the agent who asked when several people share a group session.
+func attributePrompt(msg *tgbotapi.Message, prompt string) string {
+	if !isGroupChat(msg) || msg.From == nil {
+		return prompt
+	}
+	return fmt.Sprintf("[群聊] 来自 %s (user_id=%d) 的消息：\n%s", displayName(msg.From), msg.From.ID, prompt)
+}
+
+func displayName(u *tgbotapi.User) string {
+	name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	switch {
+	case name != "" && u.UserName != "":
+		return name + " @" + u.UserName
+	case name != "":
+		return name
+	case u.UserName != "":
+		return "@" + u.UserName
+	default:
+		return fmt.Sprintf("%d", u.ID)
+	}
+}
+
+// runOwners records who started the run in flight in each chat. Prompts
+// queue behind each other per session, so a run is registered when it leaves
+// the queue (startRun) and removed when it returns (endRun); a queued prompt
+// never takes over the running one. User 0 is the scheduler.
+type ownedRun struct {
+	id   uint64
+	user int64
+}
+
+var (
+	runOwnersMu sync.Mutex
+	runOwners   = map[int64]ownedRun{}
+	lastRunID   uint64
+)
+
+func startRun(chatID, userID int64) uint64 {
+	runOwnersMu.Lock()
+	defer runOwnersMu.Unlock()
+	lastRunID++
+	runOwners[chatID] = ownedRun{id: lastRunID, user: userID}
+	return lastRunID
+}
+
+// endRun forgets run unless a newer run of the chat replaced it.
+func endRun(chatID int64, run uint64) {
+	runOwnersMu.Lock()
+	defer runOwnersMu.Unlock()
+	if r, ok := runOwners[chatID]; ok && r.id == run {
+		delete(runOwners, chatID)
+	}
+}
+
+// runOwner returns the user who started the chat's current run; ok is false
+// when no run is in flight.
+func runOwner(chatID int64) (user int64, ok bool) {
+	runOwnersMu.Lock()
+	defer runOwnersMu.Unlock()
+	r, ok := runOwners[chatID]
+	return r.user, ok
+}
+
+// runningChats lists the chats with a run in flight.
+func runningChats() []int64 {
+	runOwnersMu.Lock()
+	defer runOwnersMu.Unlock()
+	out := make([]int64, 0, len(runOwners))
+	for id := range runOwners {
+		out = append(out, id)
+	}
+	return out
+}
+
+// canCancel: the user who started the run, or an admin; scheduled runs only
+// an admin. With no run in flight anyone allowed to call /cancel may (e.g. to
+// interrupt an interactive session, whose sends return at once).
+func canCancel(roles *RoleStore, msg *tgbotapi.Message) bool {
+	owner, running := runOwner(msg.Chat.ID)
+	if !running || (owner != 0 && owner == senderID(msg)) {
+		return true
+	}
+	return roles.RoleOf(senderID(msg), msg.Chat.ID) >= RoleAdmin
+}
@@ -0,0 +1,96 @@
+package telegram
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+)
+
+func TestNormalizeCommand(t *testing.T) {
+	cases := []struct {
+		cmd, bot, want string
+		ok             bool
+	}{
+		{"/status", "MyBot", "/status", true},
+		{"/status@MyBot", "MyBot", "/status", true},
+		{"/status@mybot", "MyBot", "/status", true},
+		{"/status@OtherBot", "MyBot", "/status", false},
+		{"/status@OtherBot", "", "/status", true},
+	}
+	for _, c := range cases {
+		got, ok := normalizeCommand(c.cmd, c.bot)
+		if got != c.want || ok != c.ok {
+			t.Errorf("normalizeCommand(%q, %q) = %q, %v; want %q, %v", c.cmd, c.bot, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestGroupTrigger(t *testing.T) {
+	bot := &tgbotapi.BotAPI{Self: tgbotapi.User{ID: 42, UserName: "MyBot"}}
+	mention := config.Config{GroupTrigger: "mention"}
+	replyToBot := &tgbotapi.Message{ReplyToMessage: &tgbotapi.Message{From: &tgbotapi.User{ID: 42}}}
+	replyToUser := &tgbotapi.Message{ReplyToMessage: &tgbotapi.Message{From: &tgbotapi.User{ID: 7}}}
+
+	cases := []struct {
+		name string
+		cfg  config.Config
+		msg  *tgbotapi.Message
+		text string
+		want string
+		ok   bool
+	}{
+		{"plain message", mention, &tgbotapi.Message{}, "hello all", "hello all", false},
+		{"mention", mention, &tgbotapi.Message{}, "@mybot summarize this", "summarize this", true},
+		{"mention of a longer name", mention, &tgbotapi.Message{}, "@MyBotFan hi", "@MyBotFan hi", false},
+		{"reply to the bot", mention, replyToBot, "and then?", "and then?", true},
+		{"reply to a user", mention, replyToUser, "and then?", "and then?", false},
+		{"all mode", config.Config{GroupTrigger: "all"}, &tgbotapi.Message{}, "hi @MyBot ", "hi", true},
+	}
+	for _, c := range cases {
+		got, ok := groupTrigger(c.cfg, bot, c.msg, c.text)
+		if got != c.want || ok != c.ok {
+			t.Errorf("%s: got %q, %v; want %q, %v", c.name, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestCanCancel(t *testing.T) {
+	const chat int64 = -500
+	roles := NewRoleStore(config.Config{
+		LogDir:      t.TempDir(),
+		Allowlist:   map[int64]struct{}{chat: {}},
+		Admins:      map[int64]struct{}{9: {}},
+		DefaultRole: "operator",
+	})
+	from := func(id int64) *tgbotapi.Message {
+		return &tgbotapi.Message{From: &tgbotapi.User{ID: id}, Chat: &tgbotapi.Chat{ID: chat, Type: "supergroup"}}
+	}
+
+	if !canCancel(roles, from(2)) {
+		t.Fatal("no run in flight: any operator may cancel")
+	}
+
+	first := startRun(chat, 1)
+	if !canCancel(roles, from(1)) || canCancel(roles, from(2)) || !canCancel(roles, from(9)) {
+		t.Fatal("run by user 1: only user 1 and admins may cancel")
+	}
+	// User 2's prompt was queued meanwhile; it only takes over once it starts.
+	endRun(chat, first)
+	second := startRun(chat, 2)
+	if canCancel(roles, from(1)) || !canCancel(roles, from(2)) {
+		t.Fatal("run by user 2: user 1 may no longer cancel")
+	}
+	endRun(chat, first) // stale: must not clear the newer run
+	if owner, ok := runOwner(chat); !ok || owner != 2 {
+		t.Fatalf("owner = %d, %v after a stale endRun", owner, ok)
+	}
+	endRun(chat, second)
+
+	scheduled := startRun(chat, 0)
+	defer endRun(chat, scheduled)
+	if canCancel(roles, from(2)) || !canCancel(roles, from(9)) {
+		t.Fatal("scheduled run: only admins may cancel")
+	}
+}
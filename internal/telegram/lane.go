@@ -0,0 +1,57 @@
+package telegram
+
+import "sync"
+
+// Media is handled off the update loop: a download may take up to
+// DOWNLOAD_TIMEOUT and transcription up to STT_TIMEOUT, and meanwhile other
+// chats, and commands such as /cancel in the same chat, must go on. A chat's
+// media and the text prompts sent after it go through one lane per chat,
+// which runs them one at a time in the order they arrived, so a prompt never
+// overtakes the attachment it refers to.
+
+type lane struct {
+	mu      sync.Mutex
+	queue   []func()
+	running bool // a goroutine is draining queue
+}
+
+var (
+	lanesMu sync.Mutex
+	lanes   = map[int64]*lane{}
+)
+
+// inChatOrder runs f in the background after everything queued before it for
+// the chat.
+func inChatOrder(chatID int64, f func()) {
+	lanesMu.Lock()
+	l := lanes[chatID]
+	if l == nil {
+		l = &lane{}
+		lanes[chatID] = l
+	}
+	lanesMu.Unlock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queue = append(l.queue, f)
+	if !l.running {
+		l.running = true
+		go l.run()
+	}
+}
+
+func (l *lane) run() {
+	for {
+		l.mu.Lock()
+		if len(l.queue) == 0 {
+			l.running = false
+			l.mu.Unlock()
+			return
+		}
+		f := l.queue[0]
+		l.queue[0] = nil
+		l.queue = l.queue[1:]
+		l.mu.Unlock()
+		f()
+	}
+}
@@ -0,0 +1,112 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+	"mybot/internal/util"
+)
+
+// Replies above LONG_REPLY_BYTES are posted as a short preview with the full
+// text attached as a document. The last one per chat is kept for /full.
+
+const longReplyPreviewBytes = 1500
+
+func lastReplyPath(cfg config.Config, chatID int64) string {
+	return filepath.Join(cfg.LogDir, "replies", fmt.Sprintf("%d.md", chatID))
+}
+
+func saveLastReply(cfg config.Config, chatID int64, text string) error {
+	p := lastReplyPath(cfg, chatID)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, []byte(text), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// replyPreview cuts text at the last line break before max bytes.
+func replyPreview(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	cut := util.TrimToBytes(text, max)
+	if i := strings.LastIndex(cut, "\n"); i > max/3 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " \n")
+}
+
+// replyFile renders a reply as a Markdown or standalone HTML document.
+func replyFile(text, format string, at time.Time) tgbotapi.FileBytes {
+	name := "reply-" + at.Format("20060102-150405")
+	if format == "html" {
+		body, _ := util.FormatTelegramHTML(text)
+		page := "<!doctype html>\n<html><head><meta charset=\"utf-8\">\n" +
+			"<title>" + html.EscapeString(name) + "</title>\n" +
+			"<style>body{font-family:sans-serif;max-width:860px;margin:2em auto;line-height:1.5;white-space:pre-wrap}" +
+			"pre{background:#f5f5f5;padding:.6em;overflow-x:auto}blockquote{color:#555;border-left:3px solid #ddd;margin:0;padding-left:.8em}</style>\n" +
+			"</head><body>" + body + "</body></html>\n"
+		return tgbotapi.FileBytes{Name: name + ".html", Bytes: []byte(page)}
+	}
+	return tgbotapi.FileBytes{Name: name + ".md", Bytes: []byte(text)}
+}
+
+// sendLongReply posts a preview of text and attaches the whole reply.
+func sendLongReply(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, text string) {
+	if err := saveLastReply(cfg, chatID, text); err != nil {
+		log.Printf("telegram: chat %d: saving long reply: %v", chatID, err)
+	}
+	sendText(bot, chatID, replyPreview(text, longReplyPreviewBytes)+
+		fmt.Sprintf("\n\n… (%s in total; full reply attached, /full sends it again)", util.HumanBytes(int64(len(text)))))
+
+	doc := tgbotapi.NewDocument(chatID, replyFile(text, cfg.LongReplyFormat, time.Now()))
+	deliverAsync(bot, chatID, doc, func(err error) {
+		sendText(bot, chatID, fmt.Sprintf("attaching the full reply failed: %v", err))
+	})
+}
+
+// handleFullCmd: /full [md|html]
+func handleFullCmd(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, cmd []string) {
+	format := cfg.LongReplyFormat
+	if len(cmd) >= 2 {
+		switch strings.ToLower(cmd[1]) {
+		case "md", "markdown":
+			format = "md"
+		case "html":
+			format = "html"
+		default:
+			sendText(bot, chatID, "usage: /full [md|html]")
+			return
+		}
+	}
+	p := lastReplyPath(cfg, chatID)
+	raw, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		sendText(bot, chatID, "full: no long reply yet")
+		return
+	}
+	if err != nil {
+		sendText(bot, chatID, fmt.Sprintf("full: %v", err))
+		return
+	}
+	at := time.Now()
+	if info, err := os.Stat(p); err == nil {
+		at = info.ModTime()
+	}
+	deliverAsync(bot, chatID, tgbotapi.NewDocument(chatID, replyFile(string(raw), format, at)), func(err error) {
+		sendText(bot, chatID, fmt.Sprintf("full: send failed: %v", err))
+	})
+}
@@ -0,0 +1,50 @@
+package telegram
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"mybot/internal/config"
+)
+
+func TestReplyPreview(t *testing.T) {
+	text := strings.Repeat("第一段的内容。\n", 20) + strings.Repeat("x", 2000)
+	got := replyPreview(text, 100)
+	if len(got) > 100 || !strings.HasSuffix(got, "。") {
+		t.Fatalf("preview = %q", got)
+	}
+	if got := replyPreview("short", 100); got != "short" {
+		t.Fatalf("short preview = %q", got)
+	}
+	// No line break: still cut on a rune boundary.
+	if got := replyPreview(strings.Repeat("字", 100), 10); got != "字字字" {
+		t.Fatalf("unbroken preview = %q", got)
+	}
+}
+
+func TestLastReply_SavedPerChat(t *testing.T) {
+	cfg := config.Config{LogDir: t.TempDir()}
+	if err := saveLastReply(cfg, 1, "one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveLastReply(cfg, 1, "two"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(lastReplyPath(cfg, 1)); string(got) != "two" {
+		t.Fatalf("chat 1 = %q", got)
+	}
+	if _, err := os.Stat(lastReplyPath(cfg, 2)); !os.IsNotExist(err) {
+		t.Fatalf("chat 2 should have no reply: %v", err)
+	}
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	f := replyFile("# T\n**b**", "html", at)
+	if f.Name != "reply-20260102-030405.html" || !strings.Contains(string(f.Bytes), "<b>T</b>") {
+		t.Fatalf("html file = %s %q", f.Name, f.Bytes)
+	}
+	if f := replyFile("x", "md", at); f.Name != "reply-20260102-030405.md" || string(f.Bytes) != "x" {
+		t.Fatalf("md file = %s %q", f.Name, f.Bytes)
+	}
+}
@@ -0,0 +1,297 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+	"mybot/internal/core"
+	"mybot/internal/util"
+)
+
+// mediaGroupWait is how long we wait for more items of a Telegram album.
+var mediaGroupWait = 1500 * time.Millisecond
+
+func hasMedia(msg *tgbotapi.Message) bool {
+	return msg.Document != nil || len(msg.Photo) > 0 || msg.Voice != nil || msg.Audio != nil ||
+		msg.Video != nil || msg.VideoNote != nil || msg.Animation != nil || msg.Sticker != nil
+}
+
+func isImageName(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".webp", ".gif":
+		return true
+	}
+	return false
+}
+
+// handleMedia saves the attachments of one message (or one album) and sends a
+// single prompt. Images are passed to the agent as attachments; voice/audio are
+// transcribed when STT_CMD is configured. It runs in the chat's lane (see
+// inChatOrder), off the update loop.
+func handleMedia(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.SessionManager, roles *RoleStore, msgs []*tgbotapi.Message) {
+	first := msgs[0]
+	chatID := first.Chat.ID
+
+	// Albums usually carry the caption on one item only.
+	caption := ""
+	for _, m := range msgs {
+		if strings.TrimSpace(m.Caption) != "" {
+			caption = m.Caption
+			first = m
+			break
+		}
+	}
+	if isGroupChat(first) {
+		c, ok := groupTrigger(cfg, bot, first, caption)
+		if !ok {
+			return
+		}
+		caption = c
+	}
+	if !authorize(bot, roles, first, nil) {
+		return
+	}
+
+	var prompts []string
+	var images []string
+	for _, m := range msgs {
+		p, imgs, err := saveMedia(ctx, bot, cfg, m)
+		if err != nil {
+			sendText(bot, chatID, fmt.Sprintf("file save failed: %v", err))
+			continue
+		}
+		prompts = append(prompts, p)
+		images = append(images, imgs...)
+	}
+	if len(prompts) == 0 {
+		return
+	}
+
+	prompt := strings.Join(prompts, "\n\n")
+	if strings.TrimSpace(caption) != "" {
+		prompt += "\n\nUser caption:\n" + caption
+	}
+	runPrompt(ctx, bot, cfg, sessions, chatID, senderID(first), attributePrompt(first, prompt), images...)
+}
+
+// saveMedia downloads one attachment and returns its prompt fragment and image paths.
+func saveMedia(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config, msg *tgbotapi.Message) (string, []string, error) {
+	chatID := msg.Chat.ID
+	save := func(fileID string, size int, name string) (string, string, error) {
+		rel, abs, err := downloadUpload(ctx, bot, cfg, chatID, fileID, size, name)
+		if err != nil {
+			return "", "", err
+		}
+		sendText(bot, chatID, fmt.Sprintf("saved: %s", rel))
+		return rel, abs, nil
+	}
+
+	switch {
+	case msg.Document != nil:
+		p, abs, err := saveAndBuildPrompt(ctx, bot, cfg, msg)
+		if err != nil {
+			return "", nil, err
+		}
+		if isImageName(abs) {
+			return p, []string{abs}, nil
+		}
+		return p, nil, nil
+
+	case len(msg.Photo) > 0:
+		// Telegram sends several sizes; the last one is the largest.
+		ph := msg.Photo[len(msg.Photo)-1]
+		rel, abs, err := save(ph.FileID, ph.FileSize, "photo_"+ph.FileUniqueID+".jpg")
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("User sent a photo saved at: %s (attached as image).", rel), []string{abs}, nil
+
+	case msg.Voice != nil:
+		rel, abs, err := save(msg.Voice.FileID, msg.Voice.FileSize, "voice_"+msg.Voice.FileUniqueID+".ogg")
+		if err != nil {
+			return "", nil, err
+		}
+		return audioPrompt(ctx, bot, cfg, chatID, "a voice message", rel, abs), nil, nil
+
+	case msg.Audio != nil:
+		name := msg.Audio.FileName
+		if name == "" {
+			name = "audio_" + msg.Audio.FileUniqueID + ".mp3"
+		}
+		rel, abs, err := save(msg.Audio.FileID, msg.Audio.FileSize, name)
+		if err != nil {
+			return "", nil, err
+		}
+		return audioPrompt(ctx, bot, cfg, chatID, "an audio file", rel, abs), nil, nil
+
+	case msg.Video != nil:
+		name := msg.Video.FileName
+		if name == "" {
+			name = "video_" + msg.Video.FileUniqueID + ".mp4"
+		}
+		rel, _, err := save(msg.Video.FileID, msg.Video.FileSize, name)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("User sent a video (%ds) saved at: %s", msg.Video.Duration, rel), nil, nil
+
+	case msg.VideoNote != nil:
+		rel, _, err := save(msg.VideoNote.FileID, msg.VideoNote.FileSize, "video_note_"+msg.VideoNote.FileUniqueID+".mp4")
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("User sent a round video message (%ds) saved at: %s", msg.VideoNote.Duration, rel), nil, nil
+
+	case msg.Animation != nil:
+		name := msg.Animation.FileName
+		if name == "" {
+			name = "animation_" + msg.Animation.FileUniqueID + ".mp4"
+		}
+		rel, _, err := save(msg.Animation.FileID, msg.Animation.FileSize, name)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("User sent a GIF/animation saved at: %s", rel), nil, nil
+
+	case msg.Sticker != nil:
+		st := msg.Sticker
+		if st.IsAnimated {
+			// Lottie (.tgs) stickers are not images; the emoji carries the meaning.
+			return fmt.Sprintf("User sent an animated sticker: %s", st.Emoji), nil, nil
+		}
+		// Video stickers are .webm; this library version has no is_video flag,
+		// so go by the file path Telegram reports.
+		f, err := bot.GetFile(tgbotapi.FileConfig{FileID: st.FileID})
+		if err != nil {
+			return "", nil, err
+		}
+		name := stickerFileName(st, f.FilePath)
+		rel, abs, err := save(st.FileID, st.FileSize, name)
+		if err != nil {
+			return "", nil, err
+		}
+		if !isImageName(name) {
+			// Like animations: saved for the agent, not attached as an image.
+			return fmt.Sprintf("User sent a video sticker %s saved at: %s", st.Emoji, rel), nil, nil
+		}
+		return fmt.Sprintf("User sent a sticker %s saved at: %s (attached as image).", st.Emoji, rel), []string{abs}, nil
+	}
+	return "", nil, errors.New("unsupported message type")
+}
+
+// stickerFileName names a saved sticker after the extension of its Telegram
+// file path: .webp for static stickers, .webm for video stickers.
+func stickerFileName(st *tgbotapi.Sticker, filePath string) string {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if ext == "" {
+		ext = ".webp"
+	}
+	return "sticker_" + st.FileUniqueID + ext
+}
+
+// audioPrompt describes a saved voice note or audio file, transcribed when
+// STT_CMD is set. Transcription may take up to STT_TIMEOUT; like the download
+// it runs in the chat's lane, never on the update loop.
+func audioPrompt(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, what, rel, abs string) string {
+	if len(cfg.STTCmd) == 0 {
+		return fmt.Sprintf("User sent %s saved at: %s (no transcription available; transcribe it yourself if needed).", what, rel)
+	}
+	text, err := transcribe(ctx, cfg, abs)
+	if err != nil {
+		sendText(bot, chatID, fmt.Sprintf("transcription failed: %v", err))
+		return fmt.Sprintf("User sent %s saved at: %s (transcription failed).", what, rel)
+	}
+	sendText(bot, chatID, "transcript: "+text)
+	return fmt.Sprintf("User sent %s saved at: %s\nTranscription:\n%s", what, rel, text)
+}
+
+// transcribe runs STT_CMD on a local file and returns its stdout.
+// "{file}" in the command is replaced by the path; otherwise the path is appended.
+func transcribe(ctx context.Context, cfg config.Config, path string) (string, error) {
+	args := make([]string, 0, len(cfg.STTCmd)+1)
+	replaced := false
+	for _, a := range cfg.STTCmd {
+		if strings.Contains(a, "{file}") {
+			a = strings.ReplaceAll(a, "{file}", path)
+			replaced = true
+		}
+		args = append(args, a)
+	}
+	if !replaced {
+		args = append(args, path)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.STTTimeout)
+	defer cancel()
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
+	c.Dir = cfg.WorkDir
+	util.SetProcessGroup(c)
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", errors.New(msg)
+	}
+	text := strings.TrimSpace(stdout.String())
+	if text == "" {
+		return "", errors.New("empty transcription")
+	}
+	return text, nil
+}
+
+// Album collection: Telegram delivers each item of a media group as its own
+// message, so we buffer them briefly and handle the group as one prompt.
+type album struct {
+	msgs  []*tgbotapi.Message
+	timer *time.Timer
+}
+
+var (
+	albumsMu sync.Mutex
+	albums   = map[string]*album{}
+)
+
+func collectAlbum(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.SessionManager, roles *RoleStore, msg *tgbotapi.Message) {
+	bufferAlbum(msg, func(msgs []*tgbotapi.Message) {
+		inChatOrder(msg.Chat.ID, func() {
+			handleMedia(ctx, bot, cfg, sessions, roles, msgs)
+		})
+	})
+}
+
+// bufferAlbum adds msg to its album and calls done with all the album's
+// messages once no more arrived for mediaGroupWait.
+func bufferAlbum(msg *tgbotapi.Message, done func([]*tgbotapi.Message)) {
+	key := fmt.Sprintf("%d:%s", msg.Chat.ID, msg.MediaGroupID)
+
+	albumsMu.Lock()
+	defer albumsMu.Unlock()
+	if a := albums[key]; a != nil {
+		a.msgs = append(a.msgs, msg)
+		a.timer.Reset(mediaGroupWait)
+		return
+	}
+	a := &album{msgs: []*tgbotapi.Message{msg}}
+	a.timer = time.AfterFunc(mediaGroupWait, func() {
+		albumsMu.Lock()
+		msgs := a.msgs
+		delete(albums, key)
+		albumsMu.Unlock()
+		done(msgs)
+	})
+	albums[key] = a
+}
@@ -0,0 +1,128 @@
+package telegram
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+)
+
+func TestHasMedia(t *testing.T) {
+	if hasMedia(&tgbotapi.Message{Text: "hi"}) {
+		t.Fatal("text message has no media")
+	}
+	for _, m := range []*tgbotapi.Message{
+		{Document: &tgbotapi.Document{}},
+		{Photo: []tgbotapi.PhotoSize{{}}},
+		{Voice: &tgbotapi.Voice{}},
+		{Sticker: &tgbotapi.Sticker{}},
+		{VideoNote: &tgbotapi.VideoNote{}},
+	} {
+		if !hasMedia(m) {
+			t.Errorf("hasMedia(%+v) = false", m)
+		}
+	}
+}
+
+func TestStickerFileName(t *testing.T) {
+	st := &tgbotapi.Sticker{FileUniqueID: "AbC"}
+	cases := map[string]string{
+		"stickers/file_1.webp": "sticker_AbC.webp",
+		"stickers/file_2.WEBM": "sticker_AbC.webm",
+		"":                     "sticker_AbC.webp",
+	}
+	for path, want := range cases {
+		got := stickerFileName(st, path)
+		if got != want {
+			t.Errorf("stickerFileName(%q) = %q, want %q", path, got, want)
+		}
+	}
+	if !isImageName("sticker_AbC.webp") || isImageName("sticker_AbC.webm") {
+		t.Fatal("only static stickers are attached as images")
+	}
+}
+
+func TestBufferAlbum(t *testing.T) {
+	old := mediaGroupWait
+	mediaGroupWait = 50 * time.Millisecond
+	t.Cleanup(func() { mediaGroupWait = old })
+
+	got := make(chan []*tgbotapi.Message, 4)
+	done := func(msgs []*tgbotapi.Message) { got <- msgs }
+	item := func(chat int64, group string, id int) *tgbotapi.Message {
+		return &tgbotapi.Message{MessageID: id, Chat: &tgbotapi.Chat{ID: chat}, MediaGroupID: group}
+	}
+	bufferAlbum(item(1, "g", 1), done)
+	bufferAlbum(item(2, "g", 2), done) // same group id, other chat: its own album
+	bufferAlbum(item(1, "g", 3), done)
+
+	sizes := map[int64]int{}
+	for range 2 {
+		select {
+		case msgs := <-got:
+			sizes[msgs[0].Chat.ID] = len(msgs)
+		case <-time.After(2 * time.Second):
+			t.Fatal("album not delivered")
+		}
+	}
+	if sizes[1] != 2 || sizes[2] != 1 {
+		t.Fatalf("album sizes = %v", sizes)
+	}
+}
+
+func TestTranscribe(t *testing.T) {
+	cfg := config.Config{WorkDir: t.TempDir(), STTTimeout: 5 * time.Second}
+	ctx := context.Background()
+
+	cfg.STTCmd = []string{"sh", "-c", `echo "heard $0"`, "{file}"}
+	if got, err := transcribe(ctx, cfg, "/tmp/voice.ogg"); err != nil || got != "heard /tmp/voice.ogg" {
+		t.Fatalf("{file}: %q, %v", got, err)
+	}
+	cfg.STTCmd = []string{"echo", "path:"}
+	if got, err := transcribe(ctx, cfg, "/tmp/voice.ogg"); err != nil || got != "path: /tmp/voice.ogg" {
+		t.Fatalf("appended path: %q, %v", got, err)
+	}
+	cfg.STTCmd = []string{"true"}
+	if _, err := transcribe(ctx, cfg, "x"); err == nil || err.Error() != "empty transcription" {
+		t.Fatalf("empty output: %v", err)
+	}
+	cfg.STTCmd = []string{"sh", "-c", "echo model missing >&2; exit 3"}
+	if _, err := transcribe(ctx, cfg, "x"); err == nil || !strings.Contains(err.Error(), "model missing") {
+		t.Fatalf("failure: %v", err)
+	}
+}
+
+func TestInChatOrder(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var got []string
+	add := func(s string) {
+		mu.Lock()
+		got = append(got, s)
+		mu.Unlock()
+	}
+	// A slow download in chat 1 holds back chat 1 only.
+	inChatOrder(1, func() { <-release; add("1:media") })
+	inChatOrder(1, func() { add("1:text") })
+	other := make(chan struct{})
+	inChatOrder(2, func() { add("2:text"); close(other) })
+	select {
+	case <-other:
+	case <-time.After(time.Second):
+		t.Fatal("chat 2 waited for chat 1")
+	}
+	done := make(chan struct{})
+	inChatOrder(1, func() { close(done) })
+	close(release)
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(got, " ") != "2:text 1:media 1:text" {
+		t.Fatalf("ran %q", got)
+	}
+}
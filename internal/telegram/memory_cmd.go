@@ -7,7 +7,6 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
 	"mybot/internal/config"
-	"mybot/internal/util"
 )
 
 func handleMemoryCmd(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, cmd []string) {
@@ -78,5 +77,5 @@ func handleMemoryCmd(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, cmd
 	b.WriteString("- /memory ideas 查看可沉淀为 skills 的方向\n")
 	b.WriteString("- /skillify <name> <ideaIndex> 生成或升级 skill\n")
 
-	sendText(bot, chatID, util.TrimToBytes(b.String(), cfg.MaxChunkBytes))
+	sendText(bot, chatID, b.String())
 }
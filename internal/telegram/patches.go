@@ -0,0 +1,545 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+)
+
+const gitTimeout = time.Minute
+
+// AppliedPatch records how a patch was applied so /revert can undo it.
+type AppliedPatch struct {
+	ChatID    int64     `json:"chat_id"`
+	Patch     string    `json:"patch"` // WORKDIR-relative upload path
+	Mode      string    `json:"mode"`  // "branch" or "inplace"
+	Branch    string    `json:"branch,omitempty"`
+	Orig      string    `json:"orig_branch,omitempty"` // branch name, or a commit SHA when HEAD was detached
+	Detached  bool      `json:"detached,omitempty"`
+	Saved     string    `json:"saved,omitempty"` // copy of the patch in LOG_DIR/patches, reverted from
+	Stash     string    `json:"stash,omitempty"` // stash commit holding local changes, if any
+	AppliedBy int64     `json:"applied_by"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// PatchLog keeps applied patches (newest last) in LOG_DIR/patches.json and
+// a copy of each in LOG_DIR/patches/, so /revert does not depend on the
+// upload still being there unchanged.
+type PatchLog struct {
+	path string
+}
+
+var patchMu sync.Mutex
+
+func NewPatchLog(cfg config.Config) *PatchLog {
+	return &PatchLog{path: filepath.Join(cfg.LogDir, "patches.json")}
+}
+
+func (l *PatchLog) loadLocked() ([]AppliedPatch, error) {
+	b, err := os.ReadFile(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []AppliedPatch
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (l *PatchLog) saveLocked(all []AppliedPatch) error {
+	b, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(filepath.Dir(l.path), 0o755)
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+func (l *PatchLog) Push(p AppliedPatch) error {
+	patchMu.Lock()
+	defer patchMu.Unlock()
+	all, err := l.loadLocked()
+	if err != nil {
+		return err
+	}
+	return l.saveLocked(append(all, p))
+}
+
+// Last returns the newest patch applied in chatID.
+func (l *PatchLog) Last(chatID int64) (*AppliedPatch, error) {
+	patchMu.Lock()
+	defer patchMu.Unlock()
+	all, err := l.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].ChatID == chatID {
+			p := all[i]
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+// Remove drops the newest patch of chatID (after a successful revert).
+func (l *PatchLog) Remove(chatID int64) error {
+	patchMu.Lock()
+	defer patchMu.Unlock()
+	all, err := l.loadLocked()
+	if err != nil {
+		return err
+	}
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].ChatID == chatID {
+			return l.saveLocked(append(all[:i], all[i+1:]...))
+		}
+	}
+	return nil
+}
+
+// savePatch copies patch into LOG_DIR/patches/ and returns the copy's path.
+func savePatch(cfg config.Config, patch string, at time.Time) (string, error) {
+	b, err := os.ReadFile(patch)
+	if err != nil {
+		return "", err
+	}
+	dir, err := filepath.Abs(filepath.Join(cfg.LogDir, "patches"))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	stamp := at.Format("20060102-150405")
+	for i := 1; ; i++ {
+		name := stamp + "_" + filepath.Base(patch)
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d_%s", stamp, i, filepath.Base(patch))
+		}
+		p := filepath.Join(dir, name)
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := f.Write(b); err != nil {
+			_ = f.Close()
+			_ = os.Remove(p)
+			return "", err
+		}
+		if err := f.Close(); err != nil {
+			_ = os.Remove(p)
+			return "", err
+		}
+		return p, nil
+	}
+}
+
+// headRef returns the current branch, or the commit SHA when HEAD is
+// detached (where `rev-parse --abbrev-ref` would only say "HEAD").
+func headRef(dir string) (ref string, detached bool, err error) {
+	if b, err := git(dir, "symbolic-ref", "--short", "-q", "HEAD"); err == nil && b != "" {
+		return b, false, nil
+	}
+	sha, err := git(dir, "rev-parse", "--verify", "HEAD")
+	return sha, true, err
+}
+
+// origName describes where the patch branch started, for replies.
+func (ap AppliedPatch) origName() string {
+	if ap.Detached && len(ap.Orig) > 12 {
+		return "detached " + ap.Orig[:12]
+	}
+	return ap.Orig
+}
+
+// switchBack checks out the branch or commit ap was applied on.
+func switchBack(dir string, ap AppliedPatch) error {
+	args := []string{"switch", ap.Orig}
+	if ap.Detached {
+		args = []string{"switch", "--detach", ap.Orig}
+	}
+	_, err := git(dir, args...)
+	return err
+}
+
+// git runs git in dir and returns trimmed stdout; errors carry stderr.
+func git(dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	c := exec.CommandContext(ctx, "git", args...)
+	c.Dir = dir
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitIdentity supplies a committer identity when the repo has none configured.
+func gitIdentity(dir string) []string {
+	if v, _ := git(dir, "config", "user.email"); v != "" {
+		return nil
+	}
+	return []string{"-c", "user.name=mybot", "-c", "user.email=mybot@localhost"}
+}
+
+// stashPathspec covers WORKDIR minus the bot's own UPLOAD_DIR and LOG_DIR,
+// which must stay in place while the bot runs.
+func stashPathspec(cfg config.Config) []string {
+	spec := []string{"--", "."}
+	for _, d := range []string{uploadsRoot(cfg), cfg.LogDir} {
+		abs, err := filepath.Abs(d)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(cfg.WorkDir, abs)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			continue
+		}
+		// Ignored paths are never stashed, and git rejects them in pathspecs.
+		if _, err := git(cfg.WorkDir, "check-ignore", "-q", filepath.ToSlash(rel)); err == nil {
+			continue
+		}
+		spec = append(spec, ":(exclude)"+filepath.ToSlash(rel))
+	}
+	return spec
+}
+
+// stashLocal stashes uncommitted changes (including untracked files) and
+// returns the stash commit, or "" when the tree was clean.
+func stashLocal(cfg config.Config, dir, reason string) (string, error) {
+	spec := stashPathspec(cfg)
+	st, err := git(dir, append([]string{"status", "--porcelain"}, spec...)...)
+	if err != nil {
+		return "", err
+	}
+	if st == "" {
+		return "", nil
+	}
+	if _, err := git(dir, append([]string{"stash", "push", "--include-untracked", "-m", "mybot: " + reason}, spec...)...); err != nil {
+		return "", err
+	}
+	return git(dir, "rev-parse", "stash@{0}")
+}
+
+// restoreStash pops the stash when it is still on top, otherwise applies it by hash.
+func restoreStash(dir, sha string) error {
+	if sha == "" {
+		return nil
+	}
+	if top, _ := git(dir, "rev-parse", "stash@{0}"); top == sha {
+		_, err := git(dir, "stash", "pop")
+		return err
+	}
+	_, err := git(dir, "stash", "apply", sha)
+	return err
+}
+
+// Pending /apply confirmations, keyed by the token carried in button data.
+type pendingApply struct {
+	chatID  int64
+	patch   string // absolute path
+	created time.Time
+}
+
+var (
+	appliesMu sync.Mutex
+	applies   = map[string]*pendingApply{}
+)
+
+// handleApplyCmd: /apply <upload> — checks the patch, shows a diffstat and asks for confirmation.
+func handleApplyCmd(bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, cmd []string) {
+	if len(cmd) < 2 {
+		sendText(bot, chatID, "usage: /apply <patch-upload-name|path>")
+		return
+	}
+	patch, err := resolveUpload(cfg, chatID, strings.Join(cmd[1:], " "))
+	if err != nil {
+		sendText(bot, chatID, fmt.Sprintf("apply: %v", err))
+		return
+	}
+	if _, err := os.Stat(patch); err != nil {
+		sendText(bot, chatID, fmt.Sprintf("apply: %v", err))
+		return
+	}
+	if _, err := git(cfg.WorkDir, "rev-parse", "--show-toplevel"); err != nil {
+		sendText(bot, chatID, fmt.Sprintf("apply: WORKDIR is not a git repository: %v", err))
+		return
+	}
+	if err := workdirBusy(cfg); err != nil {
+		sendText(bot, chatID, fmt.Sprintf("apply: %v", err))
+		return
+	}
+	if _, err := git(cfg.WorkDir, "apply", "--check", patch); err != nil {
+		sendText(bot, chatID, fmt.Sprintf("apply: patch does not apply cleanly:\n%v", err))
+		return
+	}
+	stat, err := git(cfg.WorkDir, "apply", "--stat", patch)
+	if err != nil {
+		sendText(bot, chatID, fmt.Sprintf("apply: %v", err))
+		return
+	}
+
+	token := newOfferToken()
+	appliesMu.Lock()
+	for k, p := range applies {
+		if time.Since(p.created) > offerTTL {
+			delete(applies, k)
+		}
+	}
+	applies[token] = &pendingApply{chatID: chatID, patch: patch, created: time.Now()}
+	appliesMu.Unlock()
+
+	rel, _ := filepath.Rel(cfg.WorkDir, patch)
+	m := tgbotapi.NewMessage(chatID, fmt.Sprintf("patch %s applies cleanly:\n%s\n\nlocal changes (if any) are stashed first.", filepath.ToSlash(rel), stat))
+	m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🌿 new branch", "apply:"+token+":branch"),
+		tgbotapi.NewInlineKeyboardButtonData("✅ apply here", "apply:"+token+":inplace"),
+		tgbotapi.NewInlineKeyboardButtonData("✖ cancel", "apply:"+token+":cancel"),
+	))
+	queueMessage(bot, chatID, m)
+}
+
+// handleApplyCallback serves "apply:<token>:<branch|inplace|cancel>".
+func handleApplyCallback(bot *tgbotapi.BotAPI, cfg config.Config, msg *tgbotapi.Message, data string) string {
+	chatID := msg.Chat.ID
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 {
+		return "bad request"
+	}
+	appliesMu.Lock()
+	p := applies[parts[1]]
+	if p != nil && p.chatID == chatID {
+		delete(applies, parts[1])
+	}
+	appliesMu.Unlock()
+	if p == nil || p.chatID != chatID {
+		return "confirmation expired; run /apply again"
+	}
+	// Drop the buttons so the same confirmation cannot be used twice.
+	_, _ = bot.Request(tgbotapi.NewEditMessageReplyMarkup(chatID, msg.MessageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+
+	if parts[2] == "cancel" {
+		return "cancelled"
+	}
+	if parts[2] != "branch" && parts[2] != "inplace" {
+		return "bad request"
+	}
+	if err := workdirBusy(cfg); err != nil {
+		sendText(bot, chatID, fmt.Sprintf("apply: %v", err))
+		return "not applied"
+	}
+	ap, err := applyPatch(cfg, p.patch, parts[2])
+	auditAction(cfg, msg, "/apply", ap.Patch+" ("+parts[2]+")", err)
+	if err != nil {
+		sendText(bot, chatID, fmt.Sprintf("apply failed: %v", err))
+		return ""
+	}
+	ap.ChatID = chatID
+	ap.AppliedBy = senderID(msg)
+	if err := NewPatchLog(cfg).Push(ap); err != nil {
+		sendText(bot, chatID, fmt.Sprintf("applied, but recording it for /revert failed: %v", err))
+		return ""
+	}
+	out := fmt.Sprintf("applied: %s", ap.Patch)
+	if ap.Branch != "" {
+		out += fmt.Sprintf("\nbranch: %s (from %s)", ap.Branch, ap.origName())
+	}
+	if ap.Stash != "" {
+		out += fmt.Sprintf("\nlocal changes stashed: %s", ap.Stash[:12])
+	}
+	sendText(bot, chatID, out+"\nundo with /revert")
+	return ""
+}
+
+// applyPatch applies patch either on a new branch (committed) or in place (uncommitted).
+// Local changes are stashed first so the patch lands on a clean tree and /revert is exact.
+func applyPatch(cfg config.Config, patch, mode string) (AppliedPatch, error) {
+	dir := cfg.WorkDir
+	rel, _ := filepath.Rel(dir, patch)
+	ap := AppliedPatch{Patch: filepath.ToSlash(rel), Mode: mode, AppliedAt: time.Now()}
+
+	// Re-check: the tree may have changed since the preview.
+	if _, err := git(dir, "apply", "--check", patch); err != nil {
+		return ap, fmt.Errorf("patch no longer applies cleanly:\n%v", err)
+	}
+	orig, detached, err := headRef(dir)
+	if err != nil {
+		return ap, err
+	}
+	ap.Orig, ap.Detached = orig, detached
+
+	saved, err := savePatch(cfg, patch, ap.AppliedAt)
+	if err != nil {
+		return ap, fmt.Errorf("saving a copy for /revert: %v", err)
+	}
+	ap.Saved = saved
+	// Apply the saved copy: it is exactly what /revert will reverse.
+	patch = saved
+
+	stash, err := stashLocal(cfg, dir, "before applying "+filepath.Base(ap.Patch))
+	if err != nil {
+		_ = os.Remove(saved)
+		return ap, err
+	}
+	ap.Stash = stash
+	undo := func(err error) (AppliedPatch, error) {
+		_ = os.Remove(saved)
+		if rerr := restoreStash(dir, stash); rerr != nil {
+			err = fmt.Errorf("%v (restoring local changes also failed: %v)", err, rerr)
+		}
+		return ap, err
+	}
+
+	if mode == "branch" {
+		ap.Branch = "mybot/patch-" + time.Now().Format("20060102-150405")
+		if _, err := git(dir, "switch", "-c", ap.Branch); err != nil {
+			return undo(err)
+		}
+		if _, err := git(dir, "apply", "--index", patch); err != nil {
+			_ = switchBack(dir, ap)
+			_, _ = git(dir, "branch", "-D", ap.Branch)
+			return undo(err)
+		}
+		args := append(gitIdentity(dir), "commit", "-m", "Apply "+filepath.Base(ap.Patch))
+		if _, err := git(dir, args...); err != nil {
+			_, _ = git(dir, "reset", "--hard")
+			_ = switchBack(dir, ap)
+			_, _ = git(dir, "branch", "-D", ap.Branch)
+			return undo(err)
+		}
+		return ap, nil
+	}
+
+	if _, err := git(dir, "apply", patch); err != nil {
+		return undo(err)
+	}
+	return ap, nil
+}
+
+// workdirBusy refuses to stash, apply or switch branches while codex is
+// working in WORKDIR, from this chat or another one sharing the directory:
+// it would keep editing a tree swapped out under it. Interactive sessions
+// take prompts without waiting for the turn, so only the hand-over counts.
+func workdirBusy(cfg config.Config) error {
+	dir := realPath(cfg.WorkDir)
+	for _, id := range runningChats() {
+		if realPath(cfg.ForChat(id).WorkDir) == dir {
+			return errors.New("codex is running in this working directory; wait for it to finish or /cancel it, then try again")
+		}
+	}
+	return nil
+}
+
+// revertPatch undoes ap and restores stashed local changes.
+func revertPatch(cfg config.Config, ap *AppliedPatch) error {
+	dir := cfg.WorkDir
+	switch ap.Mode {
+	case "branch":
+		cur, err := git(dir, "rev-parse", "--abbrev-ref", "HEAD")
+		if err != nil {
+			return err
+		}
+		if cur == ap.Branch {
+			if st, _ := git(dir, "status", "--porcelain", "--untracked-files=no"); st != "" {
+				return errors.New("uncommitted changes on the patch branch; commit or discard them first")
+			}
+			if err := switchBack(dir, *ap); err != nil {
+				return err
+			}
+		}
+		if _, err := git(dir, "branch", "-D", ap.Branch); err != nil {
+			return err
+		}
+	case "inplace":
+		patch := ap.Saved
+		if patch == "" { // recorded before copies were kept
+			patch = filepath.Join(dir, filepath.FromSlash(ap.Patch))
+		}
+		if _, err := git(dir, "apply", "-R", "--check", patch); err != nil {
+			return fmt.Errorf("patch can no longer be reversed cleanly (files changed since?):\n%v", err)
+		}
+		if _, err := git(dir, "apply", "-R", patch); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown apply mode %q", ap.Mode)
+	}
+	if err := restoreStash(dir, ap.Stash); err != nil {
+		return err
+	}
+	if ap.Saved != "" {
+		_ = os.Remove(ap.Saved)
+	}
+	return nil
+}
+
+// handleRevertCmd: /revert — undo the last patch applied in this chat.
+func handleRevertCmd(bot *tgbotapi.BotAPI, cfg config.Config, msg *tgbotapi.Message) {
+	chatID := msg.Chat.ID
+	l := NewPatchLog(cfg)
+	ap, err := l.Last(chatID)
+	if err != nil {
+		sendText(bot, chatID, fmt.Sprintf("revert: %v", err))
+		return
+	}
+	if ap == nil {
+		sendText(bot, chatID, "revert: nothing applied")
+		return
+	}
+	if err := workdirBusy(cfg); err != nil {
+		sendText(bot, chatID, fmt.Sprintf("revert: %v", err))
+		return
+	}
+	err = revertPatch(cfg, ap)
+	auditAction(cfg, msg, "/revert", ap.Patch+" ("+ap.Mode+")", err)
+	if err != nil {
+		sendText(bot, chatID, fmt.Sprintf("revert failed: %v", err))
+		return
+	}
+	if err := l.Remove(chatID); err != nil {
+		sendText(bot, chatID, fmt.Sprintf("reverted, but updating the patch log failed: %v", err))
+		return
+	}
+	out := fmt.Sprintf("reverted: %s", ap.Patch)
+	if ap.Branch != "" {
+		out += fmt.Sprintf("\nbranch %s deleted, back on %s", ap.Branch, ap.origName())
+	}
+	if ap.Stash != "" {
+		out += "\nlocal changes restored"
+	}
+	sendText(bot, chatID, out)
+}
@@ -0,0 +1,231 @@
+package telegram
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mybot/internal/config"
+)
+
+func initRepo(t *testing.T) config.Config {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	cfg := config.Config{WorkDir: root, UploadDir: "uploads", LogDir: filepath.Join(root, "logs")}
+	mustGit := func(args ...string) {
+		if _, err := git(root, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustGit("init", "-q", "-b", "main")
+	mustGit("config", "user.email", "t@example.com")
+	mustGit("config", "user.name", "t")
+	if err := os.WriteFile(filepath.Join(root, ".gitignore"), []byte("uploads/\nlogs/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mustGit("add", "-A")
+	mustGit("commit", "-q", "-m", "init")
+	return cfg
+}
+
+const testPatch = `diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-one
++two
+`
+
+func writePatch(t *testing.T, cfg config.Config) string {
+	t.Helper()
+	p := filepath.Join(uploadsRoot(cfg), "x.patch")
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(testPatch), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func readA(t *testing.T, cfg config.Config) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(cfg.WorkDir, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestApplyPatch_InplaceRevertRestoresLocalChanges(t *testing.T) {
+	cfg := initRepo(t)
+	patch := writePatch(t, cfg)
+	// An unrelated local edit must survive apply + revert.
+	if err := os.WriteFile(filepath.Join(cfg.WorkDir, "local.txt"), []byte("wip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ap, err := applyPatch(cfg, patch, "inplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readA(t, cfg) != "two\n" || ap.Stash == "" {
+		t.Fatalf("after apply: a=%q stash=%q", readA(t, cfg), ap.Stash)
+	}
+	if err := revertPatch(cfg, &ap); err != nil {
+		t.Fatal(err)
+	}
+	if readA(t, cfg) != "one\n" {
+		t.Fatalf("after revert: a=%q", readA(t, cfg))
+	}
+	if b, err := os.ReadFile(filepath.Join(cfg.WorkDir, "local.txt")); err != nil || string(b) != "wip" {
+		t.Fatalf("local change lost: %q %v", b, err)
+	}
+}
+
+func TestApplyPatch_BranchRevert(t *testing.T) {
+	cfg := initRepo(t)
+	patch := writePatch(t, cfg)
+
+	ap, err := applyPatch(cfg, patch, "branch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur, _ := git(cfg.WorkDir, "rev-parse", "--abbrev-ref", "HEAD"); cur != ap.Branch || ap.Orig != "main" {
+		t.Fatalf("branch: cur=%q ap=%+v", cur, ap)
+	}
+	if err := revertPatch(cfg, &ap); err != nil {
+		t.Fatal(err)
+	}
+	if cur, _ := git(cfg.WorkDir, "rev-parse", "--abbrev-ref", "HEAD"); cur != "main" || readA(t, cfg) != "one\n" {
+		t.Fatalf("after revert: cur=%q a=%q", cur, readA(t, cfg))
+	}
+	if _, err := git(cfg.WorkDir, "rev-parse", "--verify", ap.Branch); err == nil {
+		t.Fatal("patch branch still exists")
+	}
+}
+
+func TestApplyPatch_ConflictLeavesTreeUntouched(t *testing.T) {
+	cfg := initRepo(t)
+	patch := writePatch(t, cfg)
+	if err := os.WriteFile(filepath.Join(cfg.WorkDir, "a.txt"), []byte("changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := applyPatch(cfg, patch, "inplace"); err == nil {
+		t.Fatal("expected conflict")
+	}
+	if readA(t, cfg) != "changed\n" {
+		t.Fatalf("tree modified: %q", readA(t, cfg))
+	}
+}
+
+func TestApplyPatch_KeepsUnignoredUploadsInPlace(t *testing.T) {
+	cfg := initRepo(t)
+	if err := os.Remove(filepath.Join(cfg.WorkDir, ".gitignore")); err != nil {
+		t.Fatal(err)
+	}
+	patch := writePatch(t, cfg)
+	if err := os.WriteFile(filepath.Join(cfg.WorkDir, "local.txt"), []byte("wip"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ap, err := applyPatch(cfg, patch, "inplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(patch); err != nil {
+		t.Fatalf("upload was stashed away: %v", err)
+	}
+	if err := revertPatch(cfg, &ap); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyPatch_RevertUsesSavedCopy(t *testing.T) {
+	cfg := initRepo(t)
+	patch := writePatch(t, cfg)
+	ap, err := applyPatch(cfg, patch, "inplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(ap.Saved) != filepath.Join(cfg.LogDir, "patches") {
+		t.Fatalf("saved = %q", ap.Saved)
+	}
+	// The upload is replaced after applying; /revert must still be exact.
+	if err := os.WriteFile(patch, []byte("garbage\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := revertPatch(cfg, &ap); err != nil {
+		t.Fatal(err)
+	}
+	if readA(t, cfg) != "one\n" {
+		t.Fatalf("after revert: a=%q", readA(t, cfg))
+	}
+	if _, err := os.Stat(ap.Saved); !os.IsNotExist(err) {
+		t.Fatal("saved copy not removed after revert")
+	}
+}
+
+func TestApplyPatch_BranchFromDetachedHead(t *testing.T) {
+	cfg := initRepo(t)
+	patch := writePatch(t, cfg)
+	sha, _ := git(cfg.WorkDir, "rev-parse", "HEAD")
+	if _, err := git(cfg.WorkDir, "switch", "--detach", "HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	ap, err := applyPatch(cfg, patch, "branch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ap.Orig != sha || !ap.Detached {
+		t.Fatalf("orig = %q detached=%v, want %s", ap.Orig, ap.Detached, sha)
+	}
+	if err := revertPatch(cfg, &ap); err != nil {
+		t.Fatal(err)
+	}
+	if head, _ := git(cfg.WorkDir, "rev-parse", "HEAD"); head != sha {
+		t.Fatalf("HEAD = %q, want %s", head, sha)
+	}
+}
+
+func TestWorkdirBusy(t *testing.T) {
+	root, other := t.TempDir(), t.TempDir()
+	for _, k := range []string{"TOKEN_CMD", "TELEGRAM_BOT_TOKEN_FILE", "SECRETS_FILE", "MYBOT_CONFIG"} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("TELEGRAM_BOT_TOKEN", "1:busy")
+	t.Setenv("TELEGRAM_ALLOWLIST", "-7001,-7002")
+	t.Setenv("WORKDIR", root)
+	toml := filepath.Join(t.TempDir(), "mybot.toml")
+	if err := os.WriteFile(toml, []byte("[chat.\"-7002\"]\nworkdir = \""+other+"\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadFile(toml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, own := cfg.ForChat(-7001), cfg.ForChat(-7002)
+	if err := workdirBusy(shared); err != nil {
+		t.Fatalf("idle: %v", err)
+	}
+
+	// A run blocks the directory it works in, whichever chat started it.
+	run := startRun(-7001, 42)
+	if err := workdirBusy(cfg); err == nil || !strings.Contains(err.Error(), "running") {
+		t.Fatalf("during a run: %v", err)
+	}
+	if err := workdirBusy(own); err != nil {
+		t.Fatalf("a chat with its own workdir: %v", err)
+	}
+	endRun(-7001, run)
+	if err := workdirBusy(shared); err != nil {
+		t.Fatalf("after the run: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package telegram
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+	"mybot/internal/metrics"
+)
+
+// ReloadConfig re-reads .env and the config file into live (see config.Live)
+// and logs the outcome; via says what triggered it ("SIGHUP", "/reload").
+// Running sessions are untouched and keep the settings they started with.
+func ReloadConfig(live *config.Live, via string) ([]string, error) {
+	changes, err := live.Reload()
+	if err != nil {
+		metrics.ConfigReloads.Inc("error")
+		log.Printf("reload (%s): keeping the current config: %v", via, err)
+		return nil, err
+	}
+	metrics.ConfigReloads.Inc("ok")
+	if len(changes) == 0 {
+		log.Printf("reload (%s): no changes", via)
+	}
+	for _, c := range changes {
+		log.Printf("reload (%s): %s", via, c)
+	}
+	return changes, nil
+}
+
+// handleReloadCmd: /reload
+func handleReloadCmd(bot *tgbotapi.BotAPI, cfg config.Config, live *config.Live, msg *tgbotapi.Message) {
+	changes, err := ReloadConfig(live, "/reload")
+	var arg string
+	if err == nil {
+		arg = fmt.Sprintf("%d changes", len(changes))
+	}
+	auditAction(cfg, msg, "/reload", arg, err)
+	switch {
+	case err != nil:
+		sendText(bot, msg.Chat.ID, fmt.Sprintf("reload failed, keeping the current config:\n%v", err))
+	case len(changes) == 0:
+		sendText(bot, msg.Chat.ID, "reloaded: no changes")
+	default:
+		sendText(bot, msg.Chat.ID, "reloaded:\n- "+strings.Join(changes, "\n- "))
+	}
+}
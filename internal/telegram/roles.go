@@ -0,0 +1,348 @@
+package telegram
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+)
+
+// Role is a per-user permission level. Higher roles include lower ones.
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleOperator
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+func ParseRole(s string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "viewer":
+		return RoleViewer, nil
+	case "operator", "op":
+		return RoleOperator, nil
+	case "admin":
+		return RoleAdmin, nil
+	case "none":
+		return RoleNone, nil
+	default:
+		return RoleNone, fmt.Errorf("unknown role %q (viewer|operator|admin|none)", s)
+	}
+}
+
+// commandRoles declares the role each command needs.
+// Keys are "/cmd" or "/cmd sub"; the more specific key wins.
+// Free-text prompts, uploads and natural-language actions need promptRole.
+var commandRoles = map[string]Role{
+	"/help":     RoleViewer,
+	"/status":   RoleViewer,
+	"/whoami":   RoleViewer,
+	"/uploads":  RoleViewer,
+	"/memory":   RoleViewer,
+	"/sessions": RoleViewer,
+	"/export":   RoleViewer,
+	"/full":     RoleViewer,
+
+	"/new":           RoleOperator,
+	"/get":           RoleOperator,
+	"/apply":         RoleOperator,
+	"/revert":        RoleOperator,
+	"/cancel":        RoleOperator,
+	"/delete":        RoleOperator,
+	"/uploads clean": RoleOperator,
+	"/rm":            RoleOperator,
+	"/schedule":      RoleOperator,
+	"/schedule ls":   RoleViewer,
+	"/schedule list": RoleViewer,
+
+	"/skills":         RoleViewer,
+	"/skills install": RoleAdmin,
+	"/skills add":     RoleAdmin,
+	"/skills rm":      RoleAdmin,
+	"/skills remove":  RoleAdmin,
+	"/skills delete":  RoleAdmin,
+	"/skills del":     RoleAdmin,
+	"/skills update":  RoleAdmin,
+	"/skills upgrade": RoleAdmin,
+	"/skills pin":     RoleAdmin,
+	"/skills enable":  RoleOperator,
+	"/skills disable": RoleOperator,
+	"/skillify":       RoleAdmin,
+	"/role":           RoleAdmin,
+	"/audit":          RoleAdmin,
+	"/reload":         RoleAdmin,
+}
+
+const promptRole = RoleOperator
+
+func requiredRole(cmd []string) Role {
+	if len(cmd) == 0 {
+		return promptRole
+	}
+	if len(cmd) >= 2 {
+		if r, ok := commandRoles[cmd[0]+" "+strings.ToLower(cmd[1])]; ok {
+			return r
+		}
+	}
+	if r, ok := commandRoles[cmd[0]]; ok {
+		return r
+	}
+	// Unknown commands only get the "try /help" reply.
+	return RoleViewer
+}
+
+// RoleStore persists explicit per-user role grants in LOG_DIR/roles.json.
+type RoleStore struct {
+	path string
+	cfg  config.Config
+
+	mu   sync.Mutex
+	data rolesFile
+}
+
+type rolesFile struct {
+	Users map[string]roleGrant `json:"users"`
+}
+
+type roleGrant struct {
+	Role      string    `json:"role"`
+	GrantedBy int64     `json:"granted_by"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+func NewRoleStore(cfg config.Config) *RoleStore {
+	p := filepath.Join(cfg.LogDir, "roles.json")
+	s := &RoleStore{path: p, cfg: cfg}
+	_ = os.MkdirAll(filepath.Dir(p), 0o755)
+	_ = s.load()
+	return s
+}
+
+// setConfig swaps in a reloaded config (admins, allowlist, default roles).
+func (s *RoleStore) setConfig(cfg config.Config) {
+	s.mu.Lock()
+	s.cfg = cfg
+	s.mu.Unlock()
+}
+
+func (s *RoleStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.data = rolesFile{}
+			return nil
+		}
+		return err
+	}
+	var f rolesFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return err
+	}
+	s.data = f
+	return nil
+}
+
+func (s *RoleStore) saveLocked() error {
+	b, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// RoleOf resolves a user's effective role in a chat:
+// TELEGRAM_ADMINS > explicit grant > owner of an allowlisted private chat (admin) > TELEGRAM_DEFAULT_ROLE.
+// Configured admins are always admins; no grant can demote them.
+func (s *RoleStore) RoleOf(userID, chatID int64) Role {
+	if userID == 0 {
+		return RoleNone
+	}
+	s.mu.Lock()
+	cfg := s.cfg
+	g, ok := s.data.Users[strconv.FormatInt(userID, 10)]
+	s.mu.Unlock()
+	if _, admin := cfg.Admins[userID]; admin {
+		return RoleAdmin
+	}
+	if ok {
+		if r, err := ParseRole(g.Role); err == nil {
+			return r
+		}
+	}
+	// Back-compat: a private chat on the allowlist belongs to its single user.
+	if userID == chatID {
+		if _, ok := cfg.Allowlist[chatID]; ok {
+			return RoleAdmin
+		}
+	}
+	r, err := ParseRole(cfg.ForChat(chatID).DefaultRole)
+	if err != nil {
+		return RoleViewer
+	}
+	return r
+}
+
+func (s *RoleStore) Grant(userID int64, role Role, by int64) error {
+	if userID == 0 {
+		return errors.New("bad user id")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.cfg.Admins[userID]; ok {
+		return fmt.Errorf("%d is in TELEGRAM_ADMINS and always an admin; change the config to change their role", userID)
+	}
+	if s.data.Users == nil {
+		s.data.Users = map[string]roleGrant{}
+	}
+	s.data.Users[strconv.FormatInt(userID, 10)] = roleGrant{Role: role.String(), GrantedBy: by, GrantedAt: time.Now()}
+	return s.saveLocked()
+}
+
+// Revoke removes an explicit grant; the user falls back to the default role.
+func (s *RoleStore) Revoke(userID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strconv.FormatInt(userID, 10)
+	if _, ok := s.data.Users[key]; !ok {
+		return false, nil
+	}
+	delete(s.data.Users, key)
+	return true, s.saveLocked()
+}
+
+func (s *RoleStore) List() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for id, g := range s.data.Users {
+		out = append(out, fmt.Sprintf("%s %s (by %d, %s)", id, g.Role, g.GrantedBy, g.GrantedAt.Format("2006-01-02")))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func senderID(msg *tgbotapi.Message) int64 {
+	if msg.From == nil {
+		return 0
+	}
+	return msg.From.ID
+}
+
+// authorize checks the sender's role against what cmd needs and replies on denial.
+func authorize(bot *tgbotapi.BotAPI, roles *RoleStore, msg *tgbotapi.Message, cmd []string) bool {
+	need := requiredRole(cmd)
+	have := roles.RoleOf(senderID(msg), msg.Chat.ID)
+	if have >= need {
+		return true
+	}
+	what := "this action"
+	if len(cmd) > 0 {
+		what = cmd[0]
+		if len(cmd) >= 2 && commandRoles[cmd[0]+" "+strings.ToLower(cmd[1])] == need {
+			what += " " + cmd[1]
+		}
+	}
+	if have == RoleNone {
+		// Unknown users in allowlisted groups get no reply, same as non-allowlisted chats.
+		return false
+	}
+	sendText(bot, msg.Chat.ID, fmt.Sprintf("permission denied: %s requires %s (you: %s)", what, need, have))
+	return false
+}
+
+// handleRoleCmd: /role ls | grant <user_id> <role> | revoke <user_id>
+// In groups, grant/revoke may also be sent as a reply to the target user's message.
+func handleRoleCmd(bot *tgbotapi.BotAPI, cfg config.Config, roles *RoleStore, msg *tgbotapi.Message, cmd []string) {
+	chatID := msg.Chat.ID
+	usage := "usage:\n/role ls\n/role grant <user_id> <viewer|operator|admin>\n/role revoke <user_id>\n（群里也可回复某人的消息：/role grant operator）"
+	if len(cmd) == 1 || cmd[1] == "ls" || cmd[1] == "list" {
+		lines := roles.List()
+		if len(lines) == 0 {
+			sendText(bot, chatID, "roles: (no explicit grants)")
+			return
+		}
+		sendText(bot, chatID, "roles:\n- "+strings.Join(lines, "\n- "))
+		return
+	}
+
+	args := cmd[2:]
+	var target int64
+	if msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil {
+		target = msg.ReplyToMessage.From.ID
+	}
+	if len(args) > 0 {
+		if id, err := strconv.ParseInt(args[0], 10, 64); err == nil {
+			target = id
+			args = args[1:]
+		}
+	}
+	if target == 0 {
+		sendText(bot, chatID, usage)
+		return
+	}
+
+	switch cmd[1] {
+	case "grant", "set":
+		if len(args) < 1 {
+			sendText(bot, chatID, usage)
+			return
+		}
+		r, err := ParseRole(args[0])
+		if err != nil {
+			sendText(bot, chatID, fmt.Sprintf("role: %v", err))
+			return
+		}
+		err = roles.Grant(target, r, senderID(msg))
+		auditAction(cfg, msg, "/role grant", fmt.Sprintf("%d %s", target, r), err)
+		if err != nil {
+			sendText(bot, chatID, fmt.Sprintf("role grant failed: %v", err))
+			return
+		}
+		sendText(bot, chatID, fmt.Sprintf("role: %d -> %s", target, r))
+	case "revoke", "rm":
+		ok, err := roles.Revoke(target)
+		auditAction(cfg, msg, "/role revoke", fmt.Sprintf("%d", target), err)
+		if err != nil {
+			sendText(bot, chatID, fmt.Sprintf("role revoke failed: %v", err))
+			return
+		}
+		if !ok {
+			sendText(bot, chatID, "role revoke: no explicit grant")
+			return
+		}
+		sendText(bot, chatID, fmt.Sprintf("role: %d revoked (now %s)", target, roles.RoleOf(target, chatID)))
+	default:
+		sendText(bot, chatID, usage)
+	}
+}
@@ -0,0 +1,81 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+
+	"mybot/internal/config"
+)
+
+func TestRequiredRole(t *testing.T) {
+	cases := []struct {
+		cmd  []string
+		want Role
+	}{
+		{nil, RoleOperator},
+		{[]string{"/help"}, RoleViewer},
+		{[]string{"/skills"}, RoleViewer},
+		{[]string{"/skills", "ls"}, RoleViewer},
+		{[]string{"/skills", "install", "https://example.com/x.git"}, RoleAdmin},
+		{[]string{"/skills", "RM", "x"}, RoleAdmin},
+		{[]string{"/schedule"}, RoleOperator},
+		{[]string{"/schedule", "ls"}, RoleViewer},
+		{[]string{"/role", "ls"}, RoleAdmin},
+		{[]string{"/nope"}, RoleViewer},
+	}
+	for _, c := range cases {
+		if got := requiredRole(c.cmd); got != c.want {
+			t.Errorf("requiredRole(%v) = %s, want %s", c.cmd, got, c.want)
+		}
+	}
+}
+
+func TestRoleStore_RoleOf(t *testing.T) {
+	cfg := config.Config{
+		LogDir:      t.TempDir(),
+		Allowlist:   map[int64]struct{}{100: {}, -500: {}},
+		Admins:      map[int64]struct{}{7: {}},
+		DefaultRole: "viewer",
+	}
+	s := NewRoleStore(cfg)
+
+	if got := s.RoleOf(100, 100); got != RoleAdmin {
+		t.Fatalf("private allowlisted owner: got %s", got)
+	}
+	if got := s.RoleOf(100, -500); got != RoleViewer {
+		t.Fatalf("owner in a group: got %s", got)
+	}
+	if got := s.RoleOf(7, -500); got != RoleAdmin {
+		t.Fatalf("configured admin: got %s", got)
+	}
+	if got := s.RoleOf(0, -500); got != RoleNone {
+		t.Fatalf("anonymous sender: got %s", got)
+	}
+
+	if err := s.Grant(42, RoleOperator, 7); err != nil {
+		t.Fatal(err)
+	}
+	// Grants persist across store instances.
+	s2 := NewRoleStore(cfg)
+	if got := s2.RoleOf(42, -500); got != RoleOperator {
+		t.Fatalf("granted operator: got %s", got)
+	}
+	if ok, err := s2.Revoke(42); err != nil || !ok {
+		t.Fatalf("revoke: ok=%v err=%v", ok, err)
+	}
+	if got := s2.RoleOf(42, -500); got != RoleViewer {
+		t.Fatalf("after revoke: got %s", got)
+	}
+
+	// Another admin cannot demote a configured one.
+	if err := s.Grant(7, RoleViewer, 42); err == nil || !strings.Contains(err.Error(), "TELEGRAM_ADMINS") {
+		t.Fatalf("grant to a configured admin: %v", err)
+	}
+	// Nor does a grant left over from before they were configured.
+	s.mu.Lock()
+	s.data.Users["7"] = roleGrant{Role: "viewer"}
+	s.mu.Unlock()
+	if got := s.RoleOf(7, -500); got != RoleAdmin {
+		t.Fatalf("configured admin with a viewer grant: got %s", got)
+	}
+}
@@ -11,7 +11,8 @@ import (
 	"mybot/internal/core"
 )
 
-func handleScheduleCmd(bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.SessionManager, store *ScheduleStore, chatID int64, cmd []string) {
+func handleScheduleCmd(bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.SessionManager, store *ScheduleStore, msg *tgbotapi.Message, cmd []string) {
+	chatID := msg.Chat.ID
 	if store == nil {
 		sendText(bot, chatID, "schedule store not initialized")
 		return
@@ -42,8 +43,9 @@ func handleScheduleCmd(bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.S
 		// 2) /schedule add 每天下午4点提醒我喝水
 		if len(cmd) >= 4 {
 			hhmm := cmd[2]
-			prompt := strings.Join(cmd[3:], " ")
+			prompt := commandTail(msg.Text, 3)
 			task, err := store.UpsertDaily(chatID, hhmm, prompt)
+			auditAction(cfg, msg, "/schedule add", hhmm+" "+prompt, err)
 			if err != nil {
 				sendText(bot, chatID, fmt.Sprintf("schedule add failed: %v", err))
 				return
@@ -53,8 +55,7 @@ func handleScheduleCmd(bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.S
 		}
 
 		if len(cmd) >= 3 {
-			nl := strings.Join(cmd[2:], " ")
-			nl = strings.TrimSpace(nl)
+			nl := commandTail(msg.Text, 2)
 			if nl != "" && !strings.HasPrefix(nl, "每天") {
 				nl = "每天" + nl
 			}
@@ -62,6 +63,7 @@ func handleScheduleCmd(bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.S
 				var ids []string
 				for _, t := range ts {
 					task, err := store.UpsertDaily(chatID, t.HHMM, t.Prompt)
+					auditAction(cfg, msg, "/schedule add", t.HHMM+" "+t.Prompt, err)
 					if err != nil {
 						sendText(bot, chatID, fmt.Sprintf("schedule add failed: %v", err))
 						return
@@ -81,6 +83,7 @@ func handleScheduleCmd(bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.S
 			return
 		}
 		ok, err := store.Remove(chatID, cmd[2])
+		auditAction(cfg, msg, "/schedule rm", cmd[2], auditFound(ok, err))
 		if err != nil {
 			sendText(bot, chatID, fmt.Sprintf("schedule rm failed: %v", err))
 			return
@@ -97,6 +100,7 @@ func handleScheduleCmd(bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.S
 			return
 		}
 		ok, err := store.SetEnabled(chatID, cmd[2], true)
+		auditAction(cfg, msg, "/schedule on", cmd[2], auditFound(ok, err))
 		if err != nil {
 			sendText(bot, chatID, fmt.Sprintf("schedule on failed: %v", err))
 			return
@@ -113,6 +117,7 @@ func handleScheduleCmd(bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.S
 			return
 		}
 		ok, err := store.SetEnabled(chatID, cmd[2], false)
+		auditAction(cfg, msg, "/schedule off", cmd[2], auditFound(ok, err))
 		if err != nil {
 			sendText(bot, chatID, fmt.Sprintf("schedule off failed: %v", err))
 			return
@@ -132,12 +137,8 @@ func handleScheduleCmd(bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.S
 		tasks := store.List(chatID)
 		for _, t := range tasks {
 			if t.ID == cmd[2] {
-				s, err := sessions.Send(context.Background(), chatID, t.Prompt)
-				if err != nil {
-					sendText(bot, chatID, fmt.Sprintf("schedule run failed: %v", err))
-					return
-				}
-				go pumpEvents(bot, cfg, chatID, s)
+				auditAction(cfg, msg, "/schedule run", t.ID, nil)
+				runPrompt(context.Background(), bot, cfg, sessions, chatID, senderID(msg), t.Prompt)
 				return
 			}
 		}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sort"
@@ -17,6 +18,7 @@ import (
 
 	"mybot/internal/config"
 	"mybot/internal/core"
+	"mybot/internal/metrics"
 )
 
 type ScheduleStore struct {
@@ -180,15 +182,19 @@ func (s *ScheduleStore) markRan(id string, ymd string) {
 	}
 }
 
-func RunScheduler(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.SessionManager, store *ScheduleStore) {
+func RunScheduler(ctx context.Context, bot *tgbotapi.BotAPI, live *config.Live, sessions *core.SessionManager, store *ScheduleStore) {
 	ticker := time.NewTicker(20 * time.Second)
 	defer ticker.Stop()
 
+	// task id -> day a miss was already counted, so each miss is reported once.
+	missed := map[string]string{}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			cfg := live.Get()
 			now := time.Now()
 			hhmm := fmt.Sprintf("%02d:%02d", now.Hour(), now.Minute())
 			today := now.Format("2006-01-02")
@@ -197,6 +203,7 @@ func RunScheduler(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config,
 			store.mu.Lock()
 			tasks := append([]ScheduledTask(nil), store.data.Tasks...)
 			store.mu.Unlock()
+			pruneMissed(missed, tasks)
 
 			for _, t := range tasks {
 				if !t.Enabled {
@@ -206,29 +213,59 @@ func RunScheduler(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config,
 				if _, ok := cfg.Allowlist[t.ChatID]; !ok {
 					continue
 				}
-				if t.DailyHHMM != hhmm {
+				if t.LastRunYMD == today {
 					continue
 				}
-				if t.LastRunYMD == today {
+				if t.DailyHHMM != hhmm {
+					if isMissed(t, now) && missed[t.ID] != today {
+						missed[t.ID] = today
+						metrics.SchedulerMisses.Inc()
+						log.Printf("scheduler: missed task id=%s chat_id=%d daily %s", t.ID, t.ChatID, t.DailyHHMM)
+					}
 					continue
 				}
 
 				// mark before running to avoid duplicates if execution is long
 				store.markRan(t.ID, today)
+				metrics.SchedulerFires.Inc()
 
-				go func(task ScheduledTask) {
-					s, err := sessions.Send(ctx, task.ChatID, task.Prompt)
-					if err != nil {
-						sendText(bot, task.ChatID, fmt.Sprintf("schedule run failed: %v", err))
-						return
-					}
-					go pumpEvents(bot, cfg, task.ChatID, s)
-				}(t)
+				runPrompt(ctx, bot, cfg.ForChat(t.ChatID), sessions, t.ChatID, 0, t.Prompt)
 			}
 		}
 	}
 }
 
+// pruneMissed drops entries for tasks that no longer exist, so the map
+// stays as large as the task list.
+func pruneMissed(missed map[string]string, tasks []ScheduledTask) {
+	if len(missed) == 0 {
+		return
+	}
+	live := make(map[string]bool, len(tasks))
+	for _, t := range tasks {
+		live[t.ID] = true
+	}
+	for id := range missed {
+		if !live[id] {
+			delete(missed, id)
+		}
+	}
+}
+
+// isMissed reports whether a task's slot for today has passed without a run
+// (e.g. the process was down or the machine was asleep at that minute).
+func isMissed(t ScheduledTask, now time.Time) bool {
+	h, m, err := parseHHMM(t.DailyHHMM)
+	if err != nil {
+		return false
+	}
+	slot := time.Date(now.Year(), now.Month(), now.Day(), h, m, 0, 0, now.Location())
+	if t.CreatedAt.After(slot) {
+		return false
+	}
+	return now.After(slot.Add(time.Minute))
+}
+
 func parseHHMM(hhmm string) (int, int, error) {
 	hhmm = strings.TrimSpace(hhmm)
 	parts := strings.Split(hhmm, ":")
@@ -0,0 +1,11 @@
+package telegram
+
+import "testing"
+
+func TestPruneMissed(t *testing.T) {
+	missed := map[string]string{"a": "2026-10-18", "gone": "2026-10-17"}
+	pruneMissed(missed, []ScheduledTask{{ID: "a"}, {ID: "b"}})
+	if len(missed) != 1 || missed["a"] != "2026-10-18" {
+		t.Fatalf("missed = %v", missed)
+	}
+}
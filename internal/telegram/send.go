@@ -0,0 +1,282 @@
+package telegram
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/metrics"
+	"mybot/internal/util"
+)
+
+// Outgoing messages go through one queue per chat. A worker per chat sends in
+// order and spaces messages out to stay under Telegram's rate limits (about one
+// message per second in a private chat, 20 per minute in a group, 30 per second
+// overall). Flood-control errors wait out retry_after; HTML that Telegram
+// cannot parse is resent as plain text. Network errors are retried only when
+// the request cannot have reached Telegram, so a message is never sent twice.
+//
+// Queueing never blocks: the update loop must keep going while a chat is
+// rate limited. A chat with outboxMax messages pending drops new ones.
+//
+// Text and captions pass through util.Redact on the way out, so an error that
+// quotes the bot token or a secret does not put it in the chat.
+
+const sendAttempts = 3
+
+var errOutboxFull = errors.New("too many messages queued for this chat")
+
+// Tests shorten these; an outbox keeps the values it was created with, so
+// changing them never races with a running worker.
+var (
+	outboxMax           = 1000
+	privateSendInterval = time.Second
+	groupSendInterval   = 3 * time.Second
+	globalSendInterval  = time.Second / 30
+	sendBackoff         = time.Second
+)
+
+type outgoing struct {
+	c     tgbotapi.Chattable
+	plain string          // plain-text fallback when Telegram rejects the HTML
+	done  chan sendResult // nil: nobody waits for the result
+}
+
+type sendResult struct {
+	msg tgbotapi.Message
+	err error
+}
+
+type outbox struct {
+	bot    *tgbotapi.BotAPI
+	chatID int64
+
+	max            int           // queue limit (outboxMax)
+	interval       time.Duration // between messages to this chat
+	globalInterval time.Duration // between messages to any chat
+	backoff        time.Duration // first network retry delay
+
+	mu      sync.Mutex
+	queue   []outgoing
+	running bool // a worker is draining queue
+
+	last time.Time // worker only
+}
+
+var (
+	outboxMu sync.Mutex
+	outboxes = map[int64]*outbox{}
+
+	globalMu   sync.Mutex
+	globalNext time.Time
+)
+
+func chatOutbox(bot *tgbotapi.BotAPI, chatID int64) *outbox {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	ob := outboxes[chatID]
+	if ob == nil {
+		ob = &outbox{
+			bot:            bot,
+			chatID:         chatID,
+			max:            outboxMax,
+			interval:       privateSendInterval,
+			globalInterval: globalSendInterval,
+			backoff:        sendBackoff,
+		}
+		if chatID < 0 {
+			ob.interval = groupSendInterval
+		}
+		outboxes[chatID] = ob
+	}
+	return ob
+}
+
+// push appends o to the queue, starting a worker if none is running. A full
+// queue fails o at once.
+func (ob *outbox) push(o outgoing) {
+	o.c = redactChattable(o.c)
+	o.plain = util.Redact(o.plain)
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if len(ob.queue) >= ob.max {
+		metrics.SendFailures.Inc("overflow")
+		log.Printf("telegram: chat %d: %v, dropping a message", ob.chatID, errOutboxFull)
+		if o.done != nil {
+			o.done <- sendResult{err: errOutboxFull}
+		}
+		return
+	}
+	ob.queue = append(ob.queue, o)
+	if !ob.running {
+		ob.running = true
+		go ob.run()
+	}
+}
+
+// queueMessage sends c in order with everything else for the chat, without waiting.
+func queueMessage(bot *tgbotapi.BotAPI, chatID int64, c tgbotapi.Chattable) {
+	chatOutbox(bot, chatID).push(outgoing{c: c})
+}
+
+// deliver sends c through the chat's queue and waits for the result; use it
+// when the sent message (e.g. its ID) or the error is needed, and never from
+// the update loop: the wait lasts as long as the chat's backlog.
+func deliver(bot *tgbotapi.BotAPI, chatID int64, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	r := <-enqueue(bot, chatID, c)
+	return r.msg, r.err
+}
+
+// deliverAsync queues c in order like queueMessage and calls failed from
+// another goroutine if it could not be sent.
+func deliverAsync(bot *tgbotapi.BotAPI, chatID int64, c tgbotapi.Chattable, failed func(error)) {
+	done := enqueue(bot, chatID, c)
+	go func() {
+		if r := <-done; r.err != nil {
+			failed(r.err)
+		}
+	}()
+}
+
+func enqueue(bot *tgbotapi.BotAPI, chatID int64, c tgbotapi.Chattable) <-chan sendResult {
+	done := make(chan sendResult, 1)
+	chatOutbox(bot, chatID).push(outgoing{c: c, done: done})
+	return done
+}
+
+func sendText(bot *tgbotapi.BotAPI, chatID int64, text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	// Redact before formatting: HTML escaping could split a secret.
+	body, _ := util.FormatTelegramHTML(util.Redact(text))
+	ob := chatOutbox(bot, chatID)
+	for _, chunk := range util.SplitTelegramHTML(body, util.TelegramMaxText) {
+		m := tgbotapi.NewMessage(chatID, chunk)
+		m.ParseMode = "HTML"
+		ob.push(outgoing{c: m, plain: util.TelegramHTMLToText(chunk)})
+	}
+}
+
+// redactChattable redacts the text or caption of the messages mybot sends.
+func redactChattable(c tgbotapi.Chattable) tgbotapi.Chattable {
+	switch m := c.(type) {
+	case tgbotapi.MessageConfig:
+		m.Text = util.Redact(m.Text)
+		return m
+	case tgbotapi.EditMessageTextConfig:
+		m.Text = util.Redact(m.Text)
+		return m
+	case tgbotapi.DocumentConfig:
+		m.Caption = util.Redact(m.Caption)
+		return m
+	case tgbotapi.PhotoConfig:
+		m.Caption = util.Redact(m.Caption)
+		return m
+	}
+	return c
+}
+
+func (ob *outbox) run() {
+	for {
+		ob.mu.Lock()
+		if len(ob.queue) == 0 {
+			ob.running = false
+			ob.mu.Unlock()
+			return
+		}
+		o := ob.queue[0]
+		ob.queue[0] = outgoing{}
+		ob.queue = ob.queue[1:]
+		ob.mu.Unlock()
+
+		msg, err := ob.send(o)
+		if o.done != nil {
+			o.done <- sendResult{msg, err}
+		}
+	}
+}
+
+func (ob *outbox) send(o outgoing) (tgbotapi.Message, error) {
+	c := o.c
+	plain := false
+	backoff := ob.backoff
+	for attempt := 1; ; attempt++ {
+		ob.pace()
+		msg, err := ob.bot.Send(c)
+		if err == nil {
+			return msg, nil
+		}
+
+		reason := "network"
+		var apiErr *tgbotapi.Error
+		if errors.As(err, &apiErr) {
+			switch {
+			case apiErr.RetryAfter > 0:
+				reason = "flood"
+				if attempt < sendAttempts {
+					metrics.SendRetries.Inc(reason)
+					time.Sleep(time.Duration(apiErr.RetryAfter) * time.Second)
+					continue
+				}
+			case isParseError(apiErr) && o.plain != "" && !plain:
+				metrics.SendRetries.Inc("parse")
+				log.Printf("telegram: chat %d: HTML rejected (%s), resending as plain text", ob.chatID, apiErr.Message)
+				c, plain = tgbotapi.NewMessage(ob.chatID, o.plain), true
+				continue
+			default:
+				reason = "api"
+			}
+		} else if attempt < sendAttempts && notSent(err) {
+			metrics.SendRetries.Inc(reason)
+			time.Sleep(backoff)
+			backoff *= 2
+			continue
+		}
+		metrics.SendFailures.Inc(reason)
+		log.Printf("telegram: chat %d: send failed after %d attempt(s): %v", ob.chatID, attempt, err)
+		return tgbotapi.Message{}, err
+	}
+}
+
+// pace waits until both the chat and the bot as a whole may send again.
+func (ob *outbox) pace() {
+	if wait := time.Until(ob.last.Add(ob.interval)); wait > 0 {
+		time.Sleep(wait)
+	}
+
+	globalMu.Lock()
+	now := time.Now()
+	at := globalNext
+	if at.Before(now) {
+		at = now
+	}
+	globalNext = at.Add(ob.globalInterval)
+	globalMu.Unlock()
+	time.Sleep(time.Until(at))
+
+	ob.last = time.Now()
+}
+
+// notSent reports a network error from before the request reached Telegram
+// (name lookup, connecting). After that, a timeout or reset may hide a
+// message that was delivered, and retrying would send it twice.
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isParseError reports Telegram rejecting the message markup.
+func isParseError(e *tgbotapi.Error) bool {
+	m := strings.ToLower(e.Message)
+	return e.Code == 400 && (strings.Contains(m, "can't parse entities") || strings.Contains(m, "unsupported start tag"))
+}
@@ -0,0 +1,186 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+	"mybot/internal/util"
+)
+
+// fakeSendServer is a Bot API stub whose sendMessage answers come from reply.
+// It records every text it accepted, in order.
+func fakeSendServer(t *testing.T, reply func(call int, r *http.Request) string) (config.Config, *[]string, *sync.Mutex) {
+	t.Helper()
+	const token = "1:send"
+	var mu sync.Mutex
+	var got []string
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bot" + token + "/getMe":
+			fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"t","username":"t_bot"}}`)
+		case "/bot" + token + "/sendMessage":
+			mu.Lock()
+			calls++
+			resp := reply(calls, r)
+			if strings.Contains(resp, `"ok":true`) {
+				got = append(got, r.FormValue("text"))
+			}
+			mu.Unlock()
+			fmt.Fprint(w, resp)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	oldPrivate, oldGlobal := privateSendInterval, globalSendInterval
+	privateSendInterval, globalSendInterval = 0, 0
+	t.Cleanup(func() { privateSendInterval, globalSendInterval = oldPrivate, oldGlobal })
+	// Outboxes keep the bot they were created with; start over with this server's.
+	t.Cleanup(func() {
+		outboxMu.Lock()
+		outboxes = map[int64]*outbox{}
+		outboxMu.Unlock()
+	})
+	return config.Config{TelegramToken: token, BotAPIURL: srv.URL}, &got, &mu
+}
+
+const sentOK = `{"ok":true,"result":{"message_id":7,"date":0,"chat":{"id":1,"type":"private"}}}`
+
+func TestSendText_FallsBackToPlainText(t *testing.T) {
+	cfg, got, mu := fakeSendServer(t, func(call int, r *http.Request) string {
+		if r.FormValue("parse_mode") == "HTML" {
+			return `{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities: Unsupported start tag"}`
+		}
+		return sentOK
+	})
+	bot, err := newBotAPI(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const chatID = 9001
+	sendText(bot, chatID, "**hi** a < b")
+	// deliver queues behind sendText, so once it returns the first message is done.
+	if _, err := deliver(bot, chatID, tgbotapi.NewMessage(chatID, "next")); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"hi a < b", "next"}; strings.Join(*got, "|") != strings.Join(want, "|") {
+		t.Fatalf("sent %q, want %q", *got, want)
+	}
+}
+
+func TestSendText_Redacts(t *testing.T) {
+	cfg, got, mu := fakeSendServer(t, func(call int, r *http.Request) string { return sentOK })
+	bot, err := newBotAPI(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	util.AddSecret("sk-send-test-secret")
+	const chatID = 9005
+	sendText(bot, chatID, "failed: bad key sk-send-test-secret")
+	if _, err := deliver(bot, chatID, tgbotapi.NewMessage(chatID, "again sk-send-test-secret")); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if s := strings.Join(*got, "|"); strings.Contains(s, "sk-send-test-secret") || len(*got) != 2 {
+		t.Fatalf("sent %q", *got)
+	}
+}
+
+func TestDeliver_HonoursRetryAfter(t *testing.T) {
+	cfg, got, mu := fakeSendServer(t, func(call int, r *http.Request) string {
+		if call == 1 {
+			return `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`
+		}
+		return sentOK
+	})
+	bot, err := newBotAPI(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	msg, err := deliver(bot, 9002, tgbotapi.NewMessage(9002, "hello"))
+	if err != nil || msg.MessageID != 7 {
+		t.Fatalf("msg=%+v err=%v", msg, err)
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Fatalf("retried after %v, want >= 1s", d)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(*got) != 1 {
+		t.Fatalf("sent %q", *got)
+	}
+}
+
+func TestDeliver_ReportsPermanentErrors(t *testing.T) {
+	cfg, _, _ := fakeSendServer(t, func(call int, r *http.Request) string {
+		if call > 1 {
+			t.Errorf("permanent error retried (call %d)", call)
+		}
+		return `{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`
+	})
+	bot, err := newBotAPI(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := deliver(bot, 9003, tgbotapi.NewMessage(9003, "x")); err == nil || !strings.Contains(err.Error(), "blocked") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestQueueMessage_NeverBlocks(t *testing.T) {
+	release := make(chan struct{})
+	cfg, _, _ := fakeSendServer(t, func(call int, r *http.Request) string {
+		<-release
+		return sentOK
+	})
+	t.Cleanup(func() { close(release) })
+	old := outboxMax
+	outboxMax = 3
+	t.Cleanup(func() { outboxMax = old })
+	bot, err := newBotAPI(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server holds the first send; everything else must still return at once.
+	const chatID = 9004
+	start := time.Now()
+	for i := range 5 {
+		queueMessage(bot, chatID, tgbotapi.NewMessage(chatID, fmt.Sprint(i)))
+	}
+	if _, err := deliver(bot, chatID, tgbotapi.NewMessage(chatID, "late")); !errors.Is(err, errOutboxFull) {
+		t.Fatalf("deliver on a full queue: %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("queueing blocked for %v", d)
+	}
+}
+
+func TestNotSent(t *testing.T) {
+	wrap := func(op string) error {
+		return &url.Error{Op: "Post", URL: "https://api.telegram.org/bot<redacted>/sendMessage", Err: &net.OpError{Op: op, Net: "tcp", Err: errors.New("x")}}
+	}
+	if !notSent(wrap("dial")) || !notSent(&url.Error{Err: &net.DNSError{Err: "no such host"}}) {
+		t.Fatal("connect and lookup failures are safe to retry")
+	}
+	if notSent(wrap("read")) || notSent(errors.New("context deadline exceeded")) {
+		t.Fatal("a failed read may follow a delivered message")
+	}
+}
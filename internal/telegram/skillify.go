@@ -12,96 +12,382 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
 	"mybot/internal/config"
+	"mybot/internal/core"
+	"mybot/internal/transcript"
 	"mybot/internal/util"
 )
 
-func handleSkillifyCmd(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, cmd []string) {
-	if len(cmd) < 2 {
-		sendText(bot, chatID, "usage: /skillify <name> <ideaIndex>\n例：/skillify ai-news 1\n先用 /memory ideas 查看 ideaIndex")
+const skillifyUsage = "usage: /skillify <name> <ideaIndex>\n" +
+	"      /skillify <name> --from-transcript\n" +
+	"例：/skillify ai-news 1\n先用 /memory ideas 查看 ideaIndex；--from-transcript 从当前对话提炼"
+
+// Transcript excerpts fed to the generator keep the end of the conversation.
+const skillifyTranscriptBytes = 24000
+
+// pendingSkillify is a generated SKILL.md waiting for Apply / Regenerate / Discard.
+type pendingSkillify struct {
+	chatID  int64
+	name    string
+	origin  string // for the audit log: "idea=2" or "transcript=<session>"
+	prompt  string
+	content string
+	created time.Time
+}
+
+var (
+	skillifiesMu sync.Mutex
+	skillifies   = map[string]*pendingSkillify{}
+)
+
+func handleSkillifyCmd(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config, sessions *core.SessionManager, msg *tgbotapi.Message, cmd []string) {
+	chatID := msg.Chat.ID
+	var args []string
+	fromTranscript := false
+	for _, a := range cmd[1:] {
+		if a == "--from-transcript" {
+			fromTranscript = true
+			continue
+		}
+		args = append(args, a)
+	}
+	if len(args) < 1 || (!fromTranscript && len(args) < 2) {
+		sendText(bot, chatID, skillifyUsage)
 		return
 	}
-	name := util.SafeFilename(cmd[1])
-	if name == "" {
+	name := util.SafeFilename(args[0])
+	if name == "" || strings.HasPrefix(name, ".") {
 		sendText(bot, chatID, "skillify: bad name")
 		return
 	}
-	ideaIdx := 0
-	if len(cmd) >= 3 {
-		n, err := strconv.Atoi(cmd[2])
-		if err != nil || n <= 0 {
-			sendText(bot, chatID, "skillify: ideaIndex must be positive integer")
-			return
-		}
-		ideaIdx = n
-	} else {
-		sendText(bot, chatID, "usage: /skillify <name> <ideaIndex>\n例：/skillify ai-news 1\n先用 /memory ideas 查看 ideaIndex")
+	root := skillsRoot(cfg)
+	if root == "" {
+		sendText(bot, chatID, "skillify: SKILLS_DIR not configured")
 		return
 	}
 
-	ms := NewMemoryStore(cfg)
-	mem, err := ms.Get(chatID)
+	mem, err := NewMemoryStore(cfg).Get(chatID)
 	if err != nil {
 		sendText(bot, chatID, fmt.Sprintf("skillify: %v", err))
 		return
 	}
-	if mem == nil || len(mem.SkillIdeas) == 0 {
-		sendText(bot, chatID, "skillify: no ideas; try /memory ideas")
-		return
+	existing, _ := os.ReadFile(filepath.Join(root, name, "SKILL.md"))
+	p := &pendingSkillify{chatID: chatID, name: name}
+
+	if fromTranscript {
+		sid, conv, err := skillifyTranscript(cfg, sessions, chatID)
+		if err != nil {
+			sendText(bot, chatID, fmt.Sprintf("skillify: %v", err))
+			return
+		}
+		p.origin = "transcript=" + sid
+		p.prompt = buildSkillifyPrompt(name, "把下面这段对话中可复用的工作流程提炼成 skill", mem, string(existing), conv)
+	} else {
+		ideaIdx, err := strconv.Atoi(args[1])
+		if err != nil || ideaIdx <= 0 {
+			sendText(bot, chatID, "skillify: ideaIndex must be positive integer")
+			return
+		}
+		if mem == nil || len(mem.SkillIdeas) == 0 {
+			sendText(bot, chatID, "skillify: no ideas; try /memory ideas or /skillify <name> --from-transcript")
+			return
+		}
+		if ideaIdx > len(mem.SkillIdeas) {
+			sendText(bot, chatID, fmt.Sprintf("skillify: ideaIndex out of range (1..%d)", len(mem.SkillIdeas)))
+			return
+		}
+		idea := strings.TrimSpace(mem.SkillIdeas[ideaIdx-1])
+		if idea == "" {
+			sendText(bot, chatID, "skillify: empty idea")
+			return
+		}
+		p.origin = fmt.Sprintf("idea=%d", ideaIdx)
+		p.prompt = buildSkillifyPrompt(name, idea, mem, string(existing), "")
+	}
+
+	sendText(bot, chatID, fmt.Sprintf("skillify: generating %s ...", name))
+	generateSkillify(ctx, bot, cfg, p)
+}
+
+// skillifyTranscript renders the tail of the chat's current session.
+func skillifyTranscript(cfg config.Config, sessions *core.SessionManager, chatID int64) (string, string, error) {
+	sid := ""
+	if s := sessions.Current(chatID); s != nil {
+		sid = s.SessionID
+	} else if list, err := transcript.List(cfg.LogDir, sessionPrefix(chatID)); err == nil && len(list) > 0 {
+		sid = list[0].ID
 	}
-	if ideaIdx < 1 || ideaIdx > len(mem.SkillIdeas) {
-		sendText(bot, chatID, fmt.Sprintf("skillify: ideaIndex out of range (1..%d)", len(mem.SkillIdeas)))
+	if sid == "" {
+		return "", "", errors.New("no conversation yet")
+	}
+	recs, err := transcript.Read(transcript.Path(cfg.LogDir, sid))
+	if err != nil || len(recs) == 0 {
+		return "", "", fmt.Errorf("no transcript for %s", sid)
+	}
+	md := transcript.RenderMarkdown(sid, recs)
+	if len(md) > skillifyTranscriptBytes {
+		cut := len(md) - skillifyTranscriptBytes
+		for cut < len(md) && !utf8.RuneStart(md[cut]) {
+			cut++
+		}
+		md = "…（前面的对话已省略）\n" + md[cut:]
+	}
+	return sid, md, nil
+}
+
+// generateSkillify runs the generator and posts the result for approval.
+func generateSkillify(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config, p *pendingSkillify) {
+	md, err := runCodexOnce(ctx, cfg, p.prompt)
+	if err != nil {
+		sendText(bot, p.chatID, fmt.Sprintf("skillify failed: %v", err))
 		return
 	}
-	idea := strings.TrimSpace(mem.SkillIdeas[ideaIdx-1])
-	if idea == "" {
-		sendText(bot, chatID, "skillify: empty idea")
+	md = strings.TrimSpace(stripCodeFence(md))
+	if md == "" {
+		sendText(bot, p.chatID, "skillify failed: empty output")
 		return
 	}
+	p.content = md + "\n"
+	p.created = time.Now()
 
-	root := skillsRoot(cfg)
-	if root == "" {
-		sendText(bot, chatID, "skillify: SKILLS_DIR not configured")
-		return
+	token := newOfferToken()
+	skillifiesMu.Lock()
+	for k, q := range skillifies {
+		if time.Since(q.created) > offerTTL {
+			delete(skillifies, k)
+		}
 	}
-	dstDir := filepath.Join(root, name)
-	dstFile := filepath.Join(dstDir, "SKILL.md")
-	_ = os.MkdirAll(dstDir, 0o755)
+	skillifies[token] = p
+	skillifiesMu.Unlock()
+
+	dstFile := filepath.Join(skillsRoot(cfg), p.name, "SKILL.md")
+	old, _ := os.ReadFile(dstFile)
+	diff := util.UnifiedDiff("SKILL.md (installed)", "SKILL.md (generated)", string(old), p.content, 3)
+	added, removed := diffStat(diff)
 
-	var existing string
-	if b, err := os.ReadFile(dstFile); err == nil {
-		existing = string(b)
-		if len(existing) > 8000 {
-			existing = existing[:8000]
+	var head string
+	switch {
+	case len(old) == 0:
+		head = fmt.Sprintf("skillify: new skill %s (%d lines)", p.name, added)
+	case diff == "":
+		head = fmt.Sprintf("skillify: %s — generated SKILL.md is identical to the installed one", p.name)
+	default:
+		head = fmt.Sprintf("skillify: %s — +%d −%d lines", p.name, added, removed)
+	}
+	shown := diff
+	if len(old) == 0 {
+		shown = p.content
+	}
+	if shown != "" && len(shown) <= skillifyPreviewBytes {
+		lang := "diff"
+		if len(old) == 0 {
+			lang = "markdown"
+		}
+		sendText(bot, p.chatID, head+"\n"+codeFence(lang, shown))
+	} else {
+		sendText(bot, p.chatID, head)
+		if shown != "" {
+			file := tgbotapi.FileBytes{Name: p.name + "-SKILL.md.diff", Bytes: []byte(shown)}
+			if len(old) == 0 {
+				file.Name = p.name + "-SKILL.md"
+			}
+			queueMessage(bot, p.chatID, tgbotapi.NewDocument(p.chatID, file))
 		}
 	}
 
-	prompt := buildSkillifyPrompt(name, idea, mem, existing)
-	sendText(bot, chatID, fmt.Sprintf("skillify: generating %s ...", name))
+	report := lintSkillMD(p.name, p.content)
+	row := []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData("🔄 regenerate", "skillify:"+token+":regen"),
+		tgbotapi.NewInlineKeyboardButtonData("✖ discard", "skillify:"+token+":discard"),
+	}
+	prompt := "apply it? the current SKILL.md is backed up first."
+	if report.Errors() > 0 {
+		prompt = report.String() + "\n\nthe generated SKILL.md has errors and cannot be applied."
+	} else {
+		if len(report.Issues) > 0 {
+			prompt = report.String() + "\n\n" + prompt
+		}
+		row = append([]tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData("✅ apply", "skillify:"+token+":apply")}, row...)
+	}
+	m := tgbotapi.NewMessage(p.chatID, prompt)
+	m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(row)
+	queueMessage(bot, p.chatID, m)
+}
+
+// Diffs longer than this are attached as a file instead of shown inline.
+const skillifyPreviewBytes = 3000
+
+// codeFence wraps s in a fence longer than any backtick run inside it, so a
+// generated SKILL.md with its own code blocks cannot close the preview early.
+func codeFence(lang, s string) string {
+	f := "```"
+	for strings.Contains(s, f) {
+		f += "`"
+	}
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return f + lang + "\n" + s + f
+}
+
+func diffStat(diff string) (added, removed int) {
+	for _, l := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(l, "+++ "), strings.HasPrefix(l, "--- "):
+		case strings.HasPrefix(l, "+"):
+			added++
+		case strings.HasPrefix(l, "-"):
+			removed++
+		}
+	}
+	return added, removed
+}
 
-	md, err := runCodexOnce(ctx, cfg, prompt)
+// lintSkillMD runs the SKILL.md checks of validateSkill on generated content.
+func lintSkillMD(name, content string) skillReport {
+	var r skillReport
+	dir, err := os.MkdirTemp("", "mybot-skillify-")
 	if err != nil {
-		sendText(bot, chatID, fmt.Sprintf("skillify failed: %v", err))
-		return
+		return r
 	}
-	md = strings.TrimSpace(stripCodeFence(md))
-	if md == "" {
-		sendText(bot, chatID, "skillify failed: empty output")
-		return
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "SKILL.md"), []byte(content), 0o644); err != nil {
+		return r
 	}
+	checkSkillMD(&r, dir, name)
+	return r
+}
 
-	if err := os.WriteFile(dstFile, []byte(md+"\n"), 0o644); err != nil {
-		sendText(bot, chatID, fmt.Sprintf("skillify write failed: %v", err))
-		return
+// handleSkillifyCallback serves "skillify:<token>:<apply|regen|discard>".
+func handleSkillifyCallback(bot *tgbotapi.BotAPI, cfg config.Config, msg *tgbotapi.Message, data string) string {
+	chatID := msg.Chat.ID
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 {
+		return "bad request"
 	}
+	skillifiesMu.Lock()
+	p := skillifies[parts[1]]
+	if p != nil && p.chatID == chatID {
+		delete(skillifies, parts[1])
+	}
+	skillifiesMu.Unlock()
+	if p == nil || p.chatID != chatID {
+		return "expired; run /skillify again"
+	}
+	_, _ = bot.Request(tgbotapi.NewEditMessageReplyMarkup(chatID, msg.MessageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
 
-	sendText(bot, chatID, fmt.Sprintf("installed/updated skill: %s (SKILL.md)\npath: %s", name, dstFile))
+	switch parts[2] {
+	case "discard":
+		return "discarded"
+	case "regen":
+		go generateSkillify(context.Background(), bot, cfg, p)
+		return "regenerating…"
+	case "apply":
+		if lintSkillMD(p.name, p.content).Errors() > 0 {
+			return "the generated SKILL.md has errors"
+		}
+		dstFile, backup, err := writeSkillMD(cfg, p.name, p.content, time.Now())
+		auditAction(cfg, msg, "/skillify", fmt.Sprintf("%s %s -> %s", p.name, p.origin, dstFile), err)
+		if err != nil {
+			sendText(bot, chatID, fmt.Sprintf("skillify write failed: %v", err))
+			return ""
+		}
+		out := fmt.Sprintf("installed/updated skill: %s (SKILL.md)\npath: %s", p.name, dstFile)
+		if backup != "" {
+			out += "\nprevious version: " + filepath.Base(backup)
+		}
+		sendText(bot, chatID, out)
+		return ""
+	}
+	return "bad request"
 }
 
-func buildSkillifyPrompt(name string, idea string, mem *chatMemory, existing string) string {
+// writeSkillMD replaces a skill's SKILL.md, keeping the previous version as
+// SKILL.md.<timestamp> next to it, and records the result in skills.lock. It
+// returns the file and the backup ("" if none).
+func writeSkillMD(cfg config.Config, name, content string, now time.Time) (string, string, error) {
+	dstDir := filepath.Join(skillsRoot(cfg), name)
+	dstFile := filepath.Join(dstDir, "SKILL.md")
+	if err := os.MkdirAll(dstDir, 0o755); err != nil {
+		return dstFile, "", err
+	}
+	backup := ""
+	if old, err := os.ReadFile(dstFile); err == nil {
+		if backup, err = writeBackup(dstFile, old, now); err != nil {
+			return dstFile, "", err
+		}
+	} else if !os.IsNotExist(err) {
+		return dstFile, "", err
+	}
+	tmp := dstFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		return dstFile, backup, err
+	}
+	if err := os.Rename(tmp, dstFile); err != nil {
+		return dstFile, backup, err
+	}
+	if err := recordSkillify(cfg, name, dstDir); err != nil {
+		return dstFile, backup, fmt.Errorf("written but recording it in skills.lock failed: %w", err)
+	}
+	return dstFile, backup, nil
+}
+
+// writeBackup saves old as file.<timestamp>, adding -2, -3, ... when a backup
+// from the same second exists; it never overwrites one.
+func writeBackup(file string, old []byte, now time.Time) (string, error) {
+	stamp := file + "." + now.Format("20060102-150405")
+	for i := 1; ; i++ {
+		p := stamp
+		if i > 1 {
+			p = fmt.Sprintf("%s-%d", stamp, i)
+		}
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = f.Write(old)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(p)
+			return "", err
+		}
+		return p, nil
+	}
+}
+
+// recordSkillify updates skills.lock after /skillify wrote a SKILL.md: a new
+// skill is tracked as written by /skillify; an installed one keeps its source
+// but is marked edited, so update and pin do not overwrite the new SKILL.md.
+func recordSkillify(cfg config.Config, name, dir string) error {
+	h, err := treeHash(dir)
+	if err != nil {
+		return err
+	}
+	// lockEntry also adopts git checkouts installed before skills.lock.
+	e, err := lockEntry(cfg, name, dir)
+	now := time.Now().UTC()
+	if err != nil {
+		e = SkillLock{Source: "/skillify", Kind: "skillify", InstalledAt: now}
+	} else {
+		e.Edited = e.Kind != "skillify"
+		e.UpdatedAt = now
+	}
+	e.Hash = h
+	return NewSkillsLock(cfg).Put(name, e)
+}
+
+func buildSkillifyPrompt(name string, idea string, mem *chatMemory, existing, conversation string) string {
 	var b strings.Builder
 	b.WriteString("你是一个“Codex Skill 作者”。请为我生成一个可直接使用的 SKILL.md（中文），用于 Codex skills。\n")
 	b.WriteString("skill 名称（文件夹名）: " + name + "\n")
@@ -141,6 +427,16 @@ func buildSkillifyPrompt(name string, idea string, mem *chatMemory, existing str
 		}
 	}
 
+	if conversation != "" {
+		b.WriteString("对话记录（从中提炼步骤、约束和踩过的坑；不要照抄具体数据）：\n")
+		b.WriteString("-----BEGIN CONVERSATION-----\n")
+		b.WriteString(conversation)
+		b.WriteString("\n-----END CONVERSATION-----\n\n")
+	}
+
+	if len(existing) > 8000 {
+		existing = util.TrimToBytes(existing, 8000)
+	}
 	if strings.TrimSpace(existing) != "" {
 		b.WriteString("现有 SKILL.md（请在此基础上升级，保持兼容并改进；不要删除有价值的内容）：\n")
 		b.WriteString("-----BEGIN EXISTING-----\n")
@@ -153,6 +449,7 @@ func buildSkillifyPrompt(name string, idea string, mem *chatMemory, existing str
 
 	b.WriteString("硬性要求：\n")
 	b.WriteString("- 只输出 SKILL.md 内容本身，不要额外解释，不要代码块围栏\n")
+	b.WriteString("- 以 front-matter 开头：---、name: " + name + "、description: 一句话说明何时使用、---\n")
 	b.WriteString("- 包含：用途/触发规则/工作流/安全注意/示例（至少 3 个）\n")
 	b.WriteString("- 对于可执行的操作要明确步骤和约束（比如禁止破坏性命令、需要确认等）\n")
 	b.WriteString("- 保持内容可长期维护；必要时加入“版本/更新记录”小节\n")
@@ -183,7 +480,7 @@ func runCodexOnce(ctx context.Context, cfg config.Config, prompt string) (string
 	if cfg.WorkDir != "" && !hasCdFlagLocal(args) {
 		args = append([]string{"--cd", cfg.WorkDir}, args...)
 	}
-	if strings.TrimSpace(os.Getenv("CODEX_ENABLE_SEARCH")) == "1" && !hasFlagLocal(args, "--search") && filepath.Base(cmdPath) == "codex" {
+	if cfg.CodexEnableSearch && !hasFlagLocal(args, "--search") && filepath.Base(cmdPath) == "codex" {
 		args = append([]string{"--search"}, args...)
 	}
 
@@ -0,0 +1,77 @@
+package telegram
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mybot/internal/config"
+)
+
+func TestWriteSkillMD_BacksUp(t *testing.T) {
+	cfg := config.Config{SkillsDir: t.TempDir()}
+	t0 := time.Date(2025, 3, 1, 9, 30, 0, 0, time.Local)
+
+	file, backup, err := writeSkillMD(cfg, "demo", "v1\n", t0)
+	if err != nil || backup != "" {
+		t.Fatalf("first write: backup=%q err=%v", backup, err)
+	}
+	_, backup, err = writeSkillMD(cfg, "demo", "v2\n", t0.Add(time.Minute))
+	if err != nil || filepath.Base(backup) != "SKILL.md.20250301-093100" {
+		t.Fatalf("second write: backup=%q err=%v", backup, err)
+	}
+	if b, _ := os.ReadFile(backup); string(b) != "v1\n" {
+		t.Fatalf("backup holds %q", b)
+	}
+	if b, _ := os.ReadFile(file); string(b) != "v2\n" {
+		t.Fatalf("SKILL.md holds %q", b)
+	}
+	// Same second again: a new backup, the first one is kept.
+	_, again, err := writeSkillMD(cfg, "demo", "v3\n", t0.Add(time.Minute))
+	if err != nil || filepath.Base(again) != "SKILL.md.20250301-093100-2" {
+		t.Fatalf("third write: backup=%q err=%v", again, err)
+	}
+	if b, _ := os.ReadFile(backup); string(b) != "v1\n" {
+		t.Fatalf("first backup overwritten with %q", b)
+	}
+
+	e, ok, err := NewSkillsLock(cfg).Get("demo")
+	if err != nil || !ok || e.Kind != "skillify" || e.Edited {
+		t.Fatalf("lock entry = %+v ok=%v err=%v", e, ok, err)
+	}
+	if h, _ := treeHash(filepath.Dir(file)); h != e.Hash {
+		t.Fatal("lock hash does not match the written skill")
+	}
+	if _, err := updateSkill(cfg, "demo"); err == nil || !strings.Contains(err.Error(), "/skillify") {
+		t.Fatalf("update of a skillify skill: %v", err)
+	}
+}
+
+func TestCodeFence(t *testing.T) {
+	md := "# Demo\n```sh\nmake\n```\n"
+	got := codeFence("markdown", md)
+	if got != "````markdown\n"+md+"````" {
+		t.Fatalf("codeFence = %q", got)
+	}
+	if got := codeFence("diff", "+x"); got != "```diff\n+x\n```" {
+		t.Fatalf("codeFence = %q", got)
+	}
+}
+
+func TestSkillifyPreviewHelpers(t *testing.T) {
+	if a, r := diffStat("--- a\n+++ b\n@@ -1,2 +1,2 @@\n x\n-y\n+z\n+w\n"); a != 2 || r != 1 {
+		t.Fatalf("diffStat = +%d -%d", a, r)
+	}
+	if r := lintSkillMD("demo", goodSkillMD); r.Errors() != 0 {
+		t.Fatalf("good SKILL.md: %s", r)
+	}
+	if r := lintSkillMD("demo", "# Demo\nno front-matter\n"); r.Errors() == 0 {
+		t.Fatal("missing front-matter not reported")
+	}
+	p := buildSkillifyPrompt("demo", "idea", nil, "", "user: deploy the site")
+	if !strings.Contains(p, "BEGIN CONVERSATION") || !strings.Contains(p, "user: deploy the site") || !strings.Contains(p, "name: demo") {
+		t.Fatalf("prompt:\n%s", p)
+	}
+}
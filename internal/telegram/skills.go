@@ -4,11 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"mybot/internal/config"
 	"mybot/internal/util"
@@ -63,51 +65,68 @@ func removeSkill(cfg config.Config, name string) (string, error) {
 	if err := os.RemoveAll(dstAbs); err != nil {
 		return "", err
 	}
+	if err := NewSkillsLock(cfg).Remove(name); err != nil {
+		return name, fmt.Errorf("removed, but updating skills.lock failed: %w", err)
+	}
 	return name, nil
 }
 
-func installSkill(cfg config.Config, name, source string) (string, error) {
+// installSkill stages the skill in a hidden directory, validates it and only
+// then moves it into place; hard validation errors abort the install.
+// See skillSource for the accepted sources.
+func installSkill(cfg config.Config, name, source string) (string, skillReport, error) {
+	var report skillReport
 	root := skillsRoot(cfg)
 	if root == "" {
-		return "", errors.New("skills dir not configured")
+		return "", report, errors.New("skills dir not configured")
 	}
 	if err := os.MkdirAll(root, 0o755); err != nil {
-		return "", err
+		return "", report, err
+	}
+	src, err := parseSkillSource(source)
+	if err != nil {
+		return "", report, err
+	}
+	if name != "" {
+		if name, err = freeSkillName(root, name); err != nil {
+			return "", report, err
+		}
 	}
 
-	source = strings.TrimSpace(source)
-	if source == "" {
-		return "", errors.New("empty source")
+	stage := filepath.Join(root, fmt.Sprintf(".install-%d", time.Now().UnixNano()))
+	defer os.RemoveAll(stage)
+	e, err := stageSkill(src, stage)
+	if err != nil {
+		return "", report, err
 	}
 	if name == "" {
-		name = deriveSkillName(source)
+		if name, err = freeSkillName(root, stagedSkillName(src, stage)); err != nil {
+			return "", report, err
+		}
 	}
-	name = util.SafeFilename(name)
-	if name == "" {
-		return "", errors.New("bad skill name")
+
+	report = validateSkill(stage, name)
+	if report.Errors() > 0 {
+		return name, report, fmt.Errorf("refusing to install %s: validation failed", name)
 	}
 	dst := filepath.Join(root, name)
-	if _, err := os.Stat(dst); err == nil {
-		return "", fmt.Errorf("already exists: %s", name)
+	if err := os.Rename(stage, dst); err != nil {
+		return "", report, err
 	}
-
-	// If source is a local directory, copy it. Otherwise, treat it as a git URL and clone.
-	if fi, err := os.Stat(source); err == nil && fi.IsDir() {
-		if err := copyDir(source, dst); err != nil {
-			_ = os.RemoveAll(dst)
-			return "", err
-		}
-	} else {
-		if err := gitClone(source, dst); err != nil {
-			_ = os.RemoveAll(dst)
-			return "", err
-		}
+	if err := recordSkill(cfg, name, dst, e); err != nil {
+		return name, report, fmt.Errorf("installed but recording it in skills.lock failed: %w", err)
 	}
+	return name, report, nil
+}
 
-	// Soft validation: SKILL.md should exist.
-	if _, err := os.Stat(filepath.Join(dst, "SKILL.md")); err != nil {
-		// Still install, but warn to user via caller.
-		return name, fmt.Errorf("installed but missing SKILL.md at root: %s", name)
+// freeSkillName sanitizes name and checks that no skill uses it yet.
+func freeSkillName(root, name string) (string, error) {
+	name = util.SafeFilename(name)
+	if name == "" || strings.HasPrefix(name, ".") {
+		return "", errors.New("bad skill name")
+	}
+	if _, err := os.Lstat(filepath.Join(root, name)); err == nil {
+		return "", fmt.Errorf("already exists: %s", name)
 	}
 	return name, nil
 }
@@ -124,7 +143,7 @@ func deriveSkillName(source string) string {
 }
 
 func gitClone(url, dst string) error {
-	// depth=1 is fine for skills.
+	// depth=1 is fine for skills; checkoutRef deepens it when a ref is pinned.
 	cmd := exec.Command("git", "clone", "--depth", "1", "--", url, dst)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
@@ -133,10 +152,18 @@ func gitClone(url, dst string) error {
 	return nil
 }
 
+// copyDir copies a directory tree. Symlinks are recreated only when they
+// resolve inside src; links escaping it are an error rather than followed.
 func copyDir(src, dst string) error {
 	src = filepath.Clean(src)
-	dst = filepath.Clean(dst)
+	root, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+	return copyTree(root, src, filepath.Clean(dst))
+}
 
+func copyTree(root, src, dst string) error {
 	fi, err := os.Stat(src)
 	if err != nil {
 		return err
@@ -158,17 +185,51 @@ func copyDir(src, dst string) error {
 		}
 		s := filepath.Join(src, name)
 		d := filepath.Join(dst, name)
-		if e.IsDir() {
-			if err := copyDir(s, d); err != nil {
+		switch {
+		case e.Type()&fs.ModeSymlink != 0:
+			if err := copySymlink(root, s, d); err != nil {
 				return err
 			}
-			continue
+		case e.IsDir():
+			if err := copyTree(root, s, d); err != nil {
+				return err
+			}
+		case e.Type().IsRegular():
+			if err := copyFile(s, d); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported file type: %s", s)
+		}
+	}
+	return nil
+}
+
+func copySymlink(root, src, dst string) error {
+	target, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return fmt.Errorf("broken symlink: %s", src)
+	}
+	if !withinDir(root, target) {
+		return fmt.Errorf("symlink escapes the source directory: %s -> %s", src, target)
+	}
+	link, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if filepath.IsAbs(link) {
+		// Keep the copy self-contained: point at the same file relative to the link.
+		parent, err := filepath.EvalSymlinks(filepath.Dir(src))
+		if err != nil {
+			return err
 		}
-		if err := copyFile(s, d); err != nil {
+		rel, err := filepath.Rel(parent, target)
+		if err != nil {
 			return err
 		}
+		link = rel
 	}
-	return nil
+	return os.Symlink(link, dst)
 }
 
 func copyFile(src, dst string) error {
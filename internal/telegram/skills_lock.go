@@ -0,0 +1,648 @@
+package telegram
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mybot/internal/config"
+	"mybot/internal/util"
+)
+
+// SkillLock records where an installed skill came from and which version is on disk.
+type SkillLock struct {
+	Source      string    `json:"source"`           // git URL, local directory or uploaded file
+	Kind        string    `json:"kind"`             // "git", "local", "file" or "skillify"
+	Ref         string    `json:"ref,omitempty"`    // pinned branch/tag/commit ("" = remote default branch)
+	Path        string    `json:"path,omitempty"`   // git: subdirectory of the repository holding the skill
+	Commit      string    `json:"commit,omitempty"` // checked-out commit (git)
+	Hash        string    `json:"hash"`             // treeHash of the installed files
+	Edited      bool      `json:"edited,omitempty"` // SKILL.md rewritten by /skillify since install
+	InstalledAt time.Time `json:"installed_at"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+}
+
+type skillsLockFile struct {
+	Version int                  `json:"version"`
+	Skills  map[string]SkillLock `json:"skills"`
+}
+
+// SkillsLock is the skills.lock manifest in SKILLS_DIR.
+type SkillsLock struct {
+	path string
+}
+
+var skillsLockMu sync.Mutex
+
+func NewSkillsLock(cfg config.Config) *SkillsLock {
+	return &SkillsLock{path: filepath.Join(skillsRoot(cfg), "skills.lock")}
+}
+
+func (l *SkillsLock) loadLocked() (skillsLockFile, error) {
+	f := skillsLockFile{Version: 1, Skills: map[string]SkillLock{}}
+	b, err := os.ReadFile(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return f, nil
+		}
+		return f, err
+	}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return f, fmt.Errorf("skills.lock: %w", err)
+	}
+	if f.Skills == nil {
+		f.Skills = map[string]SkillLock{}
+	}
+	return f, nil
+}
+
+func (l *SkillsLock) saveLocked(f skillsLockFile) error {
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(filepath.Dir(l.path), 0o755)
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
+
+func (l *SkillsLock) Get(name string) (SkillLock, bool, error) {
+	skillsLockMu.Lock()
+	defer skillsLockMu.Unlock()
+	f, err := l.loadLocked()
+	if err != nil {
+		return SkillLock{}, false, err
+	}
+	e, ok := f.Skills[name]
+	return e, ok, nil
+}
+
+func (l *SkillsLock) Put(name string, e SkillLock) error {
+	skillsLockMu.Lock()
+	defer skillsLockMu.Unlock()
+	f, err := l.loadLocked()
+	if err != nil {
+		return err
+	}
+	f.Skills[name] = e
+	return l.saveLocked(f)
+}
+
+func (l *SkillsLock) Remove(name string) error {
+	skillsLockMu.Lock()
+	defer skillsLockMu.Unlock()
+	f, err := l.loadLocked()
+	if err != nil {
+		return err
+	}
+	if _, ok := f.Skills[name]; !ok {
+		return nil
+	}
+	delete(f.Skills, name)
+	return l.saveLocked(f)
+}
+
+// fileHashes maps each regular file under dir (minus .git) to its sha256.
+func fileHashes(dir string) (map[string]string, error) {
+	out := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		out[filepath.ToSlash(rel)] = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	return out, err
+}
+
+// treeHash is a content hash of a skill directory: paths and file contents, .git excluded.
+func treeHash(dir string) (string, error) {
+	files, err := fileHashes(dir)
+	if err != nil {
+		return "", err
+	}
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	h := sha256.New()
+	for _, p := range paths {
+		fmt.Fprintf(h, "%s\x00%s\n", p, files[p])
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func isGitDir(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// skillDir resolves an installed skill by name.
+func skillDir(cfg config.Config, name string) (string, string, error) {
+	root := skillsRoot(cfg)
+	if root == "" {
+		return "", "", errors.New("skills dir not configured")
+	}
+	clean := util.SafeFilename(name)
+	if clean == "" || clean != name || strings.HasPrefix(clean, ".") {
+		return "", "", fmt.Errorf("bad skill name: %q", name)
+	}
+	dir := filepath.Join(root, clean)
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return "", "", fmt.Errorf("no such skill: %s", name)
+	}
+	return clean, dir, nil
+}
+
+// recordSkill writes the lock entry for a freshly installed skill.
+func recordSkill(cfg config.Config, name, dir string, e SkillLock) error {
+	e.InstalledAt = time.Now().UTC()
+	if isGitDir(dir) {
+		e.Commit, _ = git(dir, "rev-parse", "HEAD")
+	}
+	h, err := treeHash(dir)
+	if err != nil {
+		return err
+	}
+	e.Hash = h
+	return NewSkillsLock(cfg).Put(name, e)
+}
+
+// lockEntry returns the lock entry for a skill. Git checkouts installed before
+// skills.lock existed are adopted from their origin remote.
+func lockEntry(cfg config.Config, name, dir string) (SkillLock, error) {
+	e, ok, err := NewSkillsLock(cfg).Get(name)
+	if err != nil || ok {
+		return e, err
+	}
+	if isGitDir(dir) {
+		if url, err := git(dir, "remote", "get-url", "origin"); err == nil && url != "" {
+			e = SkillLock{Source: url, Kind: "git"}
+			e.Commit, _ = git(dir, "rev-parse", "HEAD")
+			e.Hash, _ = treeHash(dir)
+			return e, nil
+		}
+	}
+	return e, fmt.Errorf("%s is not tracked in skills.lock (installed before versioning); reinstall it to track updates", name)
+}
+
+// checkUnmodified refuses to overwrite local edits to an installed skill.
+func checkUnmodified(dir string, e SkillLock) error {
+	if e.Edited {
+		return errors.New("was rewritten by /skillify; remove and reinstall it to update from its source")
+	}
+	if e.Kind == "git" && isGitDir(dir) {
+		if st, err := git(dir, "status", "--porcelain"); err == nil && st != "" {
+			return errors.New("has local changes (git status not clean); commit or discard them first")
+		}
+		return nil
+	}
+	if e.Hash == "" {
+		return nil
+	}
+	if h, err := treeHash(dir); err == nil && h != e.Hash {
+		return errors.New("was modified after install; remove and reinstall it to update")
+	}
+	return nil
+}
+
+var commitHashRE = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// checkRef rejects a ref that is neither a commit hash nor a valid ref name.
+// Refs come from chat messages and skills.lock, and must never reach git as
+// an option.
+func checkRef(dir, ref string) error {
+	if ref == "" || commitHashRE.MatchString(ref) {
+		return nil
+	}
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("bad ref %q", ref)
+	}
+	if _, err := git(dir, "check-ref-format", "--allow-onelevel", ref); err != nil {
+		return fmt.Errorf("bad ref %q", ref)
+	}
+	return nil
+}
+
+// checkoutRef fetches ref ("" = remote default branch) and checks it out detached.
+// It returns the new commit.
+func checkoutRef(dir, ref string) (string, error) {
+	if err := checkRef(dir, ref); err != nil {
+		return "", err
+	}
+	want := ref
+	if want == "" {
+		want = "HEAD"
+	}
+	if _, err := git(dir, "fetch", "-q", "--depth", "50", "--", "origin", want); err == nil {
+		want = "FETCH_HEAD"
+	} else {
+		// Not a ref the server advertises (e.g. a commit hash): fetch history and resolve locally.
+		if _, ferr := git(dir, "fetch", "-q", "--unshallow", "--tags", "origin"); ferr != nil {
+			if _, ferr := git(dir, "fetch", "-q", "--tags", "origin"); ferr != nil {
+				return "", err
+			}
+		}
+	}
+	commit, err := git(dir, "rev-parse", "--verify", "--end-of-options", want+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown ref %q", ref)
+	}
+	if _, err := git(dir, "checkout", "-q", "--force", "--detach", commit, "--"); err != nil {
+		return "", err
+	}
+	return commit, nil
+}
+
+// validateCheckout validates a freshly checked-out version and goes back to
+// commit prev when it has hard errors.
+func validateCheckout(dir, name, prev string) error {
+	report := validateSkill(dir, name)
+	if report.Errors() == 0 {
+		return nil
+	}
+	if prev != "" {
+		_, _ = git(dir, "checkout", "-q", "--force", "--detach", prev)
+	}
+	return fmt.Errorf("new version of %s rejected, kept %s\n%s", name, shortHash(prev), report)
+}
+
+// gitChangelog summarizes the commits between two checkouts.
+func gitChangelog(dir, from, to string) string {
+	if from == "" || from == to {
+		return ""
+	}
+	out, err := git(dir, "log", "--oneline", "--no-decorate", "-n", "20", from+".."+to)
+	if err != nil {
+		// from is not in the shallow history, or to is behind from (a pin to an older ref).
+		return ""
+	}
+	return out
+}
+
+// updateSkill brings a skill to the newest version allowed by its pin and
+// returns a short changelog.
+func updateSkill(cfg config.Config, name string) (string, error) {
+	name, dir, err := skillDir(cfg, name)
+	if err != nil {
+		return "", err
+	}
+	e, err := lockEntry(cfg, name, dir)
+	if err != nil {
+		return "", err
+	}
+	if err := checkUnmodified(dir, e); err != nil {
+		return "", fmt.Errorf("%s %v", name, err)
+	}
+
+	var summary string
+	switch {
+	case e.Kind == "file":
+		return "", fmt.Errorf("%s was installed from an uploaded file; remove it and install the new version", name)
+	case e.Kind == "skillify":
+		return "", fmt.Errorf("%s was written by /skillify; regenerate it with /skillify", name)
+	case e.Kind == "git" && e.Path != "":
+		old := e.Commit
+		commit, log, err := replaceFromGit(dir, e, e.Ref)
+		if err != nil {
+			return "", err
+		}
+		if commit == old {
+			return fmt.Sprintf("%s: up to date (%s)", name, shortHash(commit)), nil
+		}
+		summary = fmt.Sprintf("%s: %s → %s", name, shortHash(old), shortHash(commit))
+		if log != "" {
+			summary += "\n" + indentLines(log, "  ")
+		}
+		e.Commit = commit
+	case e.Kind == "git":
+		old := e.Commit
+		commit, err := checkoutRef(dir, e.Ref)
+		if err != nil {
+			return "", err
+		}
+		if commit == old {
+			return fmt.Sprintf("%s: up to date (%s)", name, shortHash(commit)), nil
+		}
+		if err := validateCheckout(dir, name, old); err != nil {
+			return "", err
+		}
+		summary = fmt.Sprintf("%s: %s → %s", name, shortHash(old), shortHash(commit))
+		if log := gitChangelog(dir, old, commit); log != "" {
+			summary += "\n" + indentLines(log, "  ")
+		}
+		e.Commit = commit
+	default:
+		changes, err := replaceFromLocal(e.Source, dir)
+		if err != nil {
+			return "", err
+		}
+		if changes == "" {
+			return name + ": up to date", nil
+		}
+		summary = fmt.Sprintf("%s: %s", name, changes)
+	}
+
+	if e.Hash, err = treeHash(dir); err != nil {
+		return "", err
+	}
+	if e.InstalledAt.IsZero() {
+		e.InstalledAt = time.Now().UTC()
+	}
+	e.UpdatedAt = time.Now().UTC()
+	if err := NewSkillsLock(cfg).Put(name, e); err != nil {
+		return "", err
+	}
+	return summary, nil
+}
+
+// replaceFromLocal re-copies a local source over dir and describes what changed.
+func replaceFromLocal(source, dir string) (string, error) {
+	if fi, err := os.Stat(source); err != nil || !fi.IsDir() {
+		return "", fmt.Errorf("source directory is gone: %s", source)
+	}
+	before, err := fileHashes(dir)
+	if err != nil {
+		return "", err
+	}
+	after, err := fileHashes(source)
+	if err != nil {
+		return "", err
+	}
+	var added, changed, removed []string
+	for p, h := range after {
+		if old, ok := before[p]; !ok {
+			added = append(added, p)
+		} else if old != h {
+			changed = append(changed, p)
+		}
+	}
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			removed = append(removed, p)
+		}
+	}
+	if len(added)+len(changed)+len(removed) == 0 {
+		return "", nil
+	}
+
+	tmp := updateStage(dir)
+	if err := copyDir(source, tmp); err != nil {
+		_ = os.RemoveAll(tmp)
+		return "", err
+	}
+	if err := swapSkillDir(tmp, dir); err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, g := range []struct {
+		label string
+		files []string
+	}{{"added", added}, {"changed", changed}, {"removed", removed}} {
+		if len(g.files) > 0 {
+			sort.Strings(g.files)
+			parts = append(parts, fmt.Sprintf("%s %s", g.label, strings.Join(g.files, ", ")))
+		}
+	}
+	return strings.Join(parts, "; "), nil
+}
+
+func updateStage(dir string) string {
+	return filepath.Join(filepath.Dir(dir), fmt.Sprintf(".%s.update-%d", filepath.Base(dir), time.Now().UnixNano()))
+}
+
+// swapSkillDir validates the staged copy tmp and puts it in place of dir.
+// tmp is gone afterwards either way.
+func swapSkillDir(tmp, dir string) error {
+	defer os.RemoveAll(tmp)
+	if report := validateSkill(tmp, filepath.Base(dir)); report.Errors() > 0 {
+		return fmt.Errorf("new version of %s rejected, kept the installed one\n%s", filepath.Base(dir), report)
+	}
+	old := tmp + ".old"
+	if err := os.Rename(dir, old); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		_ = os.Rename(old, dir)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// replaceFromGit installs e.Path of the repository at ref over dir, for skills
+// that live in a subdirectory and so are not git checkouts themselves. It
+// returns the new commit and the commits touching the subdirectory since e.Commit.
+func replaceFromGit(dir string, e SkillLock, ref string) (string, string, error) {
+	scratch, commit, err := gitScratch(e.Source, ref)
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(scratch)
+	if commit == e.Commit {
+		return commit, "", nil
+	}
+	tmp := updateStage(dir)
+	if err := copyGitSubdir(scratch, e.Path, tmp); err != nil {
+		_ = os.RemoveAll(tmp)
+		return "", "", err
+	}
+	if err := swapSkillDir(tmp, dir); err != nil {
+		return "", "", err
+	}
+	log := ""
+	if e.Commit != "" {
+		log, _ = git(scratch, "log", "--oneline", "--no-decorate", "-n", "20", e.Commit+".."+commit, "--", e.Path)
+	}
+	return commit, log, nil
+}
+
+// pinSkill checks out ref and keeps future updates on it. ref "-" removes the pin.
+func pinSkill(cfg config.Config, name, ref string) (string, error) {
+	name, dir, err := skillDir(cfg, name)
+	if err != nil {
+		return "", err
+	}
+	e, err := lockEntry(cfg, name, dir)
+	if err != nil {
+		return "", err
+	}
+	if e.Kind != "git" {
+		return "", fmt.Errorf("%s was not installed from git; only git skills can be pinned", name)
+	}
+	if err := checkUnmodified(dir, e); err != nil {
+		return "", fmt.Errorf("%s %v", name, err)
+	}
+	if ref == "-" {
+		ref = ""
+	}
+	old := e.Commit
+	var commit string
+	if e.Path != "" {
+		if commit, _, err = replaceFromGit(dir, e, ref); err != nil {
+			return "", err
+		}
+	} else {
+		if commit, err = checkoutRef(dir, ref); err != nil {
+			return "", err
+		}
+		if err := validateCheckout(dir, name, old); err != nil {
+			return "", err
+		}
+	}
+	e.Ref, e.Commit = ref, commit
+	if e.Hash, err = treeHash(dir); err != nil {
+		return "", err
+	}
+	e.UpdatedAt = time.Now().UTC()
+	if err := NewSkillsLock(cfg).Put(name, e); err != nil {
+		return "", err
+	}
+	if ref == "" {
+		return fmt.Sprintf("%s: unpinned, now at %s (default branch)", name, shortHash(commit)), nil
+	}
+	return fmt.Sprintf("%s: pinned to %s (%s → %s)", name, ref, shortHash(old), shortHash(commit)), nil
+}
+
+// skillInfo describes an installed skill: front-matter, source and version.
+func skillInfo(cfg config.Config, name string) (string, error) {
+	name, dir, err := skillDir(cfg, name)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "skill: %s\npath: %s\n", name, dir)
+
+	if raw, err := os.ReadFile(filepath.Join(dir, "SKILL.md")); err != nil {
+		b.WriteString("SKILL.md: missing\n")
+	} else if fm, _ := parseFrontMatter(string(raw)); len(fm) == 0 {
+		b.WriteString("SKILL.md: no front-matter\n")
+	} else {
+		keys := make([]string, 0, len(fm))
+		for k := range fm {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s: %s\n", k, fm[k])
+		}
+	}
+
+	e, lerr := lockEntry(cfg, name, dir)
+	if lerr != nil {
+		b.WriteString("source: unknown (not in skills.lock)\n")
+		return strings.TrimSpace(b.String()), nil
+	}
+	fmt.Fprintf(&b, "source: %s (%s)\n", e.Source, e.Kind)
+	if e.Edited {
+		b.WriteString("SKILL.md rewritten by /skillify\n")
+	}
+	if e.Kind == "git" {
+		ref := "default branch"
+		if e.Ref != "" {
+			ref = e.Ref + " (pinned)"
+		}
+		if e.Path != "" {
+			fmt.Fprintf(&b, "subdir: %s\n", e.Path)
+		}
+		fmt.Fprintf(&b, "ref: %s\ncommit: %s\n", ref, e.Commit)
+	}
+	if !e.InstalledAt.IsZero() {
+		fmt.Fprintf(&b, "installed: %s\n", e.InstalledAt.Local().Format("2006-01-02 15:04"))
+	}
+	if !e.UpdatedAt.IsZero() {
+		fmt.Fprintf(&b, "updated: %s\n", e.UpdatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	if h, err := treeHash(dir); err == nil {
+		state := ""
+		if e.Hash != "" && h != e.Hash {
+			state = " (modified since install)"
+		}
+		fmt.Fprintf(&b, "hash: %s%s\n", shortHash(strings.TrimPrefix(h, "sha256:")), state)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// parseFrontMatter reads a leading "---" YAML-ish block of "key: value" lines.
+// It returns the fields and the remaining body.
+func parseFrontMatter(md string) (map[string]string, string) {
+	md = strings.TrimPrefix(md, "\ufeff")
+	rest, ok := strings.CutPrefix(md, "---\n")
+	if !ok {
+		if rest, ok = strings.CutPrefix(md, "---\r\n"); !ok {
+			return nil, md
+		}
+	}
+	fm := map[string]string{}
+	lines := strings.SplitAfter(rest, "\n")
+	for i, l := range lines {
+		t := strings.TrimRight(l, "\r\n")
+		if t == "---" || t == "..." {
+			return fm, strings.Join(lines[i+1:], "")
+		}
+		k, v, ok := strings.Cut(t, ":")
+		if !ok || strings.HasPrefix(t, " ") || strings.HasPrefix(t, "#") {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		fm[strings.TrimSpace(k)] = v
+	}
+	// Unterminated: not front-matter after all.
+	return nil, md
+}
+
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	if h == "" {
+		return "(none)"
+	}
+	return h
+}
+
+func indentLines(s, prefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = prefix + l
+	}
+	return strings.Join(lines, "\n")
+}
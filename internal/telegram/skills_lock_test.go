@@ -0,0 +1,141 @@
+package telegram
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mybot/internal/config"
+)
+
+// skillRepo creates a git repo holding a skill and returns a commit helper.
+func skillRepo(t *testing.T) (string, func(body, msg string) string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	mustGit := func(args ...string) string {
+		out, err := git(repo, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	mustGit("init", "-q", "-b", "main")
+	mustGit("config", "user.email", "t@example.com")
+	mustGit("config", "user.name", "t")
+	commit := func(body, msg string) string {
+		md := "---\nname: demo\ndescription: " + body + "\n---\n\n# Demo\n"
+		if err := os.WriteFile(filepath.Join(repo, "SKILL.md"), []byte(md), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mustGit("add", "-A")
+		mustGit("commit", "-q", "-m", msg)
+		return mustGit("rev-parse", "HEAD")
+	}
+	return repo, commit
+}
+
+func TestSkills_UpdateAndPinGit(t *testing.T) {
+	repo, commit := skillRepo(t)
+	first := commit("first version", "initial skill")
+	cfg := config.Config{SkillsDir: t.TempDir()}
+
+	if _, _, err := installSkill(cfg, "demo", "file://"+repo); err != nil {
+		t.Fatal(err)
+	}
+	e, ok, err := NewSkillsLock(cfg).Get("demo")
+	if err != nil || !ok || e.Kind != "git" || e.Commit != first || !strings.HasPrefix(e.Hash, "sha256:") {
+		t.Fatalf("lock entry = %+v ok=%v err=%v", e, ok, err)
+	}
+
+	if got, err := updateSkill(cfg, "demo"); err != nil || !strings.Contains(got, "up to date") {
+		t.Fatalf("update without changes: %q %v", got, err)
+	}
+	second := commit("second version", "improve the prompt")
+	got, err := updateSkill(cfg, "demo")
+	if err != nil || !strings.Contains(got, "improve the prompt") || !strings.Contains(got, second[:12]) {
+		t.Fatalf("update: %q %v", got, err)
+	}
+
+	if _, err := pinSkill(cfg, "demo", first); err != nil {
+		t.Fatal(err)
+	}
+	commit("third version", "later change")
+	if got, err := updateSkill(cfg, "demo"); err != nil || !strings.Contains(got, "up to date") {
+		t.Fatalf("pinned update should stay put: %q %v", got, err)
+	}
+	for _, ref := range []string{"--upload-pack=touch /tmp/pwned", "-q", "a..b", "main~1 x"} {
+		if _, err := pinSkill(cfg, "demo", ref); err == nil || !strings.Contains(err.Error(), "bad ref") {
+			t.Fatalf("pin %q: %v", ref, err)
+		}
+	}
+	info, err := skillInfo(cfg, "demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"description: first version", "(pinned)", "commit: " + first, "source: file://"} {
+		if !strings.Contains(info, want) {
+			t.Fatalf("info lacks %q:\n%s", want, info)
+		}
+	}
+
+	// Local edits are not overwritten.
+	if err := os.WriteFile(filepath.Join(cfg.SkillsDir, "demo", "SKILL.md"), []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pinSkill(cfg, "demo", "-"); err == nil || !strings.Contains(err.Error(), "local changes") {
+		t.Fatalf("expected local changes error, got %v", err)
+	}
+
+	if _, err := removeSkill(cfg, "demo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := NewSkillsLock(cfg).Get("demo"); ok {
+		t.Fatal("lock entry survived removal")
+	}
+}
+
+func TestSkills_UpdateLocal(t *testing.T) {
+	src := t.TempDir()
+	write := func(name, body string) {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("SKILL.md", "---\nname: loc\ndescription: local\n---\n# Loc\n")
+	write("old.sh", "echo")
+	cfg := config.Config{SkillsDir: t.TempDir()}
+	if _, _, err := installSkill(cfg, "loc", src); err != nil {
+		t.Fatal(err)
+	}
+
+	write("SKILL.md", "---\nname: loc\ndescription: changed\n---\n# Loc\n")
+	write("new.py", "print()")
+	if err := os.Remove(filepath.Join(src, "old.sh")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := updateSkill(cfg, "loc")
+	if err != nil || got != "loc: added new.py; changed SKILL.md; removed old.sh" {
+		t.Fatalf("update = %q %v", got, err)
+	}
+	if _, err := pinSkill(cfg, "loc", "v1"); err == nil {
+		t.Fatal("pinning a local skill should fail")
+	}
+	if _, err := updateSkill(cfg, "../x"); err == nil {
+		t.Fatal("bad name accepted")
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	fm, body := parseFrontMatter("---\nname: x\ndescription: \"quoted: yes\"\n---\n# Body\n")
+	if fm["name"] != "x" || fm["description"] != "quoted: yes" || body != "# Body\n" {
+		t.Fatalf("fm=%v body=%q", fm, body)
+	}
+	if fm, body := parseFrontMatter("# no front-matter\n"); fm != nil || body != "# no front-matter\n" {
+		t.Fatalf("fm=%v body=%q", fm, body)
+	}
+}
@@ -0,0 +1,345 @@
+package telegram
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"mybot/internal/config"
+)
+
+// A skill profile limits which installed skills a chat's agent sees. Chats
+// without one see all of SKILLS_DIR. Codex only looks for skills under
+// CODEX_HOME/skills, so a profiled chat runs with a generated CODEX_HOME
+// (LOG_DIR/skill-profiles/<chat_id>) whose entries link back to the real
+// home, except skills/, which links just the enabled skills.
+
+// SkillProfile is either an allowlist ("only") or a denylist ("except").
+type SkillProfile struct {
+	Mode      string    `json:"mode"`
+	Skills    []string  `json:"skills"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Allows reports whether the profile lets the agent see skill name.
+func (p SkillProfile) Allows(name string) bool {
+	return slices.Contains(p.Skills, name) == (p.Mode == "only")
+}
+
+// toggle enables or disables names. "all" resets the profile to everything
+// (enable) or nothing (disable).
+func (p *SkillProfile) toggle(enable bool, names []string) {
+	if len(names) == 1 && names[0] == "all" {
+		p.Skills = nil
+		p.Mode = "except"
+		if !enable {
+			p.Mode = "only"
+		}
+		return
+	}
+	if p.Mode == "" {
+		// First change: enabling starts from nothing, disabling from everything.
+		p.Mode = "except"
+		if enable {
+			p.Mode = "only"
+		}
+	}
+	add := enable == (p.Mode == "only")
+	for _, n := range names {
+		i := slices.Index(p.Skills, n)
+		switch {
+		case add && i < 0:
+			p.Skills = append(p.Skills, n)
+		case !add && i >= 0:
+			p.Skills = slices.Delete(p.Skills, i, i+1)
+		}
+	}
+	sort.Strings(p.Skills)
+}
+
+type skillProfilesFile struct {
+	Chats map[string]SkillProfile `json:"chats"`
+}
+
+// SkillProfiles persists profiles in LOG_DIR/skill_profiles.json.
+type SkillProfiles struct {
+	path string
+}
+
+var skillProfilesMu sync.Mutex
+
+func NewSkillProfiles(cfg config.Config) *SkillProfiles {
+	return &SkillProfiles{path: filepath.Join(cfg.LogDir, "skill_profiles.json")}
+}
+
+func (s *SkillProfiles) loadLocked() (skillProfilesFile, error) {
+	f := skillProfilesFile{Chats: map[string]SkillProfile{}}
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return f, nil
+		}
+		return f, err
+	}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return f, fmt.Errorf("skill_profiles.json: %w", err)
+	}
+	if f.Chats == nil {
+		f.Chats = map[string]SkillProfile{}
+	}
+	return f, nil
+}
+
+func (s *SkillProfiles) saveLocked(f skillProfilesFile) error {
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(filepath.Dir(s.path), 0o755)
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *SkillProfiles) Get(chatKey string) (SkillProfile, bool, error) {
+	skillProfilesMu.Lock()
+	defer skillProfilesMu.Unlock()
+	f, err := s.loadLocked()
+	if err != nil {
+		return SkillProfile{}, false, err
+	}
+	p, ok := f.Chats[chatKey]
+	return p, ok, nil
+}
+
+// Update applies fn to the chat's profile; a profile that allows everything is dropped.
+func (s *SkillProfiles) Update(chatKey string, fn func(p *SkillProfile)) (SkillProfile, error) {
+	skillProfilesMu.Lock()
+	defer skillProfilesMu.Unlock()
+	f, err := s.loadLocked()
+	if err != nil {
+		return SkillProfile{}, err
+	}
+	p := f.Chats[chatKey]
+	fn(&p)
+	if p.Mode == "except" && len(p.Skills) == 0 {
+		delete(f.Chats, chatKey)
+		return SkillProfile{}, s.saveLocked(f)
+	}
+	p.UpdatedAt = time.Now().UTC()
+	f.Chats[chatKey] = p
+	return p, s.saveLocked(f)
+}
+
+// profileHomeDir is where a chat's generated CODEX_HOME lives.
+func profileHomeDir(cfg config.Config, chatKey string) string {
+	return filepath.Join(cfg.LogDir, "skill-profiles", chatKey)
+}
+
+// profileHomeMu serializes rebuilding each chat's generated home.
+var (
+	profileHomeMu  sync.Mutex
+	profileHomeMus = map[string]*sync.Mutex{}
+)
+
+func profileHomeLock(chatKey string) *sync.Mutex {
+	profileHomeMu.Lock()
+	defer profileHomeMu.Unlock()
+	mu := profileHomeMus[chatKey]
+	if mu == nil {
+		mu = &sync.Mutex{}
+		profileHomeMus[chatKey] = mu
+	}
+	return mu
+}
+
+// SkillProfileHome returns the CODEX_HOME to run a chat's agent with, or ""
+// when the chat has no profile. The generated home is refreshed on every call
+// so newly installed or removed skills are picked up.
+func SkillProfileHome(cfg config.Config, chatKey string) (string, error) {
+	p, ok, err := NewSkillProfiles(cfg).Get(chatKey)
+	if err != nil || !ok {
+		return "", err
+	}
+	if cfg.CodexHome == "" {
+		return "", errors.New("CODEX_HOME could not be resolved")
+	}
+	installed, err := listSkills(cfg)
+	if err != nil {
+		return "", err
+	}
+	home, err := filepath.Abs(profileHomeDir(cfg, chatKey))
+	if err != nil {
+		return "", err
+	}
+	mu := profileHomeLock(chatKey)
+	mu.Lock()
+	defer mu.Unlock()
+	if err := mirrorCodexHome(cfg.CodexHome, home); err != nil {
+		return "", err
+	}
+
+	// Rebuild skills/ from scratch next to it and swap it in, so a codex
+	// starting meanwhile never sees it half built. Codex's bundled skills
+	// (.system) stay visible.
+	root, err := filepath.Abs(skillsRoot(cfg))
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(home, ".skills-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Chmod(tmp, 0o755); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(root, ".system")); err == nil {
+		if err := os.Symlink(filepath.Join(root, ".system"), filepath.Join(tmp, ".system")); err != nil {
+			return "", err
+		}
+	}
+	for _, name := range installed {
+		if p.Allows(name) {
+			if err := os.Symlink(filepath.Join(root, name), filepath.Join(tmp, name)); err != nil {
+				return "", err
+			}
+		}
+	}
+	skills := filepath.Join(home, "skills")
+	old := tmp + ".old"
+	if err := os.Rename(skills, old); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if err := os.Rename(tmp, skills); err != nil {
+		return "", err
+	}
+	_ = os.RemoveAll(old)
+	return home, nil
+}
+
+// mirrorCodexHome links every entry of the real codex home (config, auth,
+// sessions, ...) into home, so profiled chats share settings and threads.
+func mirrorCodexHome(real, home string) error {
+	real, err := filepath.Abs(real)
+	if err != nil {
+		return err
+	}
+	// Created up front so they are shared rather than created inside the profile.
+	for _, d := range []string{"sessions", "log"} {
+		if err := os.MkdirAll(filepath.Join(real, d), 0o755); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(home, 0o755); err != nil {
+		return err
+	}
+	ents, err := os.ReadDir(real)
+	if err != nil {
+		return err
+	}
+	for _, e := range ents {
+		if e.Name() == "skills" {
+			continue
+		}
+		target := filepath.Join(real, e.Name())
+		link := filepath.Join(home, e.Name())
+		if fi, err := os.Lstat(link); err == nil {
+			if fi.Mode()&os.ModeSymlink == 0 {
+				continue // created by codex inside the profile; keep it
+			}
+			if cur, _ := os.Readlink(link); cur == target {
+				continue
+			}
+			_ = os.Remove(link)
+		}
+		if err := os.Symlink(target, link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func describeSkillProfile(cfg config.Config, chatID int64) (string, error) {
+	installed, err := listSkills(cfg)
+	if err != nil {
+		return "", err
+	}
+	p, ok, err := NewSkillProfiles(cfg).Get(chatKeyFromChatID(chatID))
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return fmt.Sprintf("skills profile: all %d installed skills are enabled in this chat", len(installed)), nil
+	}
+	var on, off []string
+	for _, n := range installed {
+		if p.Allows(n) {
+			on = append(on, n)
+		} else {
+			off = append(off, n)
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "skills profile: %d of %d enabled", len(on), len(installed))
+	if len(on) > 0 {
+		b.WriteString("\nenabled: " + strings.Join(on, ", "))
+	}
+	if len(off) > 0 {
+		b.WriteString("\ndisabled: " + strings.Join(off, ", "))
+	}
+	if p.Mode == "except" {
+		b.WriteString("\nnew skills are enabled automatically")
+	} else {
+		b.WriteString("\nnew skills stay disabled until enabled")
+	}
+	return b.String(), nil
+}
+
+// handleSkillToggle: /skills enable|disable <name...|all>
+func handleSkillToggle(bot *tgbotapi.BotAPI, cfg config.Config, msg *tgbotapi.Message, cmd []string) {
+	chatID := msg.Chat.ID
+	enable := cmd[1] == "enable"
+	if len(cmd) < 3 {
+		sendText(bot, chatID, fmt.Sprintf("usage: /skills %s <name...|all>", cmd[1]))
+		return
+	}
+	names := cmd[2:]
+	if !(len(names) == 1 && names[0] == "all") {
+		for _, n := range names {
+			if _, _, err := skillDir(cfg, n); err != nil && enable {
+				sendText(bot, chatID, fmt.Sprintf("skills %s: %v", cmd[1], err))
+				return
+			}
+		}
+	}
+	_, err := NewSkillProfiles(cfg).Update(chatKeyFromChatID(chatID), func(p *SkillProfile) {
+		p.toggle(enable, names)
+	})
+	auditAction(cfg, msg, "/skills "+cmd[1], strings.Join(names, " "), err)
+	if err != nil {
+		sendText(bot, chatID, fmt.Sprintf("skills %s failed: %v", cmd[1], err))
+		return
+	}
+	desc, err := describeSkillProfile(cfg, chatID)
+	if err != nil {
+		desc = fmt.Sprintf("skills profile: %v", err)
+	}
+	note := "\n(takes effect with the next message)"
+	if cfg.CodexDriver == "interactive" {
+		// The running codex keeps the skills it started with.
+		note = "\n(takes effect in a new session: send /new)"
+	}
+	sendText(bot, chatID, desc+note)
+}
@@ -0,0 +1,101 @@
+package telegram
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"mybot/internal/config"
+)
+
+func TestSkillProfile_Toggle(t *testing.T) {
+	var p SkillProfile
+	p.toggle(true, []string{"pdf", "web"})
+	if p.Mode != "only" || !p.Allows("pdf") || p.Allows("other") {
+		t.Fatalf("enable from scratch: %+v", p)
+	}
+	p.toggle(false, []string{"web"})
+	if p.Allows("web") || !p.Allows("pdf") {
+		t.Fatalf("disable in allowlist: %+v", p)
+	}
+
+	var q SkillProfile
+	q.toggle(false, []string{"web"})
+	if q.Mode != "except" || q.Allows("web") || !q.Allows("new-skill") {
+		t.Fatalf("disable from scratch: %+v", q)
+	}
+	q.toggle(false, []string{"all"})
+	if q.Allows("pdf") {
+		t.Fatalf("disable all: %+v", q)
+	}
+}
+
+func TestSkillProfileHome(t *testing.T) {
+	base := t.TempDir()
+	cfg := config.Config{
+		LogDir:    filepath.Join(base, "logs"),
+		CodexHome: filepath.Join(base, "codex"),
+		SkillsDir: filepath.Join(base, "codex", "skills"),
+	}
+	for _, d := range []string{"pdf", "web", ".system/builtin"} {
+		if err := os.MkdirAll(filepath.Join(cfg.SkillsDir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(cfg.CodexHome, "config.toml"), []byte("model = \"x\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if home, err := SkillProfileHome(cfg, "42"); err != nil || home != "" {
+		t.Fatalf("no profile: home=%q err=%v", home, err)
+	}
+
+	profiles := NewSkillProfiles(cfg)
+	if _, err := profiles.Update("42", func(p *SkillProfile) { p.toggle(true, []string{"pdf"}) }); err != nil {
+		t.Fatal(err)
+	}
+	home, err := SkillProfileHome(cfg, "42")
+	if err != nil || home == "" {
+		t.Fatalf("home=%q err=%v", home, err)
+	}
+	ents, _ := os.ReadDir(filepath.Join(home, "skills"))
+	var names []string
+	for _, e := range ents {
+		names = append(names, e.Name())
+	}
+	if !slices.Equal(names, []string{".system", "pdf"}) {
+		t.Fatalf("profile skills = %v", names)
+	}
+	if b, err := os.ReadFile(filepath.Join(home, "config.toml")); err != nil || string(b) != "model = \"x\"\n" {
+		t.Fatalf("config.toml not shared: %q %v", b, err)
+	}
+	if fi, err := os.Lstat(filepath.Join(home, "sessions")); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("sessions should link to the real home: %v", err)
+	}
+
+	// Rebuilding swaps skills/ in whole and leaves no build directories behind.
+	if _, err := profiles.Update("42", func(p *SkillProfile) { p.toggle(true, []string{"web"}) }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SkillProfileHome(cfg, "42"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(home, "skills", "web")); err != nil {
+		t.Fatalf("web not enabled after rebuild: %v", err)
+	}
+	if left, _ := filepath.Glob(filepath.Join(home, ".skills-*")); len(left) != 0 {
+		t.Fatalf("build directories left: %v", left)
+	}
+
+	// Enabling everything drops the profile, and with it the generated home.
+	if _, err := profiles.Update("42", func(p *SkillProfile) { p.toggle(true, []string{"all"}) }); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := profiles.Get("42"); ok {
+		t.Fatal("all-enabled profile kept")
+	}
+	if home, _ := SkillProfileHome(cfg, "42"); home != "" {
+		t.Fatalf("home = %q after reset", home)
+	}
+}
@@ -0,0 +1,202 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"mybot/internal/util"
+)
+
+// skillSource is a parsed /skills install argument:
+//
+//	/path/to/dir            local directory (copied)
+//	/path/to/skill.zip      archive (.zip, .tar, .tar.gz, .tgz) or a single SKILL.md
+//	https://host/repo.git   git repository, cloned
+//	repo.git#sub/dir@ref    subdirectory of a git repository at ref (both parts optional)
+type skillSource struct {
+	Kind string // "local", "file" or "git"
+	Loc  string // directory, file or git URL
+	Sub  string // git: subdirectory holding the skill
+	Ref  string // git: branch, tag or commit
+}
+
+func parseSkillSource(s string) (skillSource, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return skillSource{}, errors.New("empty source")
+	}
+	if fi, err := os.Stat(s); err == nil {
+		abs, _ := filepath.Abs(s)
+		if fi.IsDir() {
+			return skillSource{Kind: "local", Loc: abs}, nil
+		}
+		if util.ArchiveExt(s) == "" && !strings.EqualFold(filepath.Ext(s), ".md") {
+			return skillSource{}, fmt.Errorf("unsupported file %s: expected a directory, an archive or SKILL.md", filepath.Base(s))
+		}
+		return skillSource{Kind: "file", Loc: abs}, nil
+	}
+
+	url, frag, _ := strings.Cut(s, "#")
+	src := skillSource{Kind: "git", Loc: url}
+	if i := strings.LastIndex(frag, "@"); i >= 0 {
+		frag, src.Ref = frag[:i], frag[i+1:]
+	}
+	if frag = strings.Trim(frag, "/"); frag != "" {
+		clean := path.Clean(frag)
+		if clean == ".." || strings.HasPrefix(clean, "../") || path.IsAbs(frag) {
+			return skillSource{}, fmt.Errorf("bad path in source: %q", frag)
+		}
+		src.Sub = clean
+	}
+	if url == "" {
+		return skillSource{}, errors.New("empty git URL")
+	}
+	return src, nil
+}
+
+// looksLikeGitURL tells git sources apart from bare upload names.
+func looksLikeGitURL(s string) bool {
+	return strings.Contains(s, "://") || strings.HasPrefix(s, "git@") ||
+		strings.Contains(s, ".git") || strings.Contains(s, "#")
+}
+
+// stageSkill materializes src into stage (which must not exist) and returns
+// the lock entry describing it.
+func stageSkill(src skillSource, stage string) (SkillLock, error) {
+	e := SkillLock{Source: src.Loc, Kind: src.Kind, Ref: src.Ref, Path: src.Sub}
+	switch src.Kind {
+	case "local":
+		return e, copyDir(src.Loc, stage)
+	case "file":
+		return e, stageSkillFile(src.Loc, stage)
+	}
+	if src.Sub == "" {
+		if err := gitClone(src.Loc, stage); err != nil {
+			return e, err
+		}
+		if src.Ref != "" {
+			if _, err := checkoutRef(stage, src.Ref); err != nil {
+				return e, err
+			}
+		}
+		return e, nil
+	}
+	scratch, commit, err := gitScratch(src.Loc, src.Ref)
+	if err != nil {
+		return e, err
+	}
+	defer os.RemoveAll(scratch)
+	e.Commit = commit
+	return e, copyGitSubdir(scratch, src.Sub, stage)
+}
+
+// stageSkillFile unpacks an archive, or wraps a lone Markdown file as SKILL.md.
+func stageSkillFile(file, stage string) error {
+	if util.ArchiveExt(file) == "" {
+		if err := os.MkdirAll(stage, 0o755); err != nil {
+			return err
+		}
+		return copyFile(file, filepath.Join(stage, "SKILL.md"))
+	}
+	scratch := stage + ".x"
+	defer os.RemoveAll(scratch)
+	// Links and special entries are skipped by the extractor; the limits
+	// match what validateSkill accepts.
+	lim := util.ArchiveLimits{MaxBytes: skillMaxBytes, MaxFiles: skillMaxFiles}
+	if _, err := util.ExtractArchive(file, scratch, lim); err != nil {
+		return err
+	}
+	return os.Rename(archiveSkillRoot(scratch), stage)
+}
+
+// archiveSkillRoot descends through the single top-level folder most archives
+// wrap their content in ("skill-main/SKILL.md").
+func archiveSkillRoot(dir string) string {
+	for depth := 0; depth < 3; depth++ {
+		if _, err := os.Stat(filepath.Join(dir, "SKILL.md")); err == nil {
+			return dir
+		}
+		ents, err := os.ReadDir(dir)
+		if err != nil {
+			return dir
+		}
+		var only string
+		n := 0
+		for _, e := range ents {
+			if strings.HasPrefix(e.Name(), ".") || e.Name() == "__MACOSX" {
+				continue
+			}
+			n++
+			if e.IsDir() {
+				only = e.Name()
+			}
+		}
+		if n != 1 || only == "" {
+			return dir
+		}
+		dir = filepath.Join(dir, only)
+	}
+	return dir
+}
+
+// gitScratch checks out ref ("" = default branch) of url in a temporary
+// repository. The caller removes the returned directory.
+func gitScratch(url, ref string) (string, string, error) {
+	dir, err := os.MkdirTemp("", "mybot-skill-")
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := git(dir, "init", "-q"); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	if _, err := git(dir, "remote", "add", "origin", url); err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	commit, err := checkoutRef(dir, ref)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", "", fmt.Errorf("fetching %s: %w", url, err)
+	}
+	return dir, commit, nil
+}
+
+func copyGitSubdir(repo, sub, dst string) error {
+	src := filepath.Join(repo, filepath.FromSlash(sub))
+	if fi, err := os.Stat(src); err != nil || !fi.IsDir() {
+		return fmt.Errorf("no directory %q in the repository", sub)
+	}
+	return copyDir(src, dst)
+}
+
+var uploadStampRE = regexp.MustCompile(`^\d{8}_\d{6}_`)
+
+// stagedSkillName picks a name for a skill installed without one. Uploaded
+// files carry meaningless names, so their front-matter name wins.
+func stagedSkillName(src skillSource, stage string) string {
+	if src.Kind == "file" {
+		if raw, err := os.ReadFile(filepath.Join(stage, "SKILL.md")); err == nil {
+			if fm, _ := parseFrontMatter(string(raw)); skillNameRE.MatchString(fm["name"]) && len(fm["name"]) <= skillNameMaxLen {
+				return fm["name"]
+			}
+		}
+		base := filepath.Base(src.Loc)
+		base = base[:len(base)-len(util.ArchiveExt(base))]
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+		base = uploadStampRE.ReplaceAllString(base, "")
+		if base == "" || strings.EqualFold(base, "SKILL") {
+			return "skill"
+		}
+		return base
+	}
+	if src.Sub != "" {
+		return path.Base(src.Sub)
+	}
+	return deriveSkillName(src.Loc)
+}
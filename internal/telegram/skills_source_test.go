@@ -0,0 +1,162 @@
+package telegram
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mybot/internal/config"
+)
+
+func TestParseSkillSource(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "x.zip")
+	writeSkill(t, dir, map[string]string{"x.zip": "", "notes.txt": ""})
+
+	cases := []struct {
+		in   string
+		want skillSource
+		err  bool
+	}{
+		{dir, skillSource{Kind: "local", Loc: dir}, false},
+		{zipPath, skillSource{Kind: "file", Loc: zipPath}, false},
+		{filepath.Join(dir, "notes.txt"), skillSource{}, true},
+		{"https://h/r.git", skillSource{Kind: "git", Loc: "https://h/r.git"}, false},
+		{"https://h/r.git#skills/pdf@v1.2", skillSource{Kind: "git", Loc: "https://h/r.git", Sub: "skills/pdf", Ref: "v1.2"}, false},
+		{"git@h:o/r.git#@main", skillSource{Kind: "git", Loc: "git@h:o/r.git", Ref: "main"}, false},
+		{"https://h/r.git#/a/b/", skillSource{Kind: "git", Loc: "https://h/r.git", Sub: "a/b"}, false},
+		{"https://h/r.git#a/../../etc", skillSource{}, true},
+		{"#sub", skillSource{}, true},
+	}
+	for _, c := range cases {
+		got, err := parseSkillSource(c.in)
+		if (err != nil) != c.err || got != c.want {
+			t.Errorf("parseSkillSource(%q) = %+v, %v; want %+v", c.in, got, err, c.want)
+		}
+	}
+}
+
+func writeSkillZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, body := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInstallSkill_FromFiles(t *testing.T) {
+	cfg := config.Config{SkillsDir: t.TempDir()}
+	up := t.TempDir()
+
+	// GitHub-style archive: everything inside one top-level folder.
+	archive := filepath.Join(up, "20250101_120000_demo-main.zip")
+	writeSkillZip(t, archive, map[string]string{
+		"demo-main/SKILL.md":       goodSkillMD,
+		"demo-main/scripts/run.sh": "echo hi\n",
+		"__MACOSX/._SKILL.md":      "junk",
+	})
+	name, r, err := installSkill(cfg, "", archive)
+	if err != nil || name != "demo" {
+		t.Fatalf("name=%q err=%v\n%s", name, err, r)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.SkillsDir, "demo", "scripts", "run.sh")); err != nil {
+		t.Fatal(err)
+	}
+	if e, ok, _ := NewSkillsLock(cfg).Get("demo"); !ok || e.Kind != "file" || e.Source != archive {
+		t.Fatalf("lock entry = %+v", e)
+	}
+	if _, err := updateSkill(cfg, "demo"); err == nil || !strings.Contains(err.Error(), "uploaded file") {
+		t.Fatalf("update of an uploaded skill: %v", err)
+	}
+
+	evil := filepath.Join(up, "evil.zip")
+	writeSkillZip(t, evil, map[string]string{"SKILL.md": goodSkillMD, "../../escape": "x"})
+	if _, _, err := installSkill(cfg, "evil", evil); err == nil {
+		t.Fatal("zip-slip archive installed")
+	}
+
+	md := filepath.Join(up, "20250101_120001_SKILL.md")
+	writeSkill(t, up, map[string]string{filepath.Base(md): strings.Replace(goodSkillMD, "name: demo", "name: notes", 1)})
+	if name, r, err := installSkill(cfg, "", md); err != nil || name != "notes" {
+		t.Fatalf("name=%q err=%v\n%s", name, err, r)
+	}
+	if _, _, err := installSkill(cfg, "", md); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("duplicate install: %v", err)
+	}
+}
+
+func TestInstallSkill_GitSubdir(t *testing.T) {
+	repo, _ := skillRepo(t)
+	commitSub := func(desc, msg string) string {
+		writeSkill(t, repo, map[string]string{
+			"skills/pdf/SKILL.md": "---\nname: pdf\ndescription: " + desc + "\n---\n\n# PDF\n",
+			"README.md":           msg,
+		})
+		if _, err := git(repo, "add", "-A"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := git(repo, "commit", "-q", "-m", msg); err != nil {
+			t.Fatal(err)
+		}
+		out, _ := git(repo, "rev-parse", "HEAD")
+		return out
+	}
+	first := commitSub("v1", "add pdf skill")
+	if _, err := git(repo, "tag", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	second := commitSub("v2", "improve pdf skill")
+	cfg := config.Config{SkillsDir: t.TempDir()}
+
+	name, r, err := installSkill(cfg, "", "file://"+repo+"#skills/pdf@v1")
+	if err != nil || name != "pdf" {
+		t.Fatalf("name=%q err=%v\n%s", name, err, r)
+	}
+	dir := filepath.Join(cfg.SkillsDir, "pdf")
+	if isGitDir(dir) {
+		t.Fatal("subdirectory install should not be a checkout")
+	}
+	e, _, _ := NewSkillsLock(cfg).Get("pdf")
+	if e.Kind != "git" || e.Path != "skills/pdf" || e.Ref != "v1" || e.Commit != first {
+		t.Fatalf("lock entry = %+v", e)
+	}
+	if got, err := updateSkill(cfg, "pdf"); err != nil || !strings.Contains(got, "up to date") {
+		t.Fatalf("pinned update: %q %v", got, err)
+	}
+
+	got, err := pinSkill(cfg, "pdf", "-")
+	if err != nil || !strings.Contains(got, shortHash(second)) {
+		t.Fatalf("unpin: %q %v", got, err)
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, "SKILL.md"))
+	if !strings.Contains(string(raw), "description: v2") {
+		t.Fatalf("SKILL.md not updated:\n%s", raw)
+	}
+	third := commitSub("v3", "pdf: handle forms")
+	got, err = updateSkill(cfg, "pdf")
+	if err != nil || !strings.Contains(got, "pdf: handle forms") || !strings.Contains(got, shortHash(third)) {
+		t.Fatalf("update: %q %v", got, err)
+	}
+
+	if _, _, err := installSkill(cfg, "other", "file://"+repo+"#skills/missing"); err == nil {
+		t.Fatal("missing subdirectory installed")
+	}
+}
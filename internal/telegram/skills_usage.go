@@ -0,0 +1,228 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mybot/internal/config"
+	"mybot/internal/transcript"
+)
+
+// Skill usage is inferred from the agent's commands: codex opens a skill by
+// reading <skills dir>/<name>/SKILL.md and may run scripts from the same
+// folder. Only paths into SKILLS_DIR or the chat's profile home count, and only
+// names of installed skills.
+//
+// Commands are only seen in exec mode (CODEX_DRIVER=exec), where codex reports
+// them as JSON events; interactive (PTY) sessions record no usage.
+
+// SkillStats is the usage of one skill.
+type SkillStats struct {
+	Count    int            `json:"count"`
+	LastUsed time.Time      `json:"last_used"`
+	Chats    map[string]int `json:"chats"`
+}
+
+type skillUsageFile struct {
+	Skills map[string]*SkillStats `json:"skills"`
+}
+
+// SkillUsage persists counts in LOG_DIR/skill_usage.json.
+type SkillUsage struct {
+	path string
+}
+
+var skillUsageMu sync.Mutex
+
+func NewSkillUsage(cfg config.Config) *SkillUsage {
+	return &SkillUsage{path: filepath.Join(cfg.LogDir, "skill_usage.json")}
+}
+
+func (u *SkillUsage) loadLocked() (skillUsageFile, error) {
+	f := skillUsageFile{Skills: map[string]*SkillStats{}}
+	b, err := os.ReadFile(u.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return f, nil
+		}
+		return f, err
+	}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return f, fmt.Errorf("skill_usage.json: %w", err)
+	}
+	if f.Skills == nil {
+		f.Skills = map[string]*SkillStats{}
+	}
+	return f, nil
+}
+
+func (u *SkillUsage) saveLocked(f skillUsageFile) error {
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(filepath.Dir(u.path), 0o755)
+	tmp := u.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, u.path)
+}
+
+// Record counts one use of each skill in names by chatKey.
+func (u *SkillUsage) Record(chatKey string, names []string, at time.Time) error {
+	skillUsageMu.Lock()
+	defer skillUsageMu.Unlock()
+	f, err := u.loadLocked()
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		s := f.Skills[n]
+		if s == nil {
+			s = &SkillStats{}
+			f.Skills[n] = s
+		}
+		if s.Chats == nil {
+			s.Chats = map[string]int{}
+		}
+		s.Count++
+		s.Chats[chatKey]++
+		if at.After(s.LastUsed) {
+			s.LastUsed = at
+		}
+	}
+	return u.saveLocked(f)
+}
+
+func (u *SkillUsage) All() (map[string]*SkillStats, error) {
+	skillUsageMu.Lock()
+	defer skillUsageMu.Unlock()
+	f, err := u.loadLocked()
+	return f.Skills, err
+}
+
+// skillDirPrefixes returns the ways a command may spell the chat's skill
+// directories: absolute, under ~ or $HOME, via $CODEX_HOME, or relative to
+// WORKDIR (the agent's working directory).
+func skillDirPrefixes(cfg config.Config, chatKey string) []string {
+	var dirs []string
+	if root, err := filepath.Abs(skillsRoot(cfg)); err == nil && skillsRoot(cfg) != "" {
+		dirs = append(dirs, root)
+	}
+	if home, err := filepath.Abs(profileHomeDir(cfg, chatKey)); err == nil && cfg.LogDir != "" {
+		dirs = append(dirs, filepath.Join(home, "skills"))
+	}
+	var out []string
+	userHome, _ := os.UserHomeDir()
+	codexHome, _ := filepath.Abs(cfg.CodexHome)
+	workDir, _ := filepath.Abs(cfg.WorkDir)
+	for _, d := range dirs {
+		out = append(out, d)
+		if userHome != "" && withinDir(userHome, d) && d != userHome {
+			rel := filepath.ToSlash(d[len(userHome)+1:])
+			out = append(out, "~/"+rel, "$HOME/"+rel, "${HOME}/"+rel)
+		}
+		if cfg.CodexHome != "" && withinDir(codexHome, d) && d != codexHome {
+			rel := filepath.ToSlash(d[len(codexHome)+1:])
+			out = append(out, "$CODEX_HOME/"+rel, "${CODEX_HOME}/"+rel)
+		}
+		if cfg.WorkDir != "" && withinDir(workDir, d) && d != workDir {
+			rel := filepath.ToSlash(d[len(workDir)+1:])
+			out = append(out, rel, "./"+rel)
+		}
+	}
+	return out
+}
+
+// skillPathRE matches <prefix>/<name> for any of prefixes, at the start of a
+// word, and captures name.
+func skillPathRE(prefixes []string) *regexp.Regexp {
+	quoted := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		quoted[i] = regexp.QuoteMeta(filepath.ToSlash(p))
+	}
+	return regexp.MustCompile(`(?:^|[\s'"=:])(?:` + strings.Join(quoted, "|") + `)/([A-Za-z0-9][A-Za-z0-9._-]*)(?:[/\s'"]|$)`)
+}
+
+// skillsInItem returns the installed skills an agent item touched through
+// one of the skill directory prefixes.
+func skillsInItem(it transcript.Item, prefixes, installed []string) []string {
+	if it.Type != "command_execution" || len(prefixes) == 0 {
+		return nil
+	}
+	var out []string
+	for _, m := range skillPathRE(prefixes).FindAllStringSubmatch(it.Command, -1) {
+		if slices.Contains(installed, m[1]) && !slices.Contains(out, m[1]) {
+			out = append(out, m[1])
+		}
+	}
+	return out
+}
+
+// ObserveSkillUse records skill usage from a completed agent item of chatKey.
+func ObserveSkillUse(cfg config.Config, chatKey string, it transcript.Item) error {
+	if it.Type != "command_execution" {
+		return nil
+	}
+	installed, err := listSkills(cfg)
+	if err != nil || len(installed) == 0 {
+		return err
+	}
+	names := skillsInItem(it, skillDirPrefixes(cfg, chatKey), installed)
+	if len(names) == 0 {
+		return nil
+	}
+	return NewSkillUsage(cfg).Record(chatKey, names, time.Now().UTC())
+}
+
+// describeSkillUse is the usage column of /skills ls.
+func describeSkillUse(s *SkillStats, chatKey string, now time.Time) string {
+	if s == nil || s.Count == 0 {
+		return "never used"
+	}
+	out := fmt.Sprintf("used %d×", s.Count)
+	if here := s.Chats[chatKey]; here != s.Count {
+		out += fmt.Sprintf(" (%d here)", here)
+	}
+	return out + fmt.Sprintf(", last %s ago", formatAge(now.Sub(s.LastUsed)))
+}
+
+// unusedSkills lists skills not used within olderThan, skipping skills installed
+// more recently than that. Each entry carries a short reason.
+func unusedSkills(cfg config.Config, olderThan time.Duration, now time.Time) ([]string, error) {
+	installed, err := listSkills(cfg)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := NewSkillUsage(cfg).All()
+	if err != nil {
+		return nil, err
+	}
+	lock := NewSkillsLock(cfg)
+	var out []string
+	for _, n := range installed {
+		s := usage[n]
+		if s != nil && now.Sub(s.LastUsed) < olderThan {
+			continue
+		}
+		if e, ok, _ := lock.Get(n); ok && !e.InstalledAt.IsZero() && now.Sub(e.InstalledAt) < olderThan {
+			continue
+		}
+		if s == nil || s.Count == 0 {
+			out = append(out, n+" — never used")
+		} else {
+			out = append(out, fmt.Sprintf("%s — last used %s ago (%d× in total)", n, formatAge(now.Sub(s.LastUsed)), s.Count))
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
@@ -0,0 +1,85 @@
+package telegram
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"mybot/internal/config"
+	"mybot/internal/transcript"
+)
+
+func TestSkillsInItem(t *testing.T) {
+	t.Setenv("HOME", "/home/u")
+	cfg := config.Config{
+		WorkDir:   "/home/u/project",
+		CodexHome: "/home/u/.codex",
+		SkillsDir: "/home/u/.codex/skills",
+		LogDir:    "/home/u/project/logs",
+	}
+	prefixes := skillDirPrefixes(cfg, "42")
+	installed := []string{"pdf", "web-search"}
+	cases := []struct {
+		cmd  string
+		want []string
+	}{
+		{"bash -lc 'cat /home/u/.codex/skills/pdf/SKILL.md'", []string{"pdf"}},
+		{`bash -lc "sed -n 1,80p ~/.codex/skills/web-search/SKILL.md && python $CODEX_HOME/skills/pdf/scripts/x.py"`, []string{"web-search", "pdf"}},
+		{"cat /home/u/project/logs/skill-profiles/42/skills/pdf/SKILL.md", []string{"pdf"}},
+		{"ls logs/skill-profiles/42/skills/web-search", []string{"web-search"}},
+		{"cat /home/u/.codex/skills/unknown/SKILL.md", nil},
+		// Another project's skills/ folder is not the skills dir.
+		{"cat skills/pdf/SKILL.md", nil},
+		{"cat /srv/other/skills/pdf/SKILL.md", nil},
+		{"cat /home/u/project/logs/skill-profiles/7/skills/pdf/SKILL.md", nil},
+	}
+	for _, c := range cases {
+		got := skillsInItem(transcript.Item{Type: "command_execution", Command: c.cmd}, prefixes, installed)
+		if !slices.Equal(got, c.want) {
+			t.Errorf("%q: got %v, want %v", c.cmd, got, c.want)
+		}
+	}
+	if got := skillsInItem(transcript.Item{Type: "agent_message", Text: "see /home/u/.codex/skills/pdf/SKILL.md"}, prefixes, installed); got != nil {
+		t.Errorf("messages should not count: %v", got)
+	}
+}
+
+func TestSkillUsage_Unused(t *testing.T) {
+	base := t.TempDir()
+	cfg := config.Config{LogDir: filepath.Join(base, "logs"), SkillsDir: filepath.Join(base, "skills")}
+	for _, n := range []string{"fresh", "old", "idle", "busy"} {
+		if err := os.MkdirAll(filepath.Join(cfg.SkillsDir, n), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().UTC()
+	if err := NewSkillsLock(cfg).Put("fresh", SkillLock{Kind: "local", InstalledAt: now.Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	u := NewSkillUsage(cfg)
+	if err := u.Record("1", []string{"old"}, now.Add(-60*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ObserveSkillUse(cfg, "2", transcript.Item{Type: "command_execution", Command: "cat " + filepath.Join(cfg.SkillsDir, "busy", "SKILL.md")}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := unusedSkills(cfg, 30*24*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !strings.HasPrefix(got[0], "idle — never used") || !strings.HasPrefix(got[1], "old — last used 60d ago") {
+		t.Fatalf("unused = %q", got)
+	}
+
+	all, _ := u.All()
+	if s := all["busy"]; s == nil || s.Count != 1 || s.Chats["2"] != 1 {
+		t.Fatalf("busy stats = %+v", s)
+	}
+	if d := describeSkillUse(all["busy"], "1", now); !strings.HasPrefix(d, "used 1× (0 here), last") {
+		t.Fatalf("describe = %q", d)
+	}
+}
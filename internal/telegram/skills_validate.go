@@ -0,0 +1,246 @@
+package telegram
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Limits for a skill directory.
+const (
+	skillMDMaxBytes      = 64 * 1024
+	skillMDWarnBytes     = 20 * 1024
+	skillMaxFiles        = 1000
+	skillMaxBytes        = 10 * 1024 * 1024
+	skillNameMaxLen      = 64
+	skillDescMaxLen      = 1024
+	skillScriptScanBytes = 1024 * 1024
+)
+
+var (
+	skillNameRE    = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+	skillHeadingRE = regexp.MustCompile(`(?m)^#{1,3} \S`)
+)
+
+type lintLevel int
+
+const (
+	lintWarning lintLevel = iota
+	lintError
+)
+
+type lintIssue struct {
+	Level lintLevel
+	File  string // relative to the skill dir; may carry ":line"
+	Msg   string
+}
+
+// skillReport is the outcome of validateSkill.
+type skillReport struct {
+	Issues []lintIssue
+}
+
+func (r *skillReport) add(level lintLevel, file, format string, args ...any) {
+	r.Issues = append(r.Issues, lintIssue{Level: level, File: file, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (r skillReport) Errors() int {
+	n := 0
+	for _, i := range r.Issues {
+		if i.Level == lintError {
+			n++
+		}
+	}
+	return n
+}
+
+func (r skillReport) String() string {
+	if len(r.Issues) == 0 {
+		return "validation: ok"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "validation: %d error(s), %d warning(s)", r.Errors(), len(r.Issues)-r.Errors())
+	for _, i := range r.Issues {
+		mark := "⚠"
+		if i.Level == lintError {
+			mark = "✖"
+		}
+		fmt.Fprintf(&b, "\n%s `%s`: %s", mark, i.File, i.Msg)
+	}
+	return b.String()
+}
+
+// dangerousPatterns flag risky script lines. Errors are destructive or
+// exfiltrating on their face; warnings deserve a human look.
+var dangerousPatterns = []struct {
+	level lintLevel
+	re    *regexp.Regexp
+	what  string
+}{
+	{lintError, regexp.MustCompile(`\brm\s+(-[a-zA-Z]*\s+)*-[a-zA-Z]*[rR][a-zA-Z]*\s+(-[a-zA-Z]+\s+)*("?(/|~|\$HOME|\$\{HOME\})"?/?\*?)(\s|;|$)`), "recursive delete of / or $HOME"},
+	{lintError, regexp.MustCompile(`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`), "fork bomb"},
+	{lintError, regexp.MustCompile(`\bmkfs(\.[a-z0-9]+)?\b|\bdd\b[^\n]*\bof=/dev/(sd|nvme|hd|disk|mmcblk)`), "writes to a block device"},
+	{lintError, regexp.MustCompile(`/dev/tcp/|\bnc\b[^\n]*\s-e\s|\bsocat\b[^\n]*exec:`), "reverse shell"},
+	{lintWarning, regexp.MustCompile(`\b(curl|wget)\b[^\n|]*\|\s*(sudo\s+)?(ba|z|da)?sh\b`), "pipes a download into a shell"},
+	{lintWarning, regexp.MustCompile(`\bbase64\s+(-d|--decode)\b[^\n]*\|\s*(ba|z)?sh\b`), "executes base64-decoded code"},
+	{lintWarning, regexp.MustCompile(`\beval\s+"?\$\((curl|wget)\b`), "evals downloaded code"},
+	{lintWarning, regexp.MustCompile(`\bsudo\b`), "uses sudo"},
+	{lintWarning, regexp.MustCompile(`\bchmod\s+(-R\s+)?0?777\b`), "makes files world-writable"},
+	{lintWarning, regexp.MustCompile(`~/\.ssh|\$HOME/\.ssh|/etc/shadow|\.aws/credentials|TELEGRAM_BOT_TOKEN`), "touches credentials"},
+	{lintWarning, regexp.MustCompile(`\bgit\s+push\b[^\n]*--force\b`), "force-pushes"},
+}
+
+var scriptExts = map[string]bool{
+	".sh": true, ".bash": true, ".zsh": true, ".py": true, ".js": true, ".mjs": true, ".ts": true,
+	".rb": true, ".pl": true, ".ps1": true, ".php": true, ".lua": true,
+}
+
+func isScript(path string, mode fs.FileMode) bool {
+	if scriptExts[strings.ToLower(filepath.Ext(path))] || mode&0o111 != 0 {
+		return true
+	}
+	base := filepath.Base(path)
+	return base == "Makefile" || base == "Dockerfile"
+}
+
+// validateSkill checks a skill directory before it is activated as name.
+func validateSkill(dir, name string) skillReport {
+	var r skillReport
+	rootReal, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		r.add(lintError, ".", "%v", err)
+		return r
+	}
+
+	files, total := 0, int64(0)
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		rel, _ := filepath.Rel(dir, path)
+		rel = filepath.ToSlash(rel)
+		if err != nil {
+			r.add(lintError, rel, "unreadable: %v", err)
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			if err := checkSkillSymlink(rootReal, path); err != nil {
+				r.add(lintError, rel, "%v", err)
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			r.add(lintError, rel, "not a regular file")
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files++
+		total += info.Size()
+		if isScript(path, info.Mode()) {
+			scanScript(&r, path, rel)
+		}
+		return nil
+	})
+	if files > skillMaxFiles {
+		r.add(lintError, ".", "%d files (max %d)", files, skillMaxFiles)
+	}
+	if total > skillMaxBytes {
+		r.add(lintError, ".", "%d bytes in total (max %d)", total, skillMaxBytes)
+	}
+
+	checkSkillMD(&r, dir, name)
+	return r
+}
+
+// checkSkillSymlink allows only links that stay inside the skill.
+func checkSkillSymlink(rootReal, path string) error {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("broken symlink")
+	}
+	if !withinDir(rootReal, target) {
+		return fmt.Errorf("symlink escapes the skill directory (-> %s)", target)
+	}
+	return nil
+}
+
+func checkSkillMD(r *skillReport, dir, skill string) {
+	const f = "SKILL.md"
+	info, err := os.Lstat(filepath.Join(dir, f))
+	if err != nil {
+		r.add(lintError, f, "missing at the skill root")
+		return
+	}
+	if info.Size() > skillMDMaxBytes {
+		r.add(lintError, f, "%d bytes (max %d)", info.Size(), skillMDMaxBytes)
+		return
+	}
+	if info.Size() > skillMDWarnBytes {
+		r.add(lintWarning, f, "%d bytes; large skills crowd the agent's context", info.Size())
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, f))
+	if err != nil {
+		r.add(lintError, f, "%v", err)
+		return
+	}
+	fm, body := parseFrontMatter(string(raw))
+	if fm == nil {
+		r.add(lintError, f, "no front-matter (--- name / description ---)")
+	} else {
+		name, desc := fm["name"], fm["description"]
+		switch {
+		case name == "":
+			r.add(lintError, f, "front-matter: name is required")
+		case len(name) > skillNameMaxLen:
+			r.add(lintError, f, "front-matter: name longer than %d characters", skillNameMaxLen)
+		case !skillNameRE.MatchString(name):
+			r.add(lintWarning, f, "front-matter: name %q should be lowercase letters, digits and dashes", name)
+		case name != skill:
+			r.add(lintWarning, f, "front-matter: name %q differs from the installed name %q", name, skill)
+		}
+		switch {
+		case desc == "":
+			r.add(lintError, f, "front-matter: description is required")
+		case len(desc) > skillDescMaxLen:
+			r.add(lintError, f, "front-matter: description longer than %d characters", skillDescMaxLen)
+		}
+	}
+	if strings.TrimSpace(body) == "" {
+		r.add(lintError, f, "no instructions after the front-matter")
+	} else if !skillHeadingRE.MatchString(body) {
+		r.add(lintWarning, f, "no headings; structure the instructions into sections")
+	}
+}
+
+// scanScript reports dangerous patterns with line numbers.
+func scanScript(r *skillReport, path, rel string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(io.LimitReader(f, skillScriptScanBytes))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		if strings.IndexByte(text, 0) >= 0 {
+			return // binary
+		}
+		for _, p := range dangerousPatterns {
+			if p.re.MatchString(text) {
+				r.add(p.level, fmt.Sprintf("%s:%d", rel, line), "%s", p.what)
+			}
+		}
+	}
+}
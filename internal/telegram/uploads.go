@@ -1,15 +1,24 @@
 package telegram
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
 	"mybot/internal/config"
+	"mybot/internal/metrics"
 	"mybot/internal/util"
 )
 
@@ -17,63 +26,438 @@ func uploadsRoot(cfg config.Config) string {
 	return filepath.Join(cfg.WorkDir, cfg.UploadDir)
 }
 
-func listUploads(root string, uploadDirName string, limit int) ([]string, error) {
+// chatUploadsDir is the per-chat upload area: WORKDIR/UPLOAD_DIR/<chat_id>.
+func chatUploadsDir(cfg config.Config, chatID int64) string {
+	return filepath.Join(uploadsRoot(cfg), strconv.FormatInt(chatID, 10))
+}
+
+// isChatDirName reports whether name is a per-chat folder of UPLOAD_DIR.
+// Other top-level entries are legacy uploads from before per-chat folders.
+func isChatDirName(name string) bool {
+	_, err := strconv.ParseInt(name, 10, 64)
+	return err == nil
+}
+
+// isLegacyUpload reports whether targetAbs is a legacy upload: an entry of the
+// UPLOAD_DIR root (or below one) that is not in a chat's folder.
+func isLegacyUpload(cfg config.Config, targetAbs string) bool {
+	rootAbs, err := filepath.Abs(uploadsRoot(cfg))
+	if err != nil || targetAbs == rootAbs || !withinDir(rootAbs, targetAbs) {
+		return false
+	}
+	top, _, _ := strings.Cut(targetAbs[len(rootAbs)+1:], string(os.PathSeparator))
+	return !isChatDirName(top)
+}
+
+// migrateLegacyUploads moves entries of the flat pre-per-chat layout into the
+// owning chat's folder. The owner is only known when the allowlist has a
+// single chat; otherwise the files stay where they are, shared: /uploads
+// lists them and names still resolve to them.
+func migrateLegacyUploads(cfg config.Config) (int, error) {
+	if len(cfg.Allowlist) != 1 {
+		return 0, nil
+	}
+	var owner int64
+	for id := range cfg.Allowlist {
+		owner = id
+	}
+	root := uploadsRoot(cfg)
 	ents, err := os.ReadDir(root)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, nil
+			return 0, nil
+		}
+		return 0, err
+	}
+	dst := chatUploadsDir(cfg, owner)
+	n := 0
+	for _, e := range ents {
+		if isChatDirName(e.Name()) {
+			continue
+		}
+		if err := os.MkdirAll(dst, 0o755); err != nil {
+			return n, err
+		}
+		to := filepath.Join(dst, e.Name())
+		if _, err := os.Lstat(to); err == nil {
+			continue // never overwrite; it stays listed as a legacy upload
+		}
+		if err := os.Rename(filepath.Join(root, e.Name()), to); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// quotaLeft returns how many bytes dir may still grow (-1 = unlimited).
+func quotaLeft(cfg config.Config, dir string) int64 {
+	if cfg.UploadQuotaBytes <= 0 {
+		return -1
+	}
+	left := cfg.UploadQuotaBytes - dirSize(dir)
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+func dirSize(root string) int64 {
+	var n int64
+	_ = filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			n += info.Size()
+		}
+		return nil
+	})
+	return n
+}
+
+// downloadUpload fetches a Telegram file into the chat's upload area and returns
+// its WORKDIR-relative path (for prompts) and absolute path.
+func downloadUpload(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.Config, chatID int64, fileID string, fileSize int, name string) (string, string, error) {
+	if cfg.MaxUploadBytes > 0 && int64(fileSize) > cfg.MaxUploadBytes {
+		return "", "", fmt.Errorf("file too large: %d bytes (max %d)", fileSize, cfg.MaxUploadBytes)
+	}
+
+	uploadDir := chatUploadsDir(cfg, chatID)
+	if err := os.MkdirAll(uploadDir, 0o755); err != nil {
+		return "", "", err
+	}
+	left := quotaLeft(cfg, uploadDir)
+	if left >= 0 && int64(fileSize) > left {
+		return "", "", quotaError(cfg, left)
+	}
+
+	dstName := util.UniqueUploadName(name)
+	dstPath := filepath.Join(uploadDir, dstName)
+
+	f, err := bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return "", "", err
+	}
+
+	limit := cfg.MaxUploadBytes
+	if left >= 0 && (limit <= 0 || left < limit) {
+		limit = left
+	}
+	want := int64(f.FileSize)
+	if want == 0 {
+		want = int64(fileSize)
+	}
+	opts := fetchOptions{
+		Want:     want,
+		Limit:    limit,
+		Retries:  cfg.DownloadRetries,
+		Progress: downloadProgress(bot, chatID, name, want),
+	}
+
+	var n int64
+	if cfg.BotAPILocal && filepath.IsAbs(f.FilePath) {
+		n, err = copyLocalFile(f.FilePath, dstPath, opts)
+	} else {
+		dctx, cancel := context.WithCancel(ctx)
+		if cfg.DownloadTimeout > 0 {
+			dctx, cancel = context.WithTimeout(ctx, cfg.DownloadTimeout)
+		}
+		n, err = fetchFile(dctx, &http.Client{}, fileURL(cfg, bot.Token, f.FilePath), dstPath, opts)
+		cancel()
+	}
+	if err != nil {
+		if left >= 0 && limit == left && n > left {
+			return "", "", quotaError(cfg, left)
+		}
+		return "", "", err
+	}
+	if left >= 0 && n > left {
+		_ = os.Remove(dstPath)
+		return "", "", quotaError(cfg, left)
+	}
+	metrics.UploadBytes.Add(float64(n))
+
+	rel, _ := filepath.Rel(cfg.WorkDir, dstPath)
+	return filepath.ToSlash(rel), dstPath, nil
+}
+
+func quotaError(cfg config.Config, left int64) error {
+	return fmt.Errorf("upload quota exceeded: %s left of %s (free space with /uploads clean)", util.HumanBytes(left), util.HumanBytes(cfg.UploadQuotaBytes))
+}
+
+// extractUpload unpacks an uploaded archive into UPLOAD_DIR/<timestamp>_<name>/
+// and returns a prompt with a tree listing of its content.
+func extractUpload(cfg config.Config, rel, abs string) (string, error) {
+	dir := abs[:len(abs)-len(util.ArchiveExt(abs))]
+	lim := util.ArchiveLimits{MaxBytes: cfg.ArchiveMaxBytes, MaxFiles: cfg.ArchiveMaxFiles}
+	// Extracted content counts against the chat's upload quota too.
+	if left := quotaLeft(cfg, filepath.Dir(abs)); left >= 0 {
+		if left == 0 {
+			return "", quotaError(cfg, left)
+		}
+		if lim.MaxBytes <= 0 || left < lim.MaxBytes {
+			lim.MaxBytes = left
 		}
+	}
+	res, err := util.ExtractArchive(abs, dir, lim)
+	if err != nil {
+		return "", err
+	}
+	dirRel := path.Join(path.Dir(rel), filepath.Base(dir))
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("User uploaded an archive saved at: %s\n", rel))
+	b.WriteString(fmt.Sprintf("It was extracted into: %s/ (%d files, %s", dirRel, res.Files, util.HumanBytes(res.Bytes)))
+	if res.Skipped > 0 {
+		b.WriteString(fmt.Sprintf(", %d links/special entries skipped", res.Skipped))
+	}
+	b.WriteString(")\nContents:\n")
+	b.WriteString(util.TreeListing(dir, 200))
+	b.WriteString("\n\nPlease look through the extracted files and use them as context.")
+	return b.String(), nil
+}
+
+// uploadEntry is one top-level item of a chat's upload area (a file or an extracted archive).
+type uploadEntry struct {
+	Rel  string
+	Size int64
+	Mod  time.Time
+	Dir  bool
+}
+
+// listLegacyUploads returns the legacy entries of the UPLOAD_DIR root, newest first.
+func listLegacyUploads(cfg config.Config) ([]uploadEntry, error) {
+	all, err := listUploads(cfg, uploadsRoot(cfg))
+	if err != nil {
 		return nil, err
 	}
+	var out []uploadEntry
+	for _, it := range all {
+		if !isChatDirName(path.Base(it.Rel)) {
+			out = append(out, it)
+		}
+	}
+	return out, nil
+}
 
-	type item struct {
-		name string
-		mod  time.Time
+// listUploads returns the entries of dir, newest first.
+func listUploads(cfg config.Config, dir string) ([]uploadEntry, error) {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
 	}
-	var items []item
+	var out []uploadEntry
 	for _, e := range ents {
-		if e.IsDir() {
+		info, err := e.Info()
+		if err != nil {
 			continue
 		}
+		full := filepath.Join(dir, e.Name())
+		rel, _ := filepath.Rel(cfg.WorkDir, full)
+		it := uploadEntry{Rel: filepath.ToSlash(rel), Size: info.Size(), Mod: info.ModTime(), Dir: e.IsDir()}
+		if it.Dir {
+			it.Size = dirSize(full)
+		}
+		out = append(out, it)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Mod.After(out[j].Mod) })
+	return out, nil
+}
+
+// cleanUploads removes top-level entries of dir last modified before now-olderThan
+// (everything when olderThan is 0).
+func cleanUploads(dir string, olderThan time.Duration, now time.Time) (int, int64, error) {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+	cutoff := now.Add(-olderThan)
+	n := 0
+	var freed int64
+	for _, e := range ents {
 		info, err := e.Info()
-		if err != nil {
+		if err != nil || (olderThan > 0 && !info.ModTime().Before(cutoff)) {
 			continue
 		}
-		items = append(items, item{name: e.Name(), mod: info.ModTime()})
+		full := filepath.Join(dir, e.Name())
+		size := info.Size()
+		if e.IsDir() {
+			size = dirSize(full)
+		}
+		if err := os.RemoveAll(full); err != nil {
+			return n, freed, err
+		}
+		n++
+		freed += size
+	}
+	return n, freed, nil
+}
+
+// parseAge parses a Go duration, also accepting whole days ("7d").
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("bad age %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
 	}
-	sort.Slice(items, func(i, j int) bool { return items[i].mod.After(items[j].mod) })
-	if limit <= 0 || limit > len(items) {
-		limit = len(items)
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("bad age %q (e.g. 7d, 12h, 30m)", s)
 	}
-	out := make([]string, 0, limit)
-	for i := 0; i < limit; i++ {
-		out = append(out, filepath.ToSlash(filepath.Join(uploadDirName, items[i].name)))
+	return d, nil
+}
+
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(d/(24*time.Hour)))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
 	}
-	return out, nil
 }
 
-func deleteUpload(cfg config.Config, arg string) (string, error) {
+// handleUploadsCmd: /uploads | /uploads clean [older-than]
+func handleUploadsCmd(bot *tgbotapi.BotAPI, cfg config.Config, msg *tgbotapi.Message, cmd []string) {
+	chatID := msg.Chat.ID
+	dir := chatUploadsDir(cfg, chatID)
+
+	if len(cmd) >= 2 && cmd[1] == "clean" {
+		var age time.Duration
+		if len(cmd) >= 3 {
+			d, err := parseAge(cmd[2])
+			if err != nil {
+				sendText(bot, chatID, "usage: /uploads clean [older-than, e.g. 7d|12h]")
+				return
+			}
+			age = d
+		}
+		n, freed, err := cleanUploads(dir, age, time.Now())
+		auditAction(cfg, msg, "/uploads clean", strings.Join(cmd[2:], " "), err)
+		if err != nil {
+			sendText(bot, chatID, fmt.Sprintf("uploads clean failed after %d items: %v", n, err))
+			return
+		}
+		sendText(bot, chatID, fmt.Sprintf("uploads clean: removed %d items, freed %s", n, util.HumanBytes(freed)))
+		return
+	}
+	if len(cmd) >= 2 && cmd[1] != "ls" && cmd[1] != "list" {
+		sendText(bot, chatID, "usage: /uploads | /uploads clean [older-than]")
+		return
+	}
+
+	items, err := listUploads(cfg, dir)
+	if err != nil {
+		sendText(bot, chatID, fmt.Sprintf("uploads: %v", err))
+		return
+	}
+	legacy, err := listLegacyUploads(cfg)
+	if err != nil {
+		sendText(bot, chatID, fmt.Sprintf("uploads: %v", err))
+		return
+	}
+	if len(items) == 0 && len(legacy) == 0 {
+		sendText(bot, chatID, "uploads: (empty)")
+		return
+	}
+	var used int64
+	for _, it := range items {
+		used += it.Size
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("uploads: %d items, %s", len(items), util.HumanBytes(used)))
+	if cfg.UploadQuotaBytes > 0 {
+		b.WriteString(fmt.Sprintf(" of %s quota", util.HumanBytes(cfg.UploadQuotaBytes)))
+	}
+	b.WriteString("\n")
+	now := time.Now()
+	writeUploadList(&b, items, now)
+	if len(legacy) > 0 {
+		b.WriteString(fmt.Sprintf("\nshared, from before per-chat folders (%d items, not in the quota):\n", len(legacy)))
+		writeUploadList(&b, legacy, now)
+	}
+	sendText(bot, chatID, b.String())
+}
+
+func writeUploadList(b *strings.Builder, items []uploadEntry, now time.Time) {
+	for i, it := range items {
+		if i == 20 {
+			b.WriteString(fmt.Sprintf("… and %d more\n", len(items)-i))
+			break
+		}
+		name := it.Rel
+		if it.Dir {
+			name += "/"
+		}
+		b.WriteString(fmt.Sprintf("- %s (%s, %s ago)\n", name, util.HumanBytes(it.Size), formatAge(now.Sub(it.Mod))))
+	}
+}
+
+func deleteUpload(cfg config.Config, chatID int64, arg string) (string, error) {
+	targetAbs, err := resolveUpload(cfg, chatID, arg)
+	if err != nil {
+		return "", err
+	}
+	// Extracted archives are directories directly in the chat's area (or,
+	// for legacy uploads, in the UPLOAD_DIR root).
+	rm := os.Remove
+	if fi, err := os.Stat(targetAbs); err == nil && fi.IsDir() {
+		parent := filepath.Dir(targetAbs)
+		if rootAbs, _ := filepath.Abs(uploadsRoot(cfg)); filepath.Base(parent) == strconv.FormatInt(chatID, 10) || parent == rootAbs {
+			rm = os.RemoveAll
+		}
+	}
+	if err := rm(targetAbs); err != nil {
+		return "", err
+	}
+	rel, _ := filepath.Rel(cfg.WorkDir, targetAbs)
+	return filepath.ToSlash(rel), nil
+}
+
+// resolveUpload maps a bare name (newest "<timestamp>_<name>" match) or a path to
+// an absolute path inside the chat's own upload area, or to a legacy upload
+// in the UPLOAD_DIR root when the chat has no match.
+func resolveUpload(cfg config.Config, chatID int64, arg string) (string, error) {
 	arg = strings.TrimSpace(arg)
 	if arg == "" {
 		return "", errors.New("empty target")
 	}
-	root := uploadsRoot(cfg)
+	root := chatUploadsDir(cfg, chatID)
 	rootAbs, _ := filepath.Abs(root)
 
 	// If arg is a bare filename (no separators), resolve to the newest match.
 	if !strings.ContainsAny(arg, `/\`) {
 		// Try exact name and suffix match for original names: <timestamp>_<original>
 		want := util.SafeFilename(arg)
-		cand, err := newestMatch(root, func(name string) bool {
+		match := func(name string) bool {
 			return name == want || strings.HasSuffix(name, "_"+want)
-		})
+		}
+		cand, err := newestMatch(root, match)
 		if err != nil {
 			return "", err
 		}
+		dir := root
+		if cand == "" {
+			dir = uploadsRoot(cfg)
+			if cand, err = newestMatch(dir, func(name string) bool { return !isChatDirName(name) && match(name) }); err != nil {
+				return "", err
+			}
+		}
 		if cand == "" {
 			return "", fmt.Errorf("not found in %s: %s", cfg.UploadDir, want)
 		}
-		arg = filepath.Join(root, cand)
+		arg = filepath.Join(dir, cand)
 	} else {
 		// Treat as a path; if relative, resolve from WORKDIR.
 		if !filepath.IsAbs(arg) {
@@ -85,18 +469,19 @@ func deleteUpload(cfg config.Config, arg string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	// Constrain deletion to uploads root.
-	if rootAbs != "" {
-		if !strings.HasPrefix(targetAbs, rootAbs+string(os.PathSeparator)) && targetAbs != rootAbs {
-			return "", fmt.Errorf("refusing to delete outside uploads dir: %s", targetAbs)
-		}
+	// Constrain to this chat's uploads.
+	if isLegacyUpload(cfg, targetAbs) {
+		return targetAbs, nil
 	}
-
-	if err := os.Remove(targetAbs); err != nil {
-		return "", err
+	if rootAbs != "" && (!withinDir(rootAbs, targetAbs) || targetAbs == rootAbs) {
+		return "", fmt.Errorf("refusing to touch files outside this chat's uploads: %s", targetAbs)
 	}
-	rel, _ := filepath.Rel(cfg.WorkDir, targetAbs)
-	return filepath.ToSlash(rel), nil
+	return targetAbs, nil
+}
+
+// withinDir reports whether targetAbs is rootAbs or below it. Both must be absolute and clean.
+func withinDir(rootAbs, targetAbs string) bool {
+	return targetAbs == rootAbs || strings.HasPrefix(targetAbs, rootAbs+string(os.PathSeparator))
 }
 
 func newestMatch(root string, ok func(name string) bool) (string, error) {
@@ -110,9 +495,6 @@ func newestMatch(root string, ok func(name string) bool) (string, error) {
 	var best string
 	var bestTime time.Time
 	for _, e := range ents {
-		if e.IsDir() {
-			continue
-		}
 		name := e.Name()
 		if !ok(name) {
 			continue
@@ -141,3 +523,52 @@ func nlDeleteArg(text string) (string, bool) {
 	}
 	return "", false
 }
+
+// RunUploadCleaner enforces UPLOAD_RETENTION: once at startup, then hourly, it removes
+// upload entries older than the retention from every chat folder. Files left in the
+// UPLOAD_DIR root by older versions (before per-chat folders) age out the same way.
+func RunUploadCleaner(ctx context.Context, live *config.Live) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		// Checked on every pass: a reload may turn retention on or off.
+		if cfg := live.Get(); cfg.UploadRetention > 0 {
+			sweepUploads(cfg, time.Now())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func sweepUploads(cfg config.Config, now time.Time) {
+	root := uploadsRoot(cfg)
+	ents, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	cutoff := now.Add(-cfg.UploadRetention)
+	for _, e := range ents {
+		full := filepath.Join(root, e.Name())
+		if isChatDirName(e.Name()) && e.IsDir() {
+			n, freed, err := cleanUploads(full, cfg.UploadRetention, now)
+			if err != nil {
+				log.Printf("uploads: cleaning %s: %v", full, err)
+			}
+			if n > 0 {
+				log.Printf("uploads: retention removed %d items (%s) from %s", n, util.HumanBytes(freed), full)
+			}
+			continue
+		}
+		// Legacy flat layout.
+		info, err := e.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(full); err != nil {
+			log.Printf("uploads: cleaning %s: %v", full, err)
+		}
+	}
+}
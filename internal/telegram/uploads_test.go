@@ -0,0 +1,100 @@
+package telegram
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mybot/internal/config"
+)
+
+func TestUploads_PerChatIsolationAndClean(t *testing.T) {
+	root := t.TempDir()
+	cfg := config.Config{WorkDir: root, UploadDir: "uploads"}
+	mk := func(chatID int64, name string, age time.Duration) string {
+		dir := chatUploadsDir(cfg, chatID)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mt := time.Now().Add(-age)
+		if err := os.Chtimes(p, mt, mt); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	mine := mk(1, "20260101_000000_a.txt", 0)
+	mk(2, "20260101_000000_b.txt", 0)
+
+	if got, err := resolveUpload(cfg, 1, "a.txt"); err != nil || got != mine {
+		t.Fatalf("own file: got=%q err=%v", got, err)
+	}
+	for _, arg := range []string{"b.txt", "uploads/2/20260101_000000_b.txt", "uploads/1", "uploads/1/../2/20260101_000000_b.txt"} {
+		if _, err := resolveUpload(cfg, 1, arg); err == nil {
+			t.Fatalf("%q: expected error", arg)
+		}
+	}
+
+	mk(1, "old.txt", 10*24*time.Hour)
+	items, err := listUploads(cfg, chatUploadsDir(cfg, 1))
+	if err != nil || len(items) != 2 || items[0].Rel != "uploads/1/20260101_000000_a.txt" {
+		t.Fatalf("list: %+v %v", items, err)
+	}
+
+	age, err := parseAge("7d")
+	if err != nil || age != 7*24*time.Hour {
+		t.Fatalf("parseAge: %v %v", age, err)
+	}
+	n, freed, err := cleanUploads(chatUploadsDir(cfg, 1), age, time.Now())
+	if err != nil || n != 1 || freed != 4 {
+		t.Fatalf("clean: n=%d freed=%d err=%v", n, freed, err)
+	}
+	if _, err := os.Stat(mine); err != nil {
+		t.Fatalf("recent file removed: %v", err)
+	}
+}
+
+func TestUploads_Legacy(t *testing.T) {
+	root := t.TempDir()
+	cfg := config.Config{WorkDir: root, UploadDir: "uploads", Allowlist: map[int64]struct{}{1: {}, 2: {}}}
+	legacy := filepath.Join(uploadsRoot(cfg), "20250101_000000_old.txt")
+	if err := os.MkdirAll(chatUploadsDir(cfg, 2), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacy, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two chats: the owner is unknown, so the file stays shared.
+	if n, err := migrateLegacyUploads(cfg); err != nil || n != 0 {
+		t.Fatalf("migrate with two chats: n=%d err=%v", n, err)
+	}
+	for _, arg := range []string{"old.txt", "uploads/20250101_000000_old.txt"} {
+		if got, err := resolveUpload(cfg, 1, arg); err != nil || got != legacy {
+			t.Fatalf("%q: got=%q err=%v", arg, got, err)
+		}
+	}
+	items, err := listLegacyUploads(cfg)
+	if err != nil || len(items) != 1 || items[0].Rel != "uploads/20250101_000000_old.txt" {
+		t.Fatalf("legacy list: %+v %v", items, err)
+	}
+	if _, err := resolveUpload(cfg, 1, "uploads"); err == nil {
+		t.Fatal("UPLOAD_DIR root itself resolved")
+	}
+
+	// One chat: it owns everything from the flat layout.
+	cfg.Allowlist = map[int64]struct{}{1: {}}
+	if n, err := migrateLegacyUploads(cfg); err != nil || n != 1 {
+		t.Fatalf("migrate: n=%d err=%v", n, err)
+	}
+	if got, err := resolveUpload(cfg, 1, "old.txt"); err != nil || got != filepath.Join(chatUploadsDir(cfg, 1), "20250101_000000_old.txt") {
+		t.Fatalf("after migrate: got=%q err=%v", got, err)
+	}
+	if _, err := os.Stat(chatUploadsDir(cfg, 2)); err != nil {
+		t.Fatalf("chat folder moved: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package transcript
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// entry is a renderer-neutral view of one transcript step.
+type entry struct {
+	role string // "user", "agent", "command", "files", "stderr", "usage", "note"
+	time string
+	text string
+	code string // command output / fenced content
+}
+
+func entries(recs []Record) []entry {
+	var out []entry
+	for _, r := range recs {
+		ts := r.Time.Local().Format("2006-01-02 15:04:05")
+		switch r.Type {
+		case TypePrompt:
+			out = append(out, entry{role: "user", time: ts, text: r.Text})
+		case TypeStderr:
+			out = append(out, entry{role: "stderr", time: ts, text: strings.TrimRight(r.Text, "\n")})
+		case TypeNote:
+			out = append(out, entry{role: "note", time: ts, text: r.Text})
+		case TypeCodex:
+			if r.Usage != nil {
+				out = append(out, entry{role: "usage", time: ts, text: fmt.Sprintf("tokens: input=%d cached=%d output=%d",
+					r.Usage.InputTokens, r.Usage.CachedInputTokens, r.Usage.OutputTokens)})
+				continue
+			}
+			if r.Event != "item.completed" {
+				continue
+			}
+			it := r.ParseItem()
+			if it == nil {
+				continue
+			}
+			switch it.Type {
+			case "agent_message":
+				out = append(out, entry{role: "agent", time: ts, text: it.Text})
+			case "command_execution":
+				e := entry{role: "command", time: ts, text: it.Command, code: strings.TrimRight(it.AggregatedOutput, "\n")}
+				if it.ExitCode != nil {
+					e.text += fmt.Sprintf("  (exit %d)", *it.ExitCode)
+				}
+				out = append(out, e)
+			case "file_change":
+				var lines []string
+				for _, c := range it.Changes {
+					lines = append(lines, fmt.Sprintf("%s %s", c.Kind, c.Path))
+				}
+				if len(lines) > 0 {
+					out = append(out, entry{role: "files", time: ts, text: strings.Join(lines, "\n")})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// RenderMarkdown renders a transcript as a Markdown document.
+func RenderMarkdown(sessionID string, recs []Record) string {
+	var b strings.Builder
+	b.WriteString("# Session " + sessionID + "\n\n")
+	for _, e := range entries(recs) {
+		switch e.role {
+		case "user":
+			fmt.Fprintf(&b, "## User · %s\n\n%s\n\n", e.time, e.text)
+		case "agent":
+			fmt.Fprintf(&b, "## Agent · %s\n\n%s\n\n", e.time, e.text)
+		case "command":
+			fmt.Fprintf(&b, "**$ %s**\n\n", e.text)
+			if e.code != "" {
+				b.WriteString(fence(e.code))
+			}
+		case "files":
+			b.WriteString("Files changed:\n\n")
+			for _, l := range strings.Split(e.text, "\n") {
+				b.WriteString("- `" + l + "`\n")
+			}
+			b.WriteString("\n")
+		case "stderr":
+			b.WriteString(fence(e.text))
+		case "usage", "note":
+			fmt.Fprintf(&b, "> %s\n\n", e.text)
+		}
+	}
+	return b.String()
+}
+
+func fence(s string) string {
+	f := "```"
+	for strings.Contains(s, f) {
+		f += "`"
+	}
+	return f + "\n" + s + "\n" + f + "\n\n"
+}
+
+// RenderHTML renders a transcript as a standalone HTML page.
+func RenderHTML(sessionID string, recs []Record) string {
+	var b strings.Builder
+	b.WriteString("<!doctype html>\n<html><head><meta charset=\"utf-8\">\n")
+	b.WriteString("<title>Session " + html.EscapeString(sessionID) + "</title>\n")
+	b.WriteString("<style>body{font-family:sans-serif;max-width:860px;margin:2em auto;line-height:1.5}" +
+		".msg{white-space:pre-wrap;margin:0 0 1.2em}.meta{color:#888;font-size:.85em}" +
+		"pre{background:#f5f5f5;padding:.6em;overflow-x:auto}.note{color:#666;border-left:3px solid #ddd;padding-left:.6em}</style>\n")
+	b.WriteString("</head><body>\n")
+	b.WriteString("<h1>Session " + html.EscapeString(sessionID) + "</h1>\n")
+	for _, e := range entries(recs) {
+		switch e.role {
+		case "user", "agent":
+			title := "User"
+			if e.role == "agent" {
+				title = "Agent"
+			}
+			fmt.Fprintf(&b, "<h3>%s <span class=\"meta\">%s</span></h3>\n<div class=\"msg\">%s</div>\n",
+				title, html.EscapeString(e.time), html.EscapeString(e.text))
+		case "command":
+			fmt.Fprintf(&b, "<p><b>$ %s</b></p>\n", html.EscapeString(e.text))
+			if e.code != "" {
+				fmt.Fprintf(&b, "<pre>%s</pre>\n", html.EscapeString(e.code))
+			}
+		case "files":
+			b.WriteString("<p>Files changed:</p>\n<ul>\n")
+			for _, l := range strings.Split(e.text, "\n") {
+				fmt.Fprintf(&b, "<li><code>%s</code></li>\n", html.EscapeString(l))
+			}
+			b.WriteString("</ul>\n")
+		case "stderr":
+			fmt.Fprintf(&b, "<pre>%s</pre>\n", html.EscapeString(e.text))
+		case "usage", "note":
+			fmt.Fprintf(&b, "<p class=\"note\">%s</p>\n", html.EscapeString(e.text))
+		}
+	}
+	b.WriteString("</body></html>\n")
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package transcript
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleRecords() []Record {
+	at := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	return []Record{
+		{Time: at, Type: TypePrompt, Text: "list <files>"},
+		{Time: at, Type: TypeCodex, Event: "item.started", Item: json.RawMessage(`{"type":"command_execution","command":"ls"}`)},
+		{Time: at, Type: TypeCodex, Event: "item.completed", Item: json.RawMessage(`{"type":"command_execution","command":"ls","aggregated_output":"a.md\n` + "```" + `\n","exit_code":0}`)},
+		{Time: at, Type: TypeCodex, Event: "item.completed", Item: json.RawMessage(`{"type":"file_change","changes":[{"path":"a.md","kind":"update"}]}`)},
+		{Time: at, Type: TypeCodex, Event: "item.completed", Item: json.RawMessage(`{"type":"agent_message","text":"Done & dusted"}`)},
+		{Time: at, Type: TypeCodex, Event: "turn.completed", Usage: &Usage{InputTokens: 10, CachedInputTokens: 4, OutputTokens: 3}},
+		{Time: at, Type: TypeStderrFiltered, Text: "noise"},
+		{Time: at, Type: TypeStderr, Text: "warning\n"},
+		{Time: at, Type: TypeNote, Text: "resumed"},
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	ts := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC).Local().Format("2006-01-02 15:04:05")
+	want := "# Session s1\n\n" +
+		"## User · " + ts + "\n\nlist <files>\n\n" +
+		"**$ ls  (exit 0)**\n\n" +
+		"````\na.md\n```\n````\n\n" + // the fence outgrows backticks in the output
+		"Files changed:\n\n- `update a.md`\n\n" +
+		"## Agent · " + ts + "\n\nDone & dusted\n\n" +
+		"> tokens: input=10 cached=4 output=3\n\n" +
+		"```\nwarning\n```\n\n" +
+		"> resumed\n\n"
+	if got := RenderMarkdown("s1", sampleRecords()); got != want {
+		t.Fatalf("--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	got := RenderHTML("s<1>", sampleRecords())
+	for _, want := range []string{
+		"<title>Session s&lt;1&gt;</title>",
+		`<div class="msg">list &lt;files&gt;</div>`,
+		"<p><b>$ ls  (exit 0)</b></p>\n<pre>a.md\n```</pre>",
+		"<li><code>update a.md</code></li>",
+		`<div class="msg">Done &amp; dusted</div>`,
+		`<p class="note">tokens: input=10 cached=4 output=3</p>`,
+		"<pre>warning</pre>",
+		`<p class="note">resumed</p>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "noise") {
+		t.Error("filtered stderr rendered")
+	}
+}
@@ -0,0 +1,174 @@
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mybot/internal/util"
+)
+
+// Record types.
+const (
+	TypePrompt         = "prompt"          // user input sent to the agent
+	TypeCodex          = "codex"           // raw codex exec JSONL event
+	TypeStderr         = "stderr"          // stderr line shown to the user
+	TypeStderrFiltered = "stderr_filtered" // known-noisy stderr line hidden from the user
+	TypeNote           = "note"            // bot-side annotations (resume, errors)
+)
+
+// Record is one line in a session transcript (LOG_DIR/sessions/<session_id>.jsonl).
+type Record struct {
+	Time time.Time `json:"ts"`
+	Type string    `json:"type"`
+
+	// Event is the codex event type for TypeCodex records (e.g. "item.completed").
+	Event string `json:"event,omitempty"`
+	Text  string `json:"text,omitempty"`
+
+	// Context holds injected prefix text (memory rules/summary) for TypePrompt.
+	Context  string          `json:"context,omitempty"`
+	Images   []string        `json:"images,omitempty"`
+	ThreadID string          `json:"thread_id,omitempty"`
+	Item     json.RawMessage `json:"item,omitempty"`
+	Usage    *Usage          `json:"usage,omitempty"`
+	Raw      json.RawMessage `json:"raw,omitempty"`
+}
+
+type Usage struct {
+	InputTokens       int `json:"input_tokens"`
+	CachedInputTokens int `json:"cached_input_tokens"`
+	OutputTokens      int `json:"output_tokens"`
+}
+
+// Item is the subset of a codex item we know how to render.
+type Item struct {
+	Type             string `json:"type"`
+	Text             string `json:"text"`
+	Command          string `json:"command"`
+	AggregatedOutput string `json:"aggregated_output"`
+	ExitCode         *int   `json:"exit_code"`
+	Changes          []struct {
+		Path string `json:"path"`
+		Kind string `json:"kind"`
+	} `json:"changes"`
+}
+
+func Dir(logDir string) string {
+	return filepath.Join(logDir, "sessions")
+}
+
+// Path returns the structured transcript path for a session.
+func Path(logDir, sessionID string) string {
+	return filepath.Join(Dir(logDir), sessionID+".jsonl")
+}
+
+// LegacyPath returns the free-form text transcript path (interactive mode, older sessions).
+func LegacyPath(logDir, sessionID string) string {
+	return filepath.Join(Dir(logDir), sessionID+".log")
+}
+
+var appendMu sync.Mutex
+
+// Append writes r as one JSON line. Best-effort: errors are ignored like other transcript writes.
+func Append(logDir, sessionID string, r Record) {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	appendMu.Lock()
+	defer appendMu.Unlock()
+	_ = os.MkdirAll(Dir(logDir), 0o755)
+	f, err := os.OpenFile(Path(logDir, sessionID), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	_, _ = f.WriteString(util.Redact(string(b)) + "\n")
+}
+
+// Read parses a transcript file. Malformed lines are skipped.
+func Read(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []Record
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 8*1024*1024)
+	for sc.Scan() {
+		var r Record
+		if json.Unmarshal(sc.Bytes(), &r) != nil {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, sc.Err()
+}
+
+// ParseItem decodes the codex item of a record (nil if absent or malformed).
+func (r Record) ParseItem() *Item {
+	if len(r.Item) == 0 {
+		return nil
+	}
+	var it Item
+	if json.Unmarshal(r.Item, &it) != nil {
+		return nil
+	}
+	return &it
+}
+
+// SessionInfo describes a transcript on disk.
+type SessionInfo struct {
+	ID      string
+	ModTime time.Time
+	Size    int64
+}
+
+// List returns sessions whose id starts with prefix, newest first.
+func List(logDir, prefix string) ([]SessionInfo, error) {
+	ents, err := os.ReadDir(Dir(logDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	seen := map[string]int{}
+	var out []SessionInfo
+	for _, e := range ents {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		id := strings.TrimSuffix(strings.TrimSuffix(name, ".jsonl"), ".log")
+		if id == name || !strings.HasPrefix(id, prefix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		// Prefer the structured file's stats when both exist.
+		if i, ok := seen[id]; ok {
+			if strings.HasSuffix(name, ".jsonl") {
+				out[i] = SessionInfo{ID: id, ModTime: info.ModTime(), Size: info.Size()}
+			}
+			continue
+		}
+		seen[id] = len(out)
+		out = append(out, SessionInfo{ID: id, ModTime: info.ModTime(), Size: info.Size()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ModTime.After(out[j].ModTime) })
+	return out, nil
+}
@@ -0,0 +1,96 @@
+package transcript
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppendRead(t *testing.T) {
+	dir := t.TempDir()
+	at := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	Append(dir, "chat_1", Record{Time: at, Type: TypePrompt, Text: "hello", Images: []string{"a.png"}})
+	Append(dir, "chat_1", Record{Type: TypeCodex, Event: "turn.completed", Usage: &Usage{InputTokens: 10, OutputTokens: 3}})
+
+	// A malformed line (e.g. a crash mid-write) is skipped, not fatal.
+	f, err := os.OpenFile(Path(dir, "chat_1"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("{not json\n")
+	_ = f.Close()
+	Append(dir, "chat_1", Record{Type: TypeNote, Text: "resumed"})
+
+	recs, err := Read(Path(dir, "chat_1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("got %d records: %+v", len(recs), recs)
+	}
+	if !recs[0].Time.Equal(at) || recs[0].Text != "hello" || len(recs[0].Images) != 1 {
+		t.Fatalf("prompt = %+v", recs[0])
+	}
+	if recs[1].Time.IsZero() || recs[1].Usage == nil || recs[1].Usage.InputTokens != 10 {
+		t.Fatalf("usage = %+v", recs[1])
+	}
+	if recs[2].Type != TypeNote {
+		t.Fatalf("note = %+v", recs[2])
+	}
+}
+
+func TestParseItem(t *testing.T) {
+	r := Record{Item: json.RawMessage(`{"type":"command_execution","command":"ls","exit_code":0}`)}
+	it := r.ParseItem()
+	if it == nil || it.Command != "ls" || it.ExitCode == nil || *it.ExitCode != 0 {
+		t.Fatalf("item = %+v", it)
+	}
+	if (Record{Item: json.RawMessage(`[`)}).ParseItem() != nil || (Record{}).ParseItem() != nil {
+		t.Fatal("want nil for malformed or missing items")
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	if got, err := List(dir, ""); err != nil || got != nil {
+		t.Fatalf("missing dir: %v, %v", got, err)
+	}
+	sessions := Dir(dir)
+	if err := os.MkdirAll(filepath.Join(sessions, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, f := range []struct {
+		name string
+		body string
+	}{
+		{"chat_1_a.log", "legacy text"},
+		{"chat_1_a.jsonl", "{}\n"},
+		{"chat_1_b.jsonl", "{}\n{}\n"},
+		{"chat_2_c.jsonl", "{}\n"},
+		{"chat_1_notes.txt", "ignored"},
+	} {
+		p := filepath.Join(sessions, f.name)
+		if err := os.WriteFile(p, []byte(f.body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mt := now.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(p, mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := List(dir, "chat_1_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != "chat_1_b" || got[1].ID != "chat_1_a" {
+		t.Fatalf("list = %+v", got)
+	}
+	// chat_1_a has both files; the structured one's stats win.
+	if got[1].Size != 3 {
+		t.Fatalf("chat_1_a size = %d, want the .jsonl size", got[1].Size)
+	}
+}
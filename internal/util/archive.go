@@ -0,0 +1,266 @@
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveLimits bounds what an extraction may write. Zero means unlimited.
+type ArchiveLimits struct {
+	MaxBytes int64
+	MaxFiles int // files and directories alike
+}
+
+// ExtractResult summarizes an extraction.
+type ExtractResult struct {
+	Files   int
+	Bytes   int64
+	Skipped int // symlinks, devices and other non-regular entries
+}
+
+var archiveExts = []string{".tar.gz", ".tgz", ".zip", ".tar"}
+
+// ArchiveExt returns the archive extension of name (".zip", ".tar", ".tar.gz", ".tgz") or "".
+func ArchiveExt(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExts {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// ExtractArchive unpacks src into dst, which must not exist yet. Entry names are
+// confined to dst (no absolute paths or ".."), only regular files and
+// directories are created, and the limits are enforced on bytes actually
+// written, not on sizes claimed by headers. On error dst is removed.
+func ExtractArchive(src, dst string, lim ArchiveLimits) (ExtractResult, error) {
+	var res ExtractResult
+	if err := os.Mkdir(dst, 0o755); err != nil {
+		return res, err
+	}
+	x := &extractor{dst: dst, lim: lim, res: &res}
+
+	var err error
+	switch ArchiveExt(src) {
+	case ".zip":
+		err = x.zip(src)
+	case ".tar":
+		err = x.tarFile(src, false)
+	case ".tar.gz", ".tgz":
+		err = x.tarFile(src, true)
+	default:
+		err = fmt.Errorf("unsupported archive: %s", filepath.Base(src))
+	}
+	if err != nil {
+		_ = os.RemoveAll(dst)
+		return res, err
+	}
+	return res, nil
+}
+
+type extractor struct {
+	dst string
+	lim ArchiveLimits
+	res *ExtractResult
+	// entries counts files and directories created, for MaxFiles: an
+	// archive of empty directories costs inodes too.
+	entries int
+}
+
+func (x *extractor) count() error {
+	if x.lim.MaxFiles > 0 && x.entries >= x.lim.MaxFiles {
+		return fmt.Errorf("archive has too many files (max %d)", x.lim.MaxFiles)
+	}
+	x.entries++
+	return nil
+}
+
+// target maps an archive entry name to a path inside dst.
+func (x *extractor) target(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" || strings.HasPrefix(name, "/") ||
+		clean == ".." || strings.HasPrefix(clean, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("illegal path in archive: %q", name)
+	}
+	p := filepath.Join(x.dst, clean)
+	if p != x.dst && !strings.HasPrefix(p, x.dst+string(os.PathSeparator)) {
+		return "", fmt.Errorf("illegal path in archive: %q", name)
+	}
+	return p, nil
+}
+
+func (x *extractor) mkdir(name string) error {
+	p, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	if err := x.count(); err != nil {
+		return err
+	}
+	return os.MkdirAll(p, 0o755)
+}
+
+func (x *extractor) file(name string, mode fs.FileMode, r io.Reader) error {
+	p, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	if err := x.count(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	perm := fs.FileMode(0o644)
+	if mode&0o111 != 0 {
+		perm = 0o755
+	}
+	// O_EXCL: a duplicate entry must not overwrite (or follow) something already extracted.
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if x.lim.MaxBytes > 0 {
+		r = io.LimitReader(r, x.lim.MaxBytes-x.res.Bytes+1)
+	}
+	n, err := io.Copy(f, r)
+	x.res.Bytes += n
+	if err != nil {
+		return err
+	}
+	if x.lim.MaxBytes > 0 && x.res.Bytes > x.lim.MaxBytes {
+		return fmt.Errorf("archive expands beyond %d bytes", x.lim.MaxBytes)
+	}
+	x.res.Files++
+	return nil
+}
+
+func (x *extractor) zip(src string) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := x.mkdir(f.Name); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			err = x.file(f.Name, mode, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			x.res.Skipped++
+		}
+	}
+	return nil
+}
+
+func (x *extractor) tarFile(src string, gz bool) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if gz {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := x.mkdir(h.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := x.file(h.Name, fs.FileMode(h.Mode), tr); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader:
+			// Metadata only.
+		default:
+			x.res.Skipped++
+		}
+	}
+}
+
+// TreeListing renders the files under root as an indented tree with sizes,
+// truncated after maxLines entries.
+func TreeListing(root string, maxLines int) string {
+	var lines []string
+	total := 0
+	_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == root {
+			return nil
+		}
+		total++
+		if maxLines > 0 && len(lines) >= maxLines {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		depth := strings.Count(filepath.ToSlash(rel), "/")
+		line := strings.Repeat("  ", depth) + d.Name()
+		if d.IsDir() {
+			line += "/"
+		} else if info, err := d.Info(); err == nil {
+			line += fmt.Sprintf(" (%s)", HumanBytes(info.Size()))
+		}
+		lines = append(lines, line)
+		return nil
+	})
+	if total > len(lines) {
+		lines = append(lines, fmt.Sprintf("… (%d more entries)", total-len(lines)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// HumanBytes formats n as B/KB/MB/GB.
+func HumanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	units := []string{"KB", "MB", "GB", "TB"}
+	v := float64(n) / unit
+	i := 0
+	for v >= unit && i < len(units)-1 {
+		v /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", v, units[i])
+}
@@ -0,0 +1,125 @@
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractArchive_Zip(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.zip")
+	writeZip(t, src, map[string]string{"README.md": "hi", "src/main.go": "package main"})
+
+	dst := filepath.Join(dir, "a")
+	res, err := ExtractArchive(src, dst, ArchiveLimits{MaxBytes: 1024, MaxFiles: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Files != 2 || res.Bytes != int64(len("hi")+len("package main")) {
+		t.Fatalf("res = %+v", res)
+	}
+	if b, err := os.ReadFile(filepath.Join(dst, "src", "main.go")); err != nil || string(b) != "package main" {
+		t.Fatalf("main.go: %q %v", b, err)
+	}
+	tree := TreeListing(dst, 0)
+	if !strings.Contains(tree, "src/\n  main.go (12B)") {
+		t.Fatalf("tree:\n%s", tree)
+	}
+}
+
+func TestExtractArchive_RejectsZipSlip(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"../evil.txt", "/abs.txt", `..\evil.txt`, "ok/../../evil.txt"} {
+		src := filepath.Join(dir, "slip.zip")
+		writeZip(t, src, map[string]string{name: "x"})
+		dst := filepath.Join(dir, "out")
+		if _, err := ExtractArchive(src, dst, ArchiveLimits{}); err == nil {
+			t.Fatalf("%q: expected error", name)
+		}
+		if _, err := os.Stat(dst); !os.IsNotExist(err) {
+			t.Fatalf("%q: dst not cleaned up", name)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "evil.txt")); err == nil {
+			t.Fatalf("%q: file escaped", name)
+		}
+	}
+}
+
+func TestExtractArchive_Limits(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "bomb.zip")
+	// Highly compressible payload: small archive, large output.
+	writeZip(t, src, map[string]string{"zeros": strings.Repeat("\x00", 1<<20)})
+	if _, err := ExtractArchive(src, filepath.Join(dir, "b"), ArchiveLimits{MaxBytes: 64 * 1024}); err == nil {
+		t.Fatal("expected size cap error")
+	}
+
+	src = filepath.Join(dir, "many.zip")
+	writeZip(t, src, map[string]string{"1": "a", "2": "b", "3": "c"})
+	if _, err := ExtractArchive(src, filepath.Join(dir, "m"), ArchiveLimits{MaxFiles: 2}); err == nil {
+		t.Fatal("expected file count error")
+	}
+
+	// Directory entries count too: no unbounded mkdir from an empty tree.
+	src = filepath.Join(dir, "dirs.zip")
+	writeZip(t, src, map[string]string{"a/": "", "b/": "", "c/": ""})
+	if _, err := ExtractArchive(src, filepath.Join(dir, "d"), ArchiveLimits{MaxFiles: 2}); err == nil {
+		t.Fatal("expected entry count error for directories")
+	}
+}
+
+func TestExtractArchive_TarGzSkipsLinks(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	_ = tw.WriteHeader(&tar.Header{Name: "d/", Typeflag: tar.TypeDir, Mode: 0o755})
+	_ = tw.WriteHeader(&tar.Header{Name: "d/f.txt", Typeflag: tar.TypeReg, Mode: 0o644, Size: 3})
+	_, _ = tw.Write([]byte("abc"))
+	_ = tw.WriteHeader(&tar.Header{Name: "d/link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+	_ = tw.Close()
+	_ = gz.Close()
+	src := filepath.Join(dir, "x.tgz")
+	if err := os.WriteFile(src, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "x")
+	res, err := ExtractArchive(src, dst, ArchiveLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Files != 1 || res.Skipped != 1 {
+		t.Fatalf("res = %+v", res)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "d", "link")); !os.IsNotExist(err) {
+		t.Fatal("symlink was created")
+	}
+}
@@ -0,0 +1,152 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDiffCells bounds the LCS table; larger inputs are diffed as a whole replacement.
+const maxDiffCells = 4 << 20
+
+// UnifiedDiff returns a unified diff (like `diff -u`) turning a into b, with
+// context lines around each change. It returns "" when a and b are equal.
+func UnifiedDiff(oldName, newName, a, b string, context int) string {
+	if a == b {
+		return ""
+	}
+	x, y := diffLines(a), diffLines(b)
+	ops := lineOps(x, y)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Grow the hunk while changes are at most 2*context lines apart.
+		start := max(i-context, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end = min(end+context, len(ops))
+				break
+			}
+			end = run
+		}
+		oldStart, newStart, oldN, newN := ops[start].a+1, ops[start].b+1, 0, 0
+		var body strings.Builder
+		for _, op := range ops[start:end] {
+			switch op.kind {
+			case ' ':
+				oldN++
+				newN++
+				body.WriteString(" " + x[op.a])
+			case '-':
+				oldN++
+				body.WriteString("-" + x[op.a])
+			case '+':
+				newN++
+				body.WriteString("+" + y[op.b])
+			}
+		}
+		if oldN == 0 {
+			oldStart--
+		}
+		if newN == 0 {
+			newStart--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n%s", oldStart, oldN, newStart, newN, body.String())
+		i = end
+	}
+	return out.String()
+}
+
+// diffLines splits s into lines that each end in "\n".
+func diffLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if last := lines[len(lines)-1]; last == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		lines[len(lines)-1] = last + "\n\\ No newline at end of file\n"
+	}
+	return lines
+}
+
+// diffOp is one line of an edit script; a and b are the positions in the old
+// and new input (for '+' ops, a is where the line would go, and vice versa).
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	a, b int
+}
+
+func lineOps(x, y []string) []diffOp {
+	// Common prefix and suffix never need the table.
+	pre := 0
+	for pre < len(x) && pre < len(y) && x[pre] == y[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(x)-pre && suf < len(y)-pre && x[len(x)-1-suf] == y[len(y)-1-suf] {
+		suf++
+	}
+	n, m := len(x)-pre-suf, len(y)-pre-suf
+
+	var ops []diffOp
+	for i := 0; i < pre; i++ {
+		ops = append(ops, diffOp{' ', i, i})
+	}
+	if n*m > maxDiffCells {
+		for i := 0; i < n; i++ {
+			ops = append(ops, diffOp{'-', pre + i, pre})
+		}
+		for j := 0; j < m; j++ {
+			ops = append(ops, diffOp{'+', pre + n, pre + j})
+		}
+	} else {
+		// lcs[i][j] is the LCS length of x[pre+i:pre+n] and y[pre+j:pre+m].
+		lcs := make([][]int32, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if x[pre+i] == y[pre+j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n || j < m {
+			switch {
+			case i < n && j < m && x[pre+i] == y[pre+j]:
+				ops = append(ops, diffOp{' ', pre + i, pre + j})
+				i++
+				j++
+			case j < m && (i == n || lcs[i][j+1] > lcs[i+1][j]):
+				ops = append(ops, diffOp{'+', pre + i, pre + j})
+				j++
+			default:
+				ops = append(ops, diffOp{'-', pre + i, pre + j})
+				i++
+			}
+		}
+	}
+	for k := 0; k < suf; k++ {
+		ops = append(ops, diffOp{' ', len(x) - suf + k, len(y) - suf + k})
+	}
+	return ops
+}
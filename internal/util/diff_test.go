@@ -0,0 +1,54 @@
+package util
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	b := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	want := "--- old\n+++ new\n@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n@@ -8,3 +8,4 @@\n h\n i\n j\n+k\n"
+	if got := UnifiedDiff("old", "new", a, b, 3); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := UnifiedDiff("old", "new", a, a, 3); got != "" {
+		t.Fatalf("equal inputs: %q", got)
+	}
+	if got := UnifiedDiff("old", "new", "", "x\n", 3); got != "--- old\n+++ new\n@@ -0,0 +1,1 @@\n+x\n" {
+		t.Fatalf("from empty: %q", got)
+	}
+	if got := UnifiedDiff("old", "new", "x", "x\n", 3); !strings.Contains(got, "-x\n\\ No newline at end of file\n+x\n") {
+		t.Fatalf("missing newline: %q", got)
+	}
+}
+
+// TestUnifiedDiff_Patch checks the output applies with patch(1) when it is installed.
+func TestUnifiedDiff_Patch(t *testing.T) {
+	if _, err := exec.LookPath("patch"); err != nil {
+		t.Skip("patch not installed")
+	}
+	pairs := [][2]string{
+		{"one\ntwo\nthree\n", "zero\none\nthree\nfour\n"},
+		{strings.Repeat("x\ny\n", 20), strings.Repeat("x\nz\ny\n", 15)},
+		{"# T\n\nold para\n\n## S\n- a\n- b\n", "---\nname: t\n---\n# T\n\nnew para\n\n## S\n- a\n- c\n- b\n"},
+	}
+	for i, p := range pairs {
+		dir := t.TempDir()
+		f := filepath.Join(dir, "f")
+		if err := os.WriteFile(f, []byte(p[0]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command("patch", "-s", f)
+		cmd.Stdin = strings.NewReader(UnifiedDiff("f", "f", p[0], p[1], 2))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("case %d: patch: %v: %s", i, err, out)
+		}
+		if got, _ := os.ReadFile(f); string(got) != p[1] {
+			t.Fatalf("case %d: patched to %q, want %q", i, got, p[1])
+		}
+	}
+}
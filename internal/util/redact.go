@@ -0,0 +1,112 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// minSecretLen keeps short values (flags, "1", "true") from being treated as
+// secrets and blanking out unrelated text.
+const minSecretLen = 6
+
+var (
+	secretsMu sync.RWMutex
+	secretSet = map[string]bool{}
+	redactor  *strings.Replacer
+)
+
+// AddSecret registers values that Redact replaces with "<redacted>". Secrets
+// are never forgotten: a rotated token may still show up in old output.
+func AddSecret(values ...string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	added := false
+	for _, v := range values {
+		if len(v) >= minSecretLen && !secretSet[v] {
+			secretSet[v] = true
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+	list := make([]string, 0, len(secretSet))
+	for v := range secretSet {
+		list = append(list, v)
+	}
+	// Longest first, so a secret containing another is replaced whole.
+	sort.Slice(list, func(i, j int) bool { return len(list[i]) > len(list[j]) })
+	var pairs []string
+	for _, v := range list {
+		pairs = append(pairs, v, "<redacted>")
+	}
+	redactor = strings.NewReplacer(pairs...)
+}
+
+// Redact replaces every registered secret in s.
+func Redact(s string) string {
+	secretsMu.RLock()
+	r := redactor
+	secretsMu.RUnlock()
+	if r == nil {
+		return s
+	}
+	return r.Replace(s)
+}
+
+// ContainsSecret reports whether r holds a registered secret, reading it in
+// chunks so large files need not fit in memory.
+func ContainsSecret(r io.Reader) (bool, error) {
+	secretsMu.RLock()
+	list := make([][]byte, 0, len(secretSet))
+	longest := 0
+	for v := range secretSet {
+		list = append(list, []byte(v))
+		longest = max(longest, len(v))
+	}
+	secretsMu.RUnlock()
+	if len(list) == 0 {
+		return false, nil
+	}
+
+	chunk := make([]byte, 64*1024)
+	var buf []byte
+	for {
+		n, err := r.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		for _, v := range list {
+			if bytes.Contains(buf, v) {
+				return true, nil
+			}
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		// Keep a tail so a secret split across reads is still found.
+		if keep := longest - 1; len(buf) > keep {
+			copy(buf, buf[len(buf)-keep:])
+			buf = buf[:keep]
+		}
+	}
+}
+
+// RedactWriter redacts each write to w; it suits line-oriented output such
+// as the log package, which writes one entry per call.
+func RedactWriter(w io.Writer) io.Writer {
+	return redactWriter{w}
+}
+
+type redactWriter struct{ w io.Writer }
+
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
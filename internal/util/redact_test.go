@@ -0,0 +1,31 @@
+package util
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestRedact(t *testing.T) {
+	AddSecret("123456:ABC-token", "123456", "on") // "on" is too short to register
+	if got := Redact("GET https://api.telegram.org/bot123456:ABC-token/getMe: on 123456"); got != "GET https://api.telegram.org/bot<redacted>/getMe: on <redacted>" {
+		t.Fatalf("Redact = %q", got)
+	}
+
+	var buf bytes.Buffer
+	l := log.New(RedactWriter(&buf), "", 0)
+	l.Printf("telegram: Post %q: timeout", "https://x/bot123456:ABC-token/getUpdates")
+	if got := buf.String(); got != "telegram: Post \"https://x/bot<redacted>/getUpdates\": timeout\n" {
+		t.Fatalf("log = %q", got)
+	}
+
+	// A secret split across reads is still found.
+	if ok, err := ContainsSecret(iotest.OneByteReader(strings.NewReader("x 123456:ABC-token y"))); !ok || err != nil {
+		t.Fatalf("ContainsSecret = %v, %v", ok, err)
+	}
+	if ok, _ := ContainsSecret(strings.NewReader("12345 ABC-token")); ok {
+		t.Fatal("no secret in the text")
+	}
+}
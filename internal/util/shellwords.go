@@ -0,0 +1,98 @@
+package util
+
+import (
+	"errors"
+	"strings"
+)
+
+// SplitWords splits s into words the way a POSIX shell does, minus expansions:
+// words are separated by unquoted blanks; 'single quotes' keep everything
+// literally; "double quotes" keep blanks and allow the escapes \" \\ \$ \`;
+// outside quotes a backslash escapes the next character (and a backslash
+// before a newline joins lines). An unterminated quote or a trailing backslash
+// is an error.
+func SplitWords(s string) ([]string, error) {
+	words, _, err := SplitWordsN(s, -1)
+	return words, err
+}
+
+// SplitWordsN is SplitWords stopping after n words (n < 0: all of them). The
+// rest of s is returned unparsed, without leading blanks.
+func SplitWordsN(s string, n int) ([]string, string, error) {
+	var (
+		words  []string
+		word   strings.Builder
+		inWord bool
+	)
+	i := 0
+	for i < len(s) && (n < 0 || len(words) < n) {
+		c := s[i]
+		switch {
+		case isBlank(c):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			i++
+		case c == '\\':
+			if i+1 >= len(s) {
+				return nil, "", errors.New("trailing backslash")
+			}
+			if s[i+1] != '\n' {
+				word.WriteByte(s[i+1])
+				inWord = true
+			}
+			i += 2
+		case c == '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return nil, "", errors.New("unterminated ' quote")
+			}
+			word.WriteString(s[i+1 : i+1+j])
+			inWord = true
+			i += j + 2
+		case c == '"':
+			i++
+			closed := false
+			for i < len(s) {
+				d := s[i]
+				if d == '"' {
+					closed = true
+					i++
+					break
+				}
+				if d == '\\' && i+1 < len(s) {
+					switch s[i+1] {
+					case '"', '\\', '$', '`':
+						word.WriteByte(s[i+1])
+						i += 2
+						continue
+					case '\n':
+						i += 2
+						continue
+					}
+				}
+				word.WriteByte(d)
+				i++
+			}
+			if !closed {
+				return nil, "", errors.New(`unterminated " quote`)
+			}
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+			i++
+		}
+	}
+	if inWord { // the last word ran to the end of s
+		words = append(words, word.String())
+	}
+	rest := strings.TrimLeft(s[i:], " \t\r\n")
+	return words, rest, nil
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"  a  b\tc\n", []string{"a", "b", "c"}},
+		{`-c model_reasoning_effort="high"`, []string{"-c", "model_reasoning_effort=high"}},
+		{`-c 'model="o3"'`, []string{"-c", `model="o3"`}},
+		{`"my file.txt"`, []string{"my file.txt"}},
+		{`my\ file.txt`, []string{"my file.txt"}},
+		{`"a \"q\" \\ \$x \n"`, []string{`a "q" \ $x \n`}},
+		{`'it''s'`, []string{"its"}},
+		{`"it's"`, []string{"it's"}},
+		{`'' ""`, []string{"", ""}},
+		{"a\\\nb", []string{"ab"}},
+		{`pre"mid dle"'post fix'`, []string{"premid dlepost fix"}},
+		{"中文 参数", []string{"中文", "参数"}},
+	} {
+		got, err := SplitWords(tc.in)
+		if err != nil || !slices.Equal(got, tc.want) {
+			t.Errorf("SplitWords(%q) = %q, %v; want %q", tc.in, got, err, tc.want)
+		}
+	}
+
+	for _, in := range []string{`"open`, `'open`, `trailing\`} {
+		if got, err := SplitWords(in); err == nil {
+			t.Errorf("SplitWords(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestSplitWordsN(t *testing.T) {
+	words, rest, err := SplitWordsN("/schedule  add 09:00   summarize  \"news\"\nand it's done", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(words, []string{"/schedule", "add", "09:00"}) || rest != "summarize  \"news\"\nand it's done" {
+		t.Fatalf("words=%q rest=%q", words, rest)
+	}
+	words, rest, err = SplitWordsN("/get", 3)
+	if err != nil || !slices.Equal(words, []string{"/get"}) || rest != "" {
+		t.Fatalf("short input: words=%q rest=%q err=%v", words, rest, err)
+	}
+}
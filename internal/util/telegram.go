@@ -1,17 +1,23 @@
 package util
 
-import "strings"
+import (
+	"strings"
+	"unicode/utf8"
+)
 
 // SanitizeTelegramText removes NUL bytes.
 func SanitizeTelegramText(s string) string {
 	return strings.ReplaceAll(s, "\x00", "")
 }
 
-// TrimToBytes truncates a string to at most n bytes (not runes).
-// Fine for MVP since CLI output is typically ASCII/UTF-8; Telegram accepts UTF-8.
+// TrimToBytes truncates a string to at most n bytes without splitting a
+// UTF-8 sequence. Use SplitTelegramHTML for messages that must not lose text.
 func TrimToBytes(s string, n int) string {
 	if n <= 0 || len(s) <= n {
 		return s
 	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
 	return s[:n]
 }
@@ -4,151 +4,611 @@ import (
 	"html"
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 var (
-	indentRE   = regexp.MustCompile(`(?m)^[ \t]{4,}`)
-	shellRE    = regexp.MustCompile(`(?m)^.*\\$ `)
-	codeFence  = regexp.MustCompile("```")
-	bulletRE   = regexp.MustCompile(`^\s*([-*]|•)\s+`)
+	headingRE  = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+	hruleRE    = regexp.MustCompile(`^ {0,3}([-*_])(?:[ \t]*([-*_])){2,}[ \t]*$`)
+	listItemRE = regexp.MustCompile(`^([ \t]*)([-*+•]|\d{1,9}[.)])[ \t]+(.*)$`)
+	tableSepRE = regexp.MustCompile(`^[ \t]*\|?[ \t]*:?-{1,}:?[ \t]*(\|[ \t]*:?-{1,}:?[ \t]*)*\|?[ \t]*$`)
+	langRE     = regexp.MustCompile(`^[A-Za-z0-9_+#.-]+$`)
 	urlPrefix1 = "http://"
 	urlPrefix2 = "https://"
 )
 
-// FormatTelegramHTML formats content for Telegram HTML parse mode.
-// Goal: look like "markdown preview" without forcing <pre> (which shows a "copy" affordance).
-// We only use <pre> when the content strongly looks like code/shell output.
+// Bullets per nesting level.
+var listBullets = []string{"•", "◦", "▪"}
+
+// FormatTelegramHTML renders Markdown for Telegram's HTML parse mode.
+//
+// Supported: headings, nested lists (incl. task lists), **bold**, *italic*,
+// ~~strikethrough~~, `code`, links, blockquotes, fenced code blocks with a
+// language (<pre><code class="language-go">) mixed with prose, and pipe tables
+// rendered as aligned monospace. Everything else is escaped text, so the result
+// only ever contains balanced tags from Telegram's allowed set.
 func FormatTelegramHTML(s string) (string, bool) {
 	s = SanitizeTelegramText(s)
 	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimRight(s, "\n")
+	return renderBlocks(strings.Split(s, "\n"), false), true
+}
 
-	if looksLikeCode(s) {
-		esc := html.EscapeString(s)
-		return "<pre>" + esc + "</pre>", true
+// renderBlocks renders a sequence of Markdown lines. Inside blockquotes (quoted)
+// Telegram does not allow <pre>, so code and tables fall back to <code>.
+func renderBlocks(lines []string, quoted bool) string {
+	var out []string
+	blank := func() {
+		if len(out) > 0 && out[len(out)-1] != "" {
+			out = append(out, "")
+		}
 	}
+	prevBlank := true
+
+	for i := 0; i < len(lines); {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+
+		switch {
+		case line == "":
+			blank()
+			prevBlank = true
+			i++
+			continue
+
+		case indent < 4 && isFence(trimmed):
+			fence := fenceMarker(trimmed)
+			lang := strings.TrimSpace(trimmed[len(fence):])
+			if f := strings.Fields(lang); len(f) > 0 {
+				lang = f[0]
+			}
+			var body []string
+			j := i + 1
+			for ; j < len(lines); j++ {
+				t := strings.TrimSpace(lines[j])
+				if strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]) == "" {
+					break
+				}
+				body = append(body, stripIndent(lines[j], indent))
+			}
+			out = append(out, codeBlock(strings.Join(body, "\n"), lang, quoted))
+			i = j + 1
+
+		case indent < 4 && strings.HasPrefix(trimmed, ">"):
+			var inner []string
+			for ; i < len(lines); i++ {
+				t := strings.TrimLeft(lines[i], " ")
+				if !strings.HasPrefix(t, ">") {
+					break
+				}
+				t = strings.TrimPrefix(t, ">")
+				t = strings.TrimPrefix(t, " ")
+				inner = append(inner, t)
+			}
+			body := renderBlocks(inner, true)
+			if body == "" {
+				break
+			}
+			if quoted {
+				// Telegram blockquotes cannot nest.
+				out = append(out, body)
+			} else {
+				out = append(out, "<blockquote>"+body+"</blockquote>")
+			}
+
+		case headingRE.MatchString(line):
+			m := headingRE.FindStringSubmatch(line)
+			out = append(out, "<b>"+renderInline(m[2])+"</b>")
+			i++
+
+		case hruleRE.MatchString(line) && sameRuleChars(line):
+			out = append(out, "──────────")
+			i++
+
+		case i+1 < len(lines) && strings.Contains(line, "|") && tableSepRE.MatchString(lines[i+1]) &&
+			strings.Contains(lines[i+1], "-") && len(splitRow(line)) == len(splitRow(lines[i+1])):
+			header := splitRow(line)
+			aligns := parseAligns(splitRow(lines[i+1]))
+			var rows [][]string
+			j := i + 2
+			for ; j < len(lines); j++ {
+				t := strings.TrimSpace(lines[j])
+				if t == "" || !strings.Contains(t, "|") {
+					break
+				}
+				rows = append(rows, splitRow(t))
+			}
+			out = append(out, renderTable(header, aligns, rows, quoted))
+			i = j
+
+		case listItemRE.MatchString(line):
+			j := i
+			var items []string
+			for j < len(lines) {
+				l := strings.TrimRight(lines[j], " \t")
+				if l == "" {
+					// A blank line continues the list only if another item follows.
+					k := j + 1
+					for k < len(lines) && strings.TrimSpace(lines[k]) == "" {
+						k++
+					}
+					if k < len(lines) && listItemRE.MatchString(lines[k]) {
+						items = append(items, "")
+						j = k
+						continue
+					}
+					break
+				}
+				if !listItemRE.MatchString(l) && (len(items) == 0 || leadingWidth(l) == 0) {
+					break
+				}
+				items = append(items, l)
+				j++
+			}
+			out = append(out, renderList(items))
+			i = j
+
+		case indent >= 4 && prevBlank:
+			var body []string
+			j := i
+			for ; j < len(lines); j++ {
+				l := strings.TrimRight(lines[j], " \t")
+				if l != "" && leadingWidth(l) < 4 {
+					break
+				}
+				body = append(body, stripIndent(l, 4))
+			}
+			for len(body) > 0 && body[len(body)-1] == "" {
+				body = body[:len(body)-1]
+			}
+			out = append(out, codeBlock(strings.Join(body, "\n"), "", quoted))
+			i = j
 
-	lines := strings.Split(s, "\n")
-	for i := range lines {
-		lines[i] = formatLine(lines[i])
+		default:
+			out = append(out, renderInline(line))
+			i++
+		}
+		prevBlank = false
 	}
-	out := strings.Join(lines, "\n")
-	return out, true
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	return strings.Join(out, "\n")
 }
 
-func looksLikeCode(s string) bool {
-	if codeFence.MatchString(s) {
-		return true
+func isFence(s string) bool {
+	return strings.HasPrefix(s, "```") || strings.HasPrefix(s, "~~~")
+}
+
+func fenceMarker(s string) string {
+	n := 0
+	for n < len(s) && s[n] == s[0] {
+		n++
 	}
-	if indentRE.MatchString(s) {
-		return true
+	return s[:n]
+}
+
+func sameRuleChars(line string) bool {
+	t := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, line)
+	return strings.Trim(t, t[:1]) == ""
+}
+
+// leadingWidth counts leading indentation, a tab being 4 columns.
+func leadingWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		switch r {
+		case ' ':
+			w++
+		case '\t':
+			w += 4
+		default:
+			return w
+		}
 	}
-	if shellRE.MatchString(s) {
-		return true
+	return w
+}
+
+// stripIndent removes up to n columns of leading whitespace.
+func stripIndent(s string, n int) string {
+	w := 0
+	for i, r := range s {
+		if w >= n || (r != ' ' && r != '\t') {
+			return s[i:]
+		}
+		if r == '\t' {
+			w += 4
+		} else {
+			w++
+		}
 	}
-	return false
+	return ""
 }
 
-func formatLine(line string) string {
-	raw := strings.TrimRight(line, "\r")
-	if bulletRE.MatchString(raw) {
-		raw = bulletRE.ReplaceAllString(raw, "• ")
+func codeBlock(code, lang string, quoted bool) string {
+	esc := html.EscapeString(code)
+	if quoted {
+		return "<code>" + esc + "</code>"
 	}
-	return renderInlineMarkdownToHTML(raw)
+	if lang != "" && langRE.MatchString(lang) {
+		return `<pre><code class="language-` + html.EscapeString(lang) + `">` + esc + "</code></pre>"
+	}
+	return "<pre>" + esc + "</pre>"
 }
 
-// renderInlineMarkdownToHTML supports a tiny subset:
-// - **bold**
-// - `inline code`
-// - [text](https://url)
-// Everything else is HTML-escaped.
-func renderInlineMarkdownToHTML(s string) string {
-	var b strings.Builder
-	b.Grow(len(s) + 16)
+// renderList renders list lines with nesting derived from their indentation.
+func renderList(lines []string) string {
+	var out []string
+	var stack []int // indentation of open levels
+	depth := 0
+	for _, l := range lines {
+		if l == "" {
+			out = append(out, "")
+			continue
+		}
+		m := listItemRE.FindStringSubmatch(l)
+		if m == nil {
+			// Continuation text of the previous item.
+			out = append(out, strings.Repeat("  ", depth+1)+renderInline(strings.TrimSpace(l)))
+			continue
+		}
+		w := leadingWidth(m[1])
+		for len(stack) > 0 && w < stack[len(stack)-1] {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 || w > stack[len(stack)-1] {
+			stack = append(stack, w)
+		}
+		depth = len(stack) - 1
 
-	inBold := false
-	inCode := false
+		marker := m[2]
+		if !(marker[0] >= '0' && marker[0] <= '9') {
+			marker = listBullets[depth%len(listBullets)]
+		}
+		text := m[3]
+		switch {
+		case strings.HasPrefix(text, "[ ] "):
+			marker, text = "☐", text[4:]
+		case strings.HasPrefix(text, "[x] "), strings.HasPrefix(text, "[X] "):
+			marker, text = "☑", text[4:]
+		}
+		out = append(out, strings.Repeat("  ", depth)+marker+" "+renderInline(text))
+	}
+	return strings.Join(out, "\n")
+}
+
+// Tables.
+
+type align int
+
+const (
+	alignLeft align = iota
+	alignCenter
+	alignRight
+)
 
-	closeAll := func() {
-		if inCode {
-			b.WriteString("</code>")
-			inCode = false
+// splitRow splits a pipe table row into trimmed cells; "\|" is a literal pipe.
+func splitRow(s string) []string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "|")
+	if strings.HasSuffix(s, "|") && !strings.HasSuffix(s, `\|`) {
+		s = s[:len(s)-1]
+	}
+	var cells []string
+	var cur strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == '|':
+			cur.WriteByte('|')
+			i++
+		case s[i] == '|':
+			cells = append(cells, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cur.String()))
+}
+
+func parseAligns(sep []string) []align {
+	out := make([]align, len(sep))
+	for i, c := range sep {
+		l, r := strings.HasPrefix(c, ":"), strings.HasSuffix(c, ":")
+		switch {
+		case l && r:
+			out[i] = alignCenter
+		case r:
+			out[i] = alignRight
+		}
+	}
+	return out
+}
+
+func renderTable(header []string, aligns []align, rows [][]string, quoted bool) string {
+	cols := len(header)
+	all := append([][]string{header}, rows...)
+	for i, r := range all {
+		cells := make([]string, cols)
+		for c := 0; c < cols && c < len(r); c++ {
+			cells[c] = plainInline(r[c])
 		}
-		if inBold {
-			b.WriteString("</b>")
-			inBold = false
+		all[i] = cells
+	}
+	widths := make([]int, cols)
+	for _, r := range all {
+		for c, cell := range r {
+			if w := displayWidth(cell); w > widths[c] {
+				widths[c] = w
+			}
 		}
 	}
 
+	var lines []string
+	for i, r := range all {
+		var parts []string
+		for c, cell := range r {
+			parts = append(parts, pad(cell, widths[c], aligns[c]))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(parts, " │ "), " "))
+		if i == 0 {
+			var sep []string
+			for _, w := range widths {
+				sep = append(sep, strings.Repeat("─", w))
+			}
+			lines = append(lines, strings.Join(sep, "─┼─"))
+		}
+	}
+	esc := html.EscapeString(strings.Join(lines, "\n"))
+	if quoted {
+		return "<code>" + esc + "</code>"
+	}
+	return "<pre>" + esc + "</pre>"
+}
+
+func pad(s string, width int, a align) string {
+	gap := width - displayWidth(s)
+	if gap <= 0 {
+		return s
+	}
+	switch a {
+	case alignRight:
+		return strings.Repeat(" ", gap) + s
+	case alignCenter:
+		l := gap / 2
+		return strings.Repeat(" ", l) + s + strings.Repeat(" ", gap-l)
+	default:
+		return s + strings.Repeat(" ", gap)
+	}
+}
+
+// plainInline strips inline Markdown for monospace contexts (table cells).
+func plainInline(s string) string {
+	var b strings.Builder
 	for i := 0; i < len(s); {
-		// Auto-link plain URLs (outside code).
-		if !inCode && (strings.HasPrefix(s[i:], urlPrefix1) || strings.HasPrefix(s[i:], urlPrefix2)) {
-			u, n, suffix := readURL(s[i:])
-			if u != "" && n > 0 {
-				b.WriteString(`<a href="`)
-				b.WriteString(html.EscapeString(u))
-				b.WriteString(`">`)
-				b.WriteString(html.EscapeString(u))
-				b.WriteString(`</a>`)
-				if suffix != "" {
-					b.WriteString(html.EscapeString(suffix))
-				}
+		if s[i] == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			b.WriteByte(s[i+1])
+			i += 2
+			continue
+		}
+		if s[i] == '[' {
+			if txt, _, n, ok := tryParseLink(s[i:]); ok {
+				b.WriteString(txt)
 				i += n
 				continue
 			}
 		}
+		if strings.HasPrefix(s[i:], "**") || strings.HasPrefix(s[i:], "__") || strings.HasPrefix(s[i:], "~~") {
+			i += 2
+			continue
+		}
+		if s[i] == '`' {
+			i++
+			continue
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return b.String()
+}
+
+// displayWidth approximates terminal column width: East Asian wide and emoji
+// runes take two columns, combining marks none.
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Mn, r) || r == '‍' || (r >= 0xFE00 && r <= 0xFE0F):
+		case r >= 0x1100 && r <= 0x115F, r >= 0x2E80 && r <= 0xA4CF, r >= 0xAC00 && r <= 0xD7A3,
+			r >= 0xF900 && r <= 0xFAFF, r >= 0xFE30 && r <= 0xFE4F, r >= 0xFF00 && r <= 0xFF60,
+			r >= 0xFFE0 && r <= 0xFFE6, r >= 0x1F300 && r <= 0x1FAFF, r >= 0x20000 && r <= 0x3FFFD:
+			w += 2
+		default:
+			w++
+		}
+	}
+	return w
+}
+
+// Inline Markdown.
+
+func renderInline(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 16)
+	inlineTo(&b, s)
+	return b.String()
+}
+
+// inlineTo renders one line. Every construct emits its opening and closing tag
+// together, so the output is balanced no matter how broken the input is.
+func inlineTo(b *strings.Builder, s string) {
+	// Delimiters known to have no closer further on; remembering them keeps
+	// long lines full of stray '*' or '`' linear instead of quadratic.
+	unclosed := map[string]bool{}
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		// Backslash escapes: \* \_ \` ...
+		if c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+		}
+
+		// Code span: `x` or ``x``.
+		if c == '`' {
+			n := runLen(s[i:], '`')
+			j := -1
+			if !unclosed[s[i:i+n]] {
+				j = findCodeClose(s, i+n, n)
+			}
+			if j >= 0 {
+				code := s[i+n : j]
+				if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+					code = code[1 : len(code)-1]
+				}
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i = j + n
+				continue
+			}
+			unclosed[s[i:i+n]] = true
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+		}
 
 		// Link: [text](https://...)
-		if s[i] == '[' && !inCode {
+		if c == '[' {
 			if txt, url, n, ok := tryParseLink(s[i:]); ok {
-				// Don't allow nested markup in link text; treat as plain.
-				b.WriteString(`<a href="`)
-				b.WriteString(html.EscapeString(url))
-				b.WriteString(`">`)
-				b.WriteString(html.EscapeString(txt))
-				b.WriteString(`</a>`)
+				b.WriteString(`<a href="` + html.EscapeString(url) + `">` + html.EscapeString(txt) + `</a>`)
 				i += n
 				continue
 			}
 		}
 
-		// Bold toggle: **
-		if !inCode && i+1 < len(s) && s[i] == '*' && s[i+1] == '*' {
-			if inBold {
-				b.WriteString("</b>")
-				inBold = false
-			} else {
-				b.WriteString("<b>")
-				inBold = true
+		// Plain URLs.
+		if (c == 'h') && (strings.HasPrefix(s[i:], urlPrefix1) || strings.HasPrefix(s[i:], urlPrefix2)) && (i == 0 || !isWordByte(s[i-1])) {
+			if u, n, suffix := readURL(s[i:]); u != "" && n > 0 {
+				b.WriteString(`<a href="` + html.EscapeString(u) + `">` + html.EscapeString(u) + `</a>`)
+				b.WriteString(html.EscapeString(suffix))
+				i += n
+				continue
 			}
-			i += 2
-			continue
 		}
 
-		// Code toggle: `
-		if s[i] == '`' {
-			// Code should win over bold visually.
-			if inCode {
-				b.WriteString("</code>")
-				inCode = false
-			} else {
-				if inBold {
-					b.WriteString("</b>")
-					inBold = false
-				}
-				b.WriteString("<code>")
-				inCode = true
+		// Emphasis: **bold** __bold__ *italic* _italic_ ~~strike~~
+		if c == '*' || c == '_' || c == '~' {
+			if n, ok := tryEmphasis(b, s, i, unclosed); ok {
+				i = n
+				continue
 			}
-			i++
-			continue
 		}
 
-		// Regular char.
 		b.WriteString(html.EscapeString(s[i : i+1]))
 		i++
 	}
+}
 
-	closeAll()
-	return b.String()
+func tryEmphasis(b *strings.Builder, s string, i int, unclosed map[string]bool) (int, bool) {
+	c := s[i]
+	delim, tag := string(c), "i"
+	if i+1 < len(s) && s[i+1] == c {
+		delim = string([]byte{c, c})
+		tag = "b"
+		if c == '~' {
+			tag = "s"
+		}
+	} else if c == '~' {
+		return 0, false
+	}
+	start := i + len(delim)
+	if start >= len(s) || isSpaceByte(s[start]) || unclosed[delim] {
+		return 0, false
+	}
+	// Intraword underscores (snake_case) are not emphasis.
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return 0, false
+	}
+
+	for k := start + 1; k < len(s); k++ {
+		if s[k] == '`' {
+			// Delimiters inside code spans don't count.
+			n := runLen(s[k:], '`')
+			if j := findCodeClose(s, k+n, n); j >= 0 {
+				k = j + n - 1
+			} else {
+				k += n - 1
+			}
+			continue
+		}
+		if s[k] == '\\' {
+			k++
+			continue
+		}
+		if !strings.HasPrefix(s[k:], delim) || isSpaceByte(s[k-1]) {
+			continue
+		}
+		end := k + len(delim)
+		if len(delim) == 1 && ((end < len(s) && s[end] == c) || s[k-1] == c) {
+			// Part of a double delimiter.
+			continue
+		}
+		if c == '_' && end < len(s) && isWordByte(s[end]) {
+			continue
+		}
+		b.WriteString("<" + tag + ">")
+		inlineTo(b, s[start:k])
+		b.WriteString("</" + tag + ">")
+		return end, true
+	}
+	unclosed[delim] = true
+	return 0, false
+}
+
+func runLen(s string, c byte) int {
+	n := 0
+	for n < len(s) && s[n] == c {
+		n++
+	}
+	return n
+}
+
+// findCodeClose finds a backtick run of exactly n starting at or after from.
+func findCodeClose(s string, from, n int) int {
+	for k := from; k < len(s); {
+		if s[k] != '`' {
+			k++
+			continue
+		}
+		m := runLen(s[k:], '`')
+		if m == n {
+			return k
+		}
+		k += m
+	}
+	return -1
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isWordByte(c byte) bool {
+	if c >= utf8.RuneSelf {
+		return true
+	}
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isASCIIPunct(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsPunct(rune(c)) || strings.IndexByte("`*_~|<>#+-=.!$^", c) >= 0
 }
 
 func readURL(s string) (string, int, string) {
@@ -191,8 +651,9 @@ func tryParseLink(s string) (text string, url string, n int, ok bool) {
 	if len(s) < i+3 || s[i+1] != '(' {
 		return "", "", 0, false
 	}
-	j := strings.IndexByte(s[i+2:], ')')
-	if j < 0 {
+	// URLs contain no whitespace, which also keeps the scan short.
+	j := strings.IndexAny(s[i+2:], ") \t")
+	if j < 0 || s[i+2+j] != ')' {
 		return "", "", 0, false
 	}
 	txt := s[1:i]
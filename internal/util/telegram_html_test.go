@@ -0,0 +1,131 @@
+package util
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// Golden tests: testdata/markdown/<name>.md renders to <name>.html.
+// Run `go test ./internal/util -run Golden -update` after intended changes.
+func TestFormatTelegramHTML_Golden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "markdown", "*.md"))
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("no golden inputs: %v", err)
+	}
+	for _, in := range inputs {
+		name := strings.TrimSuffix(filepath.Base(in), ".md")
+		t.Run(name, func(t *testing.T) {
+			src, err := os.ReadFile(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := FormatTelegramHTML(string(src))
+			if err := checkTelegramHTML(got); err != nil {
+				t.Fatalf("invalid HTML: %v\n%s", err, got)
+			}
+			golden := strings.TrimSuffix(in, ".md") + ".html"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got+"\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run with -update)", err)
+			}
+			if got != strings.TrimSuffix(string(want), "\n") {
+				t.Fatalf("mismatch for %s\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+			}
+		})
+	}
+}
+
+func TestRenderInline(t *testing.T) {
+	cases := map[string]string{
+		"**a *b* c**":      "<b>a <i>b</i> c</b>",
+		"*a **b** c*":      "<i>a <b>b</b> c</i>",
+		"a_b_c":            "a_b_c",
+		"_x_":              "<i>x</i>",
+		"** not bold **":   "** not bold **",
+		"`**x**`":          "<code>**x**</code>",
+		"``a ` b``":        "<code>a ` b</code>",
+		"~single~":         "~single~",
+		"~~a~~b":           "<s>a</s>b",
+		"x <y> & z":        "x &lt;y&gt; &amp; z",
+		"**a `**` b**":     "<b>a <code>**</code> b</b>",
+		"see https://a.b.": `see <a href="https://a.b">https://a.b</a>.`,
+	}
+	for in, want := range cases {
+		if got := renderInline(in); got != want {
+			t.Errorf("renderInline(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+var (
+	tagRE    = regexp.MustCompile(`^<(/?)([a-z-]+)(?: [^<>]*)?>`)
+	entityRE = regexp.MustCompile(`^&(lt|gt|amp|quot|#\d+);$`)
+)
+
+// Tags Telegram accepts in HTML parse mode.
+var telegramTags = map[string]bool{
+	"b": true, "strong": true, "i": true, "em": true, "u": true, "ins": true,
+	"s": true, "strike": true, "del": true, "a": true, "code": true, "pre": true,
+	"blockquote": true, "tg-spoiler": true, "span": true,
+}
+
+// checkTelegramHTML verifies s only uses allowed tags, that they are balanced,
+// and that every other '<', '>' and '&' is escaped.
+func checkTelegramHTML(s string) error {
+	var stack []string
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '<':
+			m := tagRE.FindStringSubmatch(s[i:])
+			if m == nil {
+				return fmt.Errorf("raw '<' at %d", i)
+			}
+			if !telegramTags[m[2]] {
+				return fmt.Errorf("tag %q not allowed", m[2])
+			}
+			if m[1] == "" {
+				if m[2] == "blockquote" {
+					for _, open := range stack {
+						if open == "blockquote" {
+							return fmt.Errorf("nested blockquote at %d", i)
+						}
+					}
+				}
+				stack = append(stack, m[2])
+			} else {
+				if len(stack) == 0 || stack[len(stack)-1] != m[2] {
+					return fmt.Errorf("unbalanced </%s> at %d (open: %v)", m[2], i, stack)
+				}
+				stack = stack[:len(stack)-1]
+			}
+			i += len(m[0])
+		case '>':
+			return fmt.Errorf("raw '>' at %d", i)
+		case '&':
+			j := strings.IndexByte(s[i:], ';')
+			if j < 0 || !entityRE.MatchString(s[i:i+j+1]) {
+				return fmt.Errorf("bad entity at %d", i)
+			}
+			i += j + 1
+		default:
+			i++
+		}
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("unclosed tags: %v", stack)
+	}
+	return nil
+}
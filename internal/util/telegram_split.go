@@ -0,0 +1,175 @@
+package util
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// TelegramMaxText is Telegram's message limit, in UTF-16 code units of the
+// text after entity parsing (tags don't count, an entity counts once).
+const TelegramMaxText = 4096
+
+var (
+	htmlTagRE    = regexp.MustCompile(`^<(/?)([a-zA-Z][a-zA-Z0-9-]*)(?:\s[^<>]*)?>`)
+	htmlEntityRE = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[a-zA-Z]{1,10});`)
+)
+
+type htmlToken struct {
+	raw   string
+	tag   string // tag name for tags, "" for text
+	close bool
+	width int // visible length in UTF-16 units
+}
+
+// tokenizeHTML splits s into tags, entities and single runes. Anything that is
+// not a well-formed tag or entity is treated as text.
+func tokenizeHTML(s string) []htmlToken {
+	var toks []htmlToken
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '<':
+			if m := htmlTagRE.FindStringSubmatch(s[i:]); m != nil {
+				toks = append(toks, htmlToken{raw: m[0], tag: strings.ToLower(m[2]), close: m[1] == "/"})
+				i += len(m[0])
+				continue
+			}
+		case '&':
+			if m := htmlEntityRE.FindString(s[i:]); m != "" {
+				toks = append(toks, htmlToken{raw: m, width: 1})
+				i += len(m)
+				continue
+			}
+		}
+		r, n := utf8.DecodeRuneInString(s[i:])
+		w := 1
+		if r > 0xFFFF {
+			w = 2
+		}
+		toks = append(toks, htmlToken{raw: s[i : i+n], width: w})
+		i += n
+	}
+	return toks
+}
+
+// SplitTelegramHTML splits rendered Telegram HTML into messages of at most
+// limit visible characters (TelegramMaxText when limit <= 0). It prefers
+// paragraph breaks, then line breaks, then spaces; tags open at a split are
+// closed at the end of one chunk and reopened at the start of the next. No
+// text is dropped and UTF-8 sequences and entities are never cut.
+func SplitTelegramHTML(s string, limit int) []string {
+	if limit <= 0 {
+		limit = TelegramMaxText
+	}
+	toks := tokenizeHTML(s)
+	total := 0
+	for _, t := range toks {
+		total += t.width
+	}
+	if total <= limit {
+		return []string{s}
+	}
+
+	var chunks []string
+	var open []htmlToken // tags open at toks[start]
+	for start := 0; start < len(toks); {
+		// Furthest end that fits.
+		end, w := start, 0
+		for end < len(toks) && w+toks[end].width <= limit {
+			w += toks[end].width
+			end++
+		}
+		if end == start {
+			end++ // a single token wider than limit still has to go somewhere
+		}
+		if end < len(toks) {
+			end = splitPoint(toks, start, end, limit)
+		}
+
+		var b strings.Builder
+		for _, t := range open {
+			b.WriteString(t.raw)
+		}
+		for _, t := range toks[start:end] {
+			b.WriteString(t.raw)
+			open = trackTag(open, t)
+		}
+		if end < len(toks) {
+			for i := len(open) - 1; i >= 0; i-- {
+				b.WriteString("</" + open[i].tag + ">")
+			}
+		}
+		chunks = append(chunks, b.String())
+		start = end
+	}
+	return chunks
+}
+
+// splitPoint picks where to end a chunk that would otherwise end at max.
+func splitPoint(toks []htmlToken, start, max, limit int) int {
+	// Only break early if at least half the budget gets used.
+	minWidth := limit / 2
+	best := [3]int{} // paragraph, line, space
+	w := 0
+	for i := start; i < max; i++ {
+		w += toks[i].width
+		if w < minWidth {
+			continue
+		}
+		switch toks[i].raw {
+		case "\n":
+			if i > start && toks[i-1].raw == "\n" {
+				best[0] = i + 1
+			}
+			best[1] = i + 1
+		case " ":
+			best[2] = i + 1
+		}
+	}
+	end := max
+	for _, b := range best {
+		if b > start {
+			end = b
+			break
+		}
+	}
+	// Don't leave freshly opened tags empty at the end of a chunk.
+	for end-1 > start && toks[end-1].tag != "" && !toks[end-1].close {
+		end--
+	}
+	return end
+}
+
+// trackTag updates the stack of open tags after t.
+func trackTag(open []htmlToken, t htmlToken) []htmlToken {
+	if t.tag == "" {
+		return open
+	}
+	if !t.close {
+		return append(open, t)
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		if open[i].tag == t.tag {
+			return append(open[:i:i], open[i+1:]...)
+		}
+	}
+	return open
+}
+
+// TelegramHTMLToText is the visible text of Telegram HTML: tags dropped,
+// entities decoded. It is the plain-text fallback for rejected markup.
+func TelegramHTMLToText(s string) string {
+	var b strings.Builder
+	for _, t := range tokenizeHTML(s) {
+		if t.tag != "" {
+			continue
+		}
+		if t.raw[0] == '&' && len(t.raw) > 1 {
+			b.WriteString(html.UnescapeString(t.raw))
+			continue
+		}
+		b.WriteString(t.raw)
+	}
+	return b.String()
+}
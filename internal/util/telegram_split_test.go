@@ -0,0 +1,125 @@
+package util
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var anyTagRE = regexp.MustCompile(`<[^<>]*>`)
+
+// visibleText is what Telegram shows for a chunk: tags removed, entities decoded.
+func visibleText(s string) string {
+	return html.UnescapeString(anyTagRE.ReplaceAllString(s, ""))
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if r > 0xFFFF {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSplitTelegramHTML_ReopensTags(t *testing.T) {
+	in := `<b>aaaa bbbb</b> <pre><code class="language-go">cccc dddd</code></pre>`
+	got := SplitTelegramHTML(in, 6)
+	want := []string{
+		"<b>aaaa </b>",
+		"<b>bbbb</b> ",
+		`<pre><code class="language-go">cccc </code></pre>`,
+		`<pre><code class="language-go">dddd</code></pre>`,
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestSplitTelegramHTML_PrefersParagraphs(t *testing.T) {
+	para := strings.Repeat("字", 30)
+	in := para + "\n\n" + "短句" + "\n" + para
+	got := SplitTelegramHTML(in, 60)
+	if len(got) != 2 || got[0] != para+"\n\n" {
+		t.Fatalf("got %q", got)
+	}
+	if got := SplitTelegramHTML("short", 0); len(got) != 1 || got[0] != "short" {
+		t.Fatalf("short message split: %q", got)
+	}
+}
+
+func TestTrimToBytes_KeepsRunes(t *testing.T) {
+	if got := TrimToBytes("ab中文", 4); got != "ab" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func checkSplit(t *testing.T, in string, limit int) {
+	chunks := SplitTelegramHTML(in, limit)
+	var joined strings.Builder
+	for _, c := range chunks {
+		if !utf8.ValidString(c) && utf8.ValidString(in) {
+			t.Fatalf("chunk is not valid UTF-8: %q", c)
+		}
+		if n := utf16Len(visibleText(c)); n > limit && n > 2 {
+			t.Fatalf("chunk has %d chars, limit %d: %q", n, limit, c)
+		}
+		if err := checkTelegramHTML(c); err != nil {
+			t.Fatalf("chunk %q: %v (input %q)", c, err, in)
+		}
+		joined.WriteString(visibleText(c))
+	}
+	if joined.String() != visibleText(in) {
+		t.Fatalf("text changed:\n in: %q\nout: %q", visibleText(in), joined.String())
+	}
+}
+
+// FuzzSplitTelegramHTML renders arbitrary Markdown and splits it at arbitrary
+// limits: every chunk must be valid, within the limit, and nothing may be lost.
+func FuzzSplitTelegramHTML(f *testing.F) {
+	f.Add("# Title\n**bold *and italic*** text\n\n```go\nfunc main() {}\n```\n", 10)
+	f.Add("> quote with `code` and [link](https://example.com)\n- a\n  - b\n", 7)
+	f.Add("| a | b |\n|---|---|\n| 中文 | 😀😀 |\n", 3)
+	f.Add(strings.Repeat("long line without breaks ", 50), 64)
+	f.Add("a & b < c > d", 1)
+	f.Fuzz(func(t *testing.T, md string, limit int) {
+		if !utf8.ValidString(md) {
+			return
+		}
+		limit = 1 + abs(limit)%300
+		out, _ := FormatTelegramHTML(md)
+		checkSplit(t, out, limit)
+	})
+}
+
+// FuzzSplitTelegramHTML_Raw feeds arbitrary (possibly malformed) HTML: the
+// splitter must not panic, must make progress and must keep every byte.
+func FuzzSplitTelegramHTML_Raw(f *testing.F) {
+	f.Add("<b>x</i>&amp;&bogus <", 3)
+	f.Add("\xff\xfe<a href=\"x\">y", 1)
+	f.Fuzz(func(t *testing.T, s string, limit int) {
+		limit = 1 + abs(limit)%50
+		chunks := SplitTelegramHTML(s, limit)
+		if len(chunks) > len(s)+1 {
+			t.Fatalf("%d chunks for %d bytes", len(chunks), len(s))
+		}
+		var body strings.Builder
+		for _, c := range chunks {
+			body.WriteString(anyTagRE.ReplaceAllString(c, ""))
+		}
+		if body.String() != anyTagRE.ReplaceAllString(s, "") && !strings.ContainsAny(s, "<>") {
+			t.Fatalf("text changed: %q -> %q", s, chunks)
+		}
+	})
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}